@@ -0,0 +1,120 @@
+// Package api implements the HTTP JSON API used by the web administration.
+// All responses are JSON encoded; errors are returned as {"Error": "message"}
+// with an appropriate HTTP status code. Except for registration and login,
+// requests must be authenticated by the session token in the Authorization: Bearer header.
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/store"
+)
+
+func e(format string, args ...interface{}) error {
+	return fmt.Errorf("api: "+format, args...)
+}
+
+// maximum size of an accepted request body
+const maxBodySize = 32 << 20
+
+// Server serves the HTTP API
+type Server struct {
+	// AllowRegistration enables creating new user accounts via the API (disabled by default)
+	AllowRegistration bool
+
+	store *store.Store
+	rates *currency.CachingConverter
+	router
+}
+
+// New creates the API server using the store
+func New(storePtr *store.Store) *Server {
+	unknownUserOnce.Do(initUnknownUser)
+
+	s := &Server{
+		store: storePtr,
+		rates: currency.NewCachingConverter(storePtr, currency.DefaultCacheSize),
+	}
+
+	// users
+	s.handle("POST", "/users", s.handleRegister)
+	s.handle("GET", "/users/me", s.auth(s.handleGetCurrentUser))
+	s.handle("POST", "/login", s.handleLogin)
+	s.handle("POST", "/logout", s.handleLogout)
+
+	// portfolios
+	s.handle("GET", "/portfolios", s.auth(s.handleGetPortfolios))
+	s.handle("POST", "/portfolios", s.auth(s.handleCreatePortfolio))
+	s.handle("GET", "/portfolios/{id}", s.auth(s.handleGetPortfolio))
+	s.handle("PUT", "/portfolios/{id}", s.auth(s.handleUpdatePortfolio))
+	s.handle("DELETE", "/portfolios/{id}", s.auth(s.handleDeletePortfolio))
+	s.handle("GET", "/portfolios/{id}/items", s.auth(s.handleGetPortfolioItems))
+	s.handle("GET", "/portfolios/{id}/transactions", s.auth(s.handleGetTransactions))
+	s.handle("POST", "/portfolios/{id}/transactions", s.auth(s.handleAddTransactions))
+	s.handle("POST", "/portfolios/{id}/import", s.auth(s.handleImport))
+	s.handle("DELETE", "/portfolios/{id}/transactions/{tid}", s.auth(s.handleDeleteTransaction))
+
+	// items
+	s.handle("GET", "/items/{id}", s.auth(s.handleGetItem))
+
+	// market and company data
+	s.handle("GET", "/currency/convert", s.auth(s.handleConvert))
+	s.handle("GET", "/quotes/{item}", s.auth(s.handleQuote))
+	s.handle("GET", "/companies/{ticker}", s.auth(s.handleCompany))
+
+	return s
+}
+
+// ListenAndServe serves the API on the address (e.g. ":3434")
+func (s *Server) ListenAndServe(addr string) error {
+	log.Printf("api: listening on %s\n", addr)
+	return http.ListenAndServe(addr, s)
+}
+
+type errorResponse struct {
+	Error string
+}
+
+// writeJSON writes the value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("api: unable to encode response: %s\n", err)
+	}
+}
+
+// writeError writes the error as a JSON response.
+// Missing database rows result in 404 Not Found.
+func writeError(w http.ResponseWriter, status int, err error) {
+	if err == sql.ErrNoRows {
+		status = http.StatusNotFound
+		err = e("not found")
+	}
+	writeJSON(w, status, &errorResponse{err.Error()})
+}
+
+// readJSON decodes the JSON request body to v
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	if err := dec.Decode(v); err != nil {
+		return e("unable to decode request: %s", err)
+	}
+	return nil
+}
+
+// pathID parses the numeric path parameter
+func pathID(ps params, name string) (int64, error) {
+	id, err := strconv.ParseInt(ps[name], 10, 64)
+	if err != nil {
+		return 0, e("invalid %s %q", name, ps[name])
+	}
+	return id, nil
+}
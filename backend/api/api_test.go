@@ -0,0 +1,251 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/k3a/in2tracker/backend/store"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer creates the server allowing registration of test users
+func newTestServer() *Server {
+	s := New(store.NewTest())
+	s.AllowRegistration = true
+	return s
+}
+
+func request(t *testing.T, s *Server, token, method, url string, body []byte, out interface{}) int {
+	req := httptest.NewRequest(method, url, bytes.NewReader(body))
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	if out != nil {
+		require.Nil(t, json.Unmarshal(rec.Body.Bytes(), out), rec.Body.String())
+	}
+	return rec.Code
+}
+
+// login registers the user and returns the session token
+func login(t *testing.T, s *Server, email string) string {
+	body := []byte(`{"Name":"Test","EMail":"` + email + `","Password":"password"}`)
+	code := request(t, s, "", "POST", "/users", body, nil)
+	require.Equal(t, http.StatusCreated, code)
+
+	var res loginResponse
+	code = request(t, s, "", "POST", "/login", body, &res)
+	require.Equal(t, http.StatusOK, code)
+	require.NotEmpty(t, res.Token)
+	return res.Token
+}
+
+func TestPortfolios(t *testing.T) {
+	s := newTestServer()
+	token := login(t, s, "jane@example.com")
+
+	var p model.Portfolio
+	code := request(t, s, token, "POST", "/portfolios", []byte(`{"Name":"fio"}`), &p)
+	require.Equal(t, http.StatusCreated, code)
+	require.Equal(t, "fio", p.Name)
+
+	code = request(t, s, token, "PUT", "/portfolios/1", []byte(`{"Name":"pension"}`), &p)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "pension", p.Name)
+
+	var ps []*model.Portfolio
+	code = request(t, s, token, "GET", "/portfolios", nil, &ps)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, ps, 1)
+	require.Equal(t, "pension", ps[0].Name)
+
+	var errRes errorResponse
+	code = request(t, s, token, "GET", "/portfolios/2", nil, &errRes)
+	require.Equal(t, http.StatusNotFound, code)
+	require.NotEmpty(t, errRes.Error)
+
+	code = request(t, s, token, "GET", "/portfolios/x", nil, &errRes)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// other users can't access the portfolio
+	other := login(t, s, "john@example.com")
+	code = request(t, s, other, "GET", "/portfolios", nil, &ps)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, ps, 0)
+	code = request(t, s, other, "DELETE", "/portfolios/1", nil, nil)
+	require.Equal(t, http.StatusNotFound, code)
+
+	code = request(t, s, token, "DELETE", "/portfolios/1", nil, nil)
+	require.Equal(t, http.StatusNoContent, code)
+
+	code = request(t, s, token, "GET", "/portfolios/1", nil, nil)
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestTransactions(t *testing.T) {
+	s := newTestServer()
+	token := login(t, s, "jane@example.com")
+
+	var p model.Portfolio
+	request(t, s, token, "POST", "/portfolios", []byte(`{"Name":"ibkr"}`), &p)
+
+	// import a statement
+	data, err := os.ReadFile("../importers/importer.us.ibkr.flex_test.xml")
+	require.Nil(t, err)
+
+	var added transactionsAddedResponse
+	code := request(t, s, token, "POST", "/portfolios/1/import", data, &added)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 12, added.Added)
+
+	code = request(t, s, token, "POST", "/portfolios/1/import", data, &added)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 0, added.Added)
+	require.Equal(t, 12, added.Known)
+
+	// add manually
+	manual := []byte(`[{"Time":"2017-03-01T10:00:00Z","Type":"TTBuy","Item":"SWKS",
+		"Quantity":2,"Price":90,"NetTotal":-180,"Currency":"USD"}]`)
+	code = request(t, s, token, "POST", "/portfolios/1/transactions", manual, &added)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 1, added.Added)
+
+	var trs []*model.Transaction
+	code = request(t, s, token, "GET", "/portfolios/1/transactions?item=SWKS&type=TTBuy", nil, &trs)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, trs, 1)
+	require.NotEmpty(t, trs[0].Hash)
+
+	var pis []*model.PortfolioItem
+	code = request(t, s, token, "GET", "/portfolios/1/items", nil, &pis)
+	require.Equal(t, http.StatusOK, code)
+	require.NotEmpty(t, pis)
+
+	var item model.Item
+	code = request(t, s, token, "GET", "/items/SWKS", nil, &item)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "SWKS", item.Code)
+
+	code = request(t, s, token, "DELETE", "/portfolios/1/transactions/999", nil, nil)
+	require.Equal(t, http.StatusNotFound, code)
+
+	code = request(t, s, token, "DELETE", "/portfolios/1/transactions/"+
+		strconv.FormatInt(trs[0].ID, 10), nil, nil)
+	require.Equal(t, http.StatusNoContent, code)
+
+	code = request(t, s, token, "GET", "/portfolios/1/transactions?item=SWKS&from=2017-03-01", nil, &trs)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, trs, 0)
+}
+
+func TestAuth(t *testing.T) {
+	s := newTestServer()
+
+	code := request(t, s, "", "GET", "/portfolios", nil, nil)
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	token := login(t, s, "jane@example.com")
+
+	var u userResponse
+	code = request(t, s, token, "GET", "/users/me", nil, &u)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "jane@example.com", u.EMail)
+
+	// duplicate registration and bad password
+	body := []byte(`{"Name":"Test","EMail":"Jane@example.com","Password":"password"}`)
+	code = request(t, s, "", "POST", "/users", body, nil)
+	require.Equal(t, http.StatusConflict, code)
+
+	body = []byte(`{"EMail":"jane@example.com","Password":"wrong"}`)
+	code = request(t, s, "", "POST", "/login", body, nil)
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	// logout invalidates the token
+	code = request(t, s, token, "POST", "/logout", nil, nil)
+	require.Equal(t, http.StatusNoContent, code)
+	code = request(t, s, token, "GET", "/users/me", nil, nil)
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	s.AllowRegistration = false
+	body = []byte(`{"Name":"Test","EMail":"john@example.com","Password":"password"}`)
+	code = request(t, s, "", "POST", "/users", body, nil)
+	require.Equal(t, http.StatusForbidden, code)
+
+	// unknown e-mail is rejected the same way as a bad password
+	body = []byte(`{"EMail":"john@example.com","Password":"password"}`)
+	code = request(t, s, "", "POST", "/login", body, nil)
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	// registration is disabled by default
+	code = request(t, New(store.NewTest()), "", "POST", "/users", body, nil)
+	require.Equal(t, http.StatusForbidden, code)
+}
+
+// blockingProvider supports any pair and waits for the context to be done
+type blockingProvider struct{}
+
+func (p *blockingProvider) Name() string                             { return "blocking" }
+func (p *blockingProvider) AllowsReverse() bool                      { return false }
+func (p *blockingProvider) Supports(from, to currency.Currency) bool { return true }
+
+func (p *blockingProvider) GetRate(from, to currency.Currency, at time.Time) (float64, error) {
+	return p.GetRateContext(context.Background(), from, to, at)
+}
+
+func (p *blockingProvider) GetRateContext(ctx context.Context, from, to currency.Currency, at time.Time) (float64, error) {
+	rate, _, err := p.GetRateDatedContext(ctx, from, to, at)
+	return rate, err
+}
+
+func (p *blockingProvider) GetRateDatedContext(ctx context.Context, from, to currency.Currency, at time.Time) (float64, time.Time, error) {
+	<-ctx.Done()
+	return 0, at, ctx.Err()
+}
+
+func TestConvertContext(t *testing.T) {
+	s := newTestServer()
+	s.rates = currency.NewCachingConverter(nil, 0)
+	s.rates.Resolver = currency.NewResolver(&blockingProvider{})
+	token := login(t, s, "jane@example.com")
+
+	url := "/currency/convert?amount=1&from=USD&to=CZK&at=2020-03-05"
+
+	// deadline exceeded while fetching the rate
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest("GET", url, nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusGatewayTimeout, rec.Code)
+
+	// client disconnected, nothing written
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	req = httptest.NewRequest("GET", url, nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	require.Empty(t, rec.Body.String())
+}
+
+func TestQuoteUnknownMarket(t *testing.T) {
+	s := newTestServer()
+	token := login(t, s, "jane@example.com")
+
+	code := request(t, s, token, "GET", "/quotes/AAPL?market=NOWHERE", nil, nil)
+	require.Equal(t, http.StatusBadRequest, code)
+}
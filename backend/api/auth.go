@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/model"
+)
+
+// validity of a newly created session
+const sessionDuration = 30 * 24 * time.Hour
+
+// minimal length of a new password
+const minPasswordLength = 8
+
+// unknownUser has a password which is verified on login with an unknown e-mail,
+// so the response time doesn't reveal which e-mails have an account
+var (
+	unknownUser     = new(model.User)
+	unknownUserOnce sync.Once
+)
+
+func initUnknownUser() {
+	password := make([]byte, 32)
+	rand.Read(password)
+	unknownUser.SetPassword(hex.EncodeToString(password))
+}
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+type registerRequest struct {
+	Name     string
+	EMail    string
+	Password string
+}
+
+type loginRequest struct {
+	EMail    string
+	Password string
+}
+
+type loginResponse struct {
+	Token   string
+	Expires time.Time
+	User    *userResponse
+}
+
+type userResponse struct {
+	ID    int64
+	Name  string
+	EMail string
+}
+
+func newUserResponse(u *model.User) *userResponse {
+	return &userResponse{u.ID, u.Name, u.EMail}
+}
+
+// hashToken returns the hex encoded SHA-256 hash of the session token
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// bearerToken returns the token from the Authorization header
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return strings.TrimSpace(auth[len(prefix):])
+	}
+	return ""
+}
+
+// currentUser returns the authenticated user of the request
+func currentUser(r *http.Request) *model.User {
+	u, _ := r.Context().Value(userContextKey).(*model.User)
+	return u
+}
+
+// currentSession returns the session of the request
+func (s *Server) currentSession(r *http.Request) (*model.Session, error) {
+	token := bearerToken(r)
+	if len(token) == 0 {
+		return nil, e("authorization required")
+	}
+
+	sess, err := s.store.GetSessionByTokenHash(hashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, e("invalid or expired session")
+	}
+	return sess, err
+}
+
+// auth wraps the handler so that it is called only for authenticated requests.
+// The user is available to the handler via currentUser.
+func (s *Server) auth(handler handlerFunc) handlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, ps params) {
+		sess, err := s.currentSession(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		u, err := s.store.GetUser(sess.UserID)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, e("invalid session user"))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, u)
+		handler(w, r.WithContext(ctx), ps)
+	}
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request, ps params) {
+	if !s.AllowRegistration {
+		writeError(w, http.StatusForbidden, e("registration is disabled"))
+		return
+	}
+
+	var req registerRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Name) == 0 || !strings.Contains(req.EMail, "@") {
+		writeError(w, http.StatusBadRequest, e("name and valid e-mail are required"))
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		writeError(w, http.StatusBadRequest, e("password must have at least %d characters", minPasswordLength))
+		return
+	}
+
+	if _, err := s.store.GetUserByEMail(req.EMail); err == nil {
+		writeError(w, http.StatusConflict, e("user with the e-mail already exists"))
+		return
+	} else if err != sql.ErrNoRows {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	u := &model.User{
+		Name:  req.Name,
+		EMail: req.EMail,
+	}
+	if err := u.SetPassword(req.Password); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := s.store.CreateUser(u); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newUserResponse(u))
+}
+
+// handleLogin verifies credentials and creates a new session.
+// The returned token is to be sent in the Authorization: Bearer header.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request, ps params) {
+	var req loginRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := s.store.GetUserByEMail(req.EMail)
+	if err != nil && err != sql.ErrNoRows {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err == sql.ErrNoRows {
+		unknownUser.CheckPassword(req.Password)
+		writeError(w, http.StatusUnauthorized, e("invalid e-mail or password"))
+		return
+	}
+	if !u.CheckPassword(req.Password) {
+		writeError(w, http.StatusUnauthorized, e("invalid e-mail or password"))
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	now := time.Now()
+	sess := &model.Session{
+		UserID:    u.ID,
+		TokenHash: hashToken(token),
+		Created:   now,
+		Expires:   now.Add(sessionDuration),
+	}
+	if err := s.store.CreateSession(sess); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	u.LastLoggedIn = now
+	if err := s.store.UpdateUser(u); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// good opportunity to clean up
+	s.store.DeleteExpiredSessions(now)
+
+	writeJSON(w, http.StatusOK, &loginResponse{token, sess.Expires, newUserResponse(u)})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request, ps params) {
+	sess, err := s.currentSession(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	if err := s.store.DeleteSession(sess.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetCurrentUser(w http.ResponseWriter, r *http.Request, ps params) {
+	writeJSON(w, http.StatusOK, newUserResponse(currentUser(r)))
+}
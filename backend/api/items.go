@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// handleGetItem returns the item by its numeric ID, code, ISIN, CUSIP, FIGI or listed ticker
+func (s *Server) handleGetItem(w http.ResponseWriter, r *http.Request, ps params) {
+	ident := ps["id"]
+
+	var err error
+	var res interface{}
+	if id, perr := strconv.ParseInt(ident, 10, 64); perr == nil {
+		res, err = s.store.GetItem(id)
+	} else {
+		res, err = s.store.GetItemByIdentifier(ident)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/companydata"
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/marketdata"
+	"github.com/k3a/in2tracker/backend/model"
+)
+
+type convertResponse struct {
+	Amount    float64
+	From      currency.Currency
+	To        currency.Currency
+	Time      time.Time
+	Converted float64
+	Rate      float64
+	Legs      []currency.ConversionLeg
+}
+
+type companyResponse struct {
+	Ticker          string
+	Name            string
+	Address         *model.Address
+	BusinessSummary string
+	Industry        string
+	Sector          string
+	Markets         []string
+	// Sources maps fields to the providers which supplied them
+	Sources map[companydata.Field]string
+}
+
+// queryTime parses the optional at query parameter (YYYY-MM-DD), defaulting to now
+func queryTime(r *http.Request) (time.Time, error) {
+	at := r.URL.Query().Get("at")
+	if len(at) == 0 {
+		return time.Now(), nil
+	}
+	t, err := time.Parse("2006-01-02", at)
+	if err != nil {
+		return t, e("invalid date %q", at)
+	}
+	return t, nil
+}
+
+// queryMarket returns the market from the optional market query parameter
+func queryMarket(r *http.Request) (*marketdata.Market, error) {
+	ident := r.URL.Query().Get("market")
+	if len(ident) == 0 {
+		return nil, nil
+	}
+	// unknown identifiers map to MarketAny
+	market := marketdata.MarketFromString(ident)
+	if marketdata.MarketEquals(market, marketdata.MarketAny) {
+		return nil, e("unknown market %s", ident)
+	}
+	return market, nil
+}
+
+// writeUpstreamError writes the error of a data provider. Nothing is written
+// if the client disconnected, exceeded deadlines are reported as a gateway timeout.
+func writeUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case r.Context().Err() == context.Canceled:
+		// client disconnected, nobody to respond to
+	case err == context.DeadlineExceeded:
+		writeError(w, http.StatusGatewayTimeout, err)
+	default:
+		writeError(w, http.StatusBadGateway, err)
+	}
+}
+
+// handleConvert converts amount between currencies at the optional date
+func (s *Server) handleConvert(w http.ResponseWriter, r *http.Request, ps params) {
+	q := r.URL.Query()
+
+	amount, err := strconv.ParseFloat(q.Get("amount"), 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, e("invalid amount %q", q.Get("amount")))
+		return
+	}
+	at, err := queryTime(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	res := &convertResponse{
+		Amount: amount,
+		From:   currency.FromString(q.Get("from")),
+		To:     currency.FromString(q.Get("to")),
+		Time:   at,
+	}
+	if len(res.From) == 0 || len(res.To) == 0 {
+		writeError(w, http.StatusBadRequest, e("from and to currencies are required"))
+		return
+	}
+
+	conv, err := s.rates.ConvertDetailedContext(r.Context(), amount, res.From, res.To, at)
+	if err != nil {
+		writeUpstreamError(w, r, err)
+		return
+	}
+	res.Converted = conv.Converted
+	res.Rate = conv.Rate
+	res.Legs = conv.Legs
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleQuote returns market data of the item at the optional date
+func (s *Server) handleQuote(w http.ResponseWriter, r *http.Request, ps params) {
+	market, err := queryMarket(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	at, err := queryTime(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	md, err := marketdata.GetItemMarketDataContext(r.Context(), market, ps["item"], at)
+	if err == marketdata.ErrNotAvailable {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeUpstreamError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, md)
+}
+
+// handleCompany returns company information for the ticker
+func (s *Server) handleCompany(w http.ResponseWriter, r *http.Request, ps params) {
+	market, err := queryMarket(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ticker := ps["ticker"]
+	cd, err := companydata.GetMergedCompanyData(r.Context(), market, ticker)
+	if err == companydata.ErrNotAvailable {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeUpstreamError(w, r, err)
+		return
+	}
+
+	res := &companyResponse{
+		Ticker:          ticker,
+		Name:            cd.GetLongName(),
+		Address:         cd.GetAddress(),
+		BusinessSummary: cd.GetBusinessSummary(),
+		Industry:        cd.GetIndustry(),
+		Sector:          cd.GetSector(),
+		Sources:         cd.Sources,
+	}
+	for _, m := range cd.GetMarkets() {
+		res.Markets = append(res.Markets, m.Code())
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/importers"
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/k3a/in2tracker/backend/store"
+)
+
+type portfolioRequest struct {
+	Name string
+}
+
+type transactionsAddedResponse struct {
+	Added int
+	Known int
+}
+
+// portfolio loads the portfolio of the current user from the {id} path parameter
+// and writes an error if it fails
+func (s *Server) portfolio(w http.ResponseWriter, r *http.Request, ps params) *model.Portfolio {
+	id, err := pathID(ps, "id")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil
+	}
+
+	p, err := s.store.GetPortfolio(currentUser(r).ID, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil
+	}
+
+	return p
+}
+
+func (s *Server) handleGetPortfolios(w http.ResponseWriter, r *http.Request, ps params) {
+	portfolios, err := s.store.GetPortfolios(currentUser(r).ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if portfolios == nil {
+		portfolios = []*model.Portfolio{}
+	}
+	writeJSON(w, http.StatusOK, portfolios)
+}
+
+func (s *Server) handleCreatePortfolio(w http.ResponseWriter, r *http.Request, ps params) {
+	var req portfolioRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Name) == 0 {
+		writeError(w, http.StatusBadRequest, e("portfolio name is required"))
+		return
+	}
+
+	p := &model.Portfolio{
+		OwnerID: currentUser(r).ID,
+		Name:    req.Name,
+	}
+	if err := s.store.CreatePortfolio(p); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (s *Server) handleGetPortfolio(w http.ResponseWriter, r *http.Request, ps params) {
+	if p := s.portfolio(w, r, ps); p != nil {
+		writeJSON(w, http.StatusOK, p)
+	}
+}
+
+func (s *Server) handleUpdatePortfolio(w http.ResponseWriter, r *http.Request, ps params) {
+	p := s.portfolio(w, r, ps)
+	if p == nil {
+		return
+	}
+
+	var req portfolioRequest
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Name) == 0 {
+		writeError(w, http.StatusBadRequest, e("portfolio name is required"))
+		return
+	}
+
+	p.Name = req.Name
+	if err := s.store.UpdatePortfolio(p); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Server) handleDeletePortfolio(w http.ResponseWriter, r *http.Request, ps params) {
+	p := s.portfolio(w, r, ps)
+	if p == nil {
+		return
+	}
+
+	if err := s.store.DeletePortfolio(p.OwnerID, p.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetPortfolioItems(w http.ResponseWriter, r *http.Request, ps params) {
+	p := s.portfolio(w, r, ps)
+	if p == nil {
+		return
+	}
+
+	pis, err := s.store.GetPortfolioItems(p.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if pis == nil {
+		pis = []*model.PortfolioItem{}
+	}
+	writeJSON(w, http.StatusOK, pis)
+}
+
+// handleGetTransactions returns transactions of the portfolio, optionally filtered
+// by item, type (can be repeated) and from/to dates (YYYY-MM-DD, to is exclusive)
+func (s *Server) handleGetTransactions(w http.ResponseWriter, r *http.Request, ps params) {
+	p := s.portfolio(w, r, ps)
+	if p == nil {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := &store.TransactionFilter{
+		PortfolioID: p.ID,
+		Item:        q.Get("item"),
+		Types:       q["type"],
+	}
+
+	var err error
+	if from := q.Get("from"); len(from) > 0 {
+		if filter.From, err = time.Parse("2006-01-02", from); err != nil {
+			writeError(w, http.StatusBadRequest, e("invalid from date %q", from))
+			return
+		}
+	}
+	if to := q.Get("to"); len(to) > 0 {
+		if filter.To, err = time.Parse("2006-01-02", to); err != nil {
+			writeError(w, http.StatusBadRequest, e("invalid to date %q", to))
+			return
+		}
+	}
+
+	trs, err := s.store.FindTransactions(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if trs == nil {
+		trs = []*model.Transaction{}
+	}
+	writeJSON(w, http.StatusOK, trs)
+}
+
+// saveTransactions stores transactions to the portfolio and writes the response
+func (s *Server) saveTransactions(w http.ResponseWriter, p *model.Portfolio, trs []*importers.Transaction) {
+	var models []*model.Transaction
+	for _, t := range trs {
+		models = append(models, t.Model(p.ID))
+	}
+
+	added, err := s.store.SaveTransactions(models)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &transactionsAddedResponse{added, len(models) - added})
+}
+
+// handleAddTransactions stores a JSON array of transactions to the portfolio.
+// Transactions already stored are skipped.
+func (s *Server) handleAddTransactions(w http.ResponseWriter, r *http.Request, ps params) {
+	p := s.portfolio(w, r, ps)
+	if p == nil {
+		return
+	}
+
+	var models []*model.Transaction
+	if err := readJSON(r, &models); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// normalize using the importer transaction, which also computes the hash
+	var trs []*importers.Transaction
+	for _, mt := range models {
+		if len(mt.Type) == 0 || mt.Time.IsZero() {
+			writeError(w, http.StatusBadRequest, e("transaction type and time are required"))
+			return
+		}
+		mt.Hash = "" // computed from the transaction, not trusted from the client
+		trs = append(trs, importers.TransactionFromModel(mt))
+	}
+
+	s.saveTransactions(w, p, trs)
+}
+
+// handleImport imports a broker statement sent as the request body.
+// The format is detected automatically unless the format query parameter is specified.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request, ps params) {
+	p := s.portfolio(w, r, ps)
+	if p == nil {
+		return
+	}
+
+	var rd io.Reader = http.MaxBytesReader(w, r.Body, maxBodySize)
+	var imp importers.Importer
+	if format := r.URL.Query().Get("format"); len(format) > 0 {
+		if imp = importers.FromName(format); imp == nil {
+			writeError(w, http.StatusBadRequest, e("unknown format %s", format))
+			return
+		}
+	} else {
+		var err error
+		if imp, rd, err = importers.Detect(rd); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	trs, err := imp.Import(rd)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.saveTransactions(w, p, trs)
+}
+
+func (s *Server) handleDeleteTransaction(w http.ResponseWriter, r *http.Request, ps params) {
+	p := s.portfolio(w, r, ps)
+	if p == nil {
+		return
+	}
+
+	tid, err := pathID(ps, "tid")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tr, err := s.store.GetTransaction(tid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if tr.PortfolioID != p.ID {
+		writeError(w, http.StatusNotFound, e("not found"))
+		return
+	}
+
+	if err := s.store.DeleteTransaction(tid); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// params holds values of the {name} path segments of the matched route
+type params map[string]string
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request, ps params)
+
+type route struct {
+	method  string
+	parts   []string
+	handler handlerFunc
+}
+
+// router is a minimal method and path router supporting {name} path segments
+type router struct {
+	routes []*route
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// handle registers the handler for the method and pattern (e.g. /portfolios/{id})
+func (rt *router) handle(method, pattern string, handler handlerFunc) {
+	rt.routes = append(rt.routes, &route{method, splitPath(pattern), handler})
+}
+
+// match returns path parameters if the path matches the route
+func (ro *route) match(parts []string) (params, bool) {
+	if len(parts) != len(ro.parts) {
+		return nil, false
+	}
+
+	ps := make(params)
+	for i, part := range ro.parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			ps[part[1:len(part)-1]] = parts[i]
+		} else if part != parts[i] {
+			return nil, false
+		}
+	}
+	return ps, true
+}
+
+// ServeHTTP implements http.Handler
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path)
+
+	pathFound := false
+	for _, ro := range rt.routes {
+		ps, ok := ro.match(parts)
+		if !ok {
+			continue
+		}
+		pathFound = true
+		if ro.method == r.Method {
+			ro.handler(w, r, ps)
+			return
+		}
+	}
+
+	if pathFound {
+		writeError(w, http.StatusMethodNotAllowed, e("method %s not allowed", r.Method))
+	} else {
+		writeError(w, http.StatusNotFound, e("not found"))
+	}
+}
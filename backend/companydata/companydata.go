@@ -1,13 +1,68 @@
 package companydata
 
-import "github.com/k3a/in2tracker/backend/marketdata"
+import (
+	"context"
 
-// GetCompanyData returns company data using the first working provider
-func GetCompanyData(mkt *marketdata.Market, ticker string) (data CompanyData, err error) {
-	for _, p := range Providers {
-		if data, err = p.GetCompanyData(mkt, ticker); err != nil {
-			return
+	"github.com/k3a/in2tracker/backend/marketdata"
+)
+
+// GetCompanyData returns company data merged from all providers (see GetMergedCompanyData)
+func GetCompanyData(mkt *marketdata.Market, ticker string) (CompanyData, error) {
+	return GetCompanyDataContext(context.Background(), mkt, ticker)
+}
+
+// GetCompanyDataContext returns company data like GetCompanyData.
+// Fetching data stops when ctx is canceled or its deadline is exceeded.
+func GetCompanyDataContext(ctx context.Context, mkt *marketdata.Market, ticker string) (CompanyData, error) {
+	data, err := GetMergedCompanyData(ctx, mkt, ticker)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// GetMergedCompanyData asks providers in their order and fills fields missing
+// from one provider from the next ones, recording the source of each field.
+// Providers failing are skipped. Returns the error of the last failing provider
+// (or ErrNotAvailable) if no provider returned any data.
+func GetMergedCompanyData(ctx context.Context, mkt *marketdata.Market, ticker string) (*MergedData, error) {
+	return mergeCompanyData(ctx, Providers, mkt, ticker)
+}
+
+func mergeCompanyData(ctx context.Context, providers []Provider, mkt *marketdata.Market, ticker string) (*MergedData, error) {
+	merged := NewMergedData()
+	found := false
+	err := ErrNotAvailable
+
+	for _, p := range providers {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var data CompanyData
+		var pErr error
+		if cp, ok := p.(ContextProvider); ok {
+			data, pErr = cp.GetCompanyDataContext(ctx, mkt, ticker)
+		} else {
+			data, pErr = p.GetCompanyData(mkt, ticker)
+		}
+		if pErr != nil {
+			err = pErr
+			continue
+		}
+
+		found = true
+		merged.Merge(data, p.Name())
+		if merged.Complete() {
+			break
+		}
+	}
+
+	if !found {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
+		return nil, err
 	}
-	return
+	return merged, nil
 }
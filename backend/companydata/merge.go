@@ -0,0 +1,192 @@
+package companydata
+
+import (
+	"github.com/k3a/in2tracker/backend/marketdata"
+	"github.com/k3a/in2tracker/backend/model"
+)
+
+// Field identifies a piece of company data
+type Field string
+
+// Company data fields
+const (
+	FieldLongName        Field = "LongName"
+	FieldBusinessSummary Field = "BusinessSummary"
+	FieldIndustry        Field = "Industry"
+	FieldSector          Field = "Sector"
+	FieldAddress         Field = "Address"
+	FieldCity            Field = "City"
+	FieldState           Field = "State"
+	FieldZip             Field = "Zip"
+	FieldCountry         Field = "Country"
+	FieldMarkets         Field = "Markets"
+	FieldWebsite         Field = "Website"
+	FieldEmployees       Field = "Employees"
+	FieldOfficers        Field = "Officers"
+)
+
+// Fields lists all company data fields
+var Fields = []Field{FieldLongName, FieldBusinessSummary, FieldIndustry, FieldSector,
+	FieldAddress, FieldCity, FieldState, FieldZip, FieldCountry, FieldMarkets,
+	FieldWebsite, FieldEmployees, FieldOfficers}
+
+// MergedData is company data merged from several providers. Each field
+// comes from the first provider which supplied it, the address comes as a whole
+// from the first provider which supplied it including the country.
+type MergedData struct {
+	LongName        string
+	BusinessSummary string
+	Industry        string
+	Sector          string
+	Address         model.Address
+	Markets         []*marketdata.Market
+	Website         string
+	Employees       int
+	Officers        []model.CompanyOfficer
+
+	// Sources maps fields to the names of the providers which supplied them
+	Sources map[Field]string
+}
+
+// NewMergedData creates empty merged data
+func NewMergedData() *MergedData {
+	return &MergedData{Sources: make(map[Field]string)}
+}
+
+// GetAddress returns the company address
+func (md *MergedData) GetAddress() *model.Address {
+	return &md.Address
+}
+
+// GetBusinessSummary returns the description of the company business
+func (md *MergedData) GetBusinessSummary() string {
+	return md.BusinessSummary
+}
+
+// GetIndustry returns the industry of the company
+func (md *MergedData) GetIndustry() string {
+	return md.Industry
+}
+
+// GetSector returns the sector of the company
+func (md *MergedData) GetSector() string {
+	return md.Sector
+}
+
+// GetLongName returns the full company name
+func (md *MergedData) GetLongName() string {
+	return md.LongName
+}
+
+// GetMarkets returns the markets the company is listed at
+func (md *MergedData) GetMarkets() []*marketdata.Market {
+	return md.Markets
+}
+
+// GetWebsite returns the company website
+func (md *MergedData) GetWebsite() string {
+	return md.Website
+}
+
+// GetEmployees returns the number of full-time employees
+func (md *MergedData) GetEmployees() int {
+	return md.Employees
+}
+
+// GetOfficers returns the company executives
+func (md *MergedData) GetOfficers() []model.CompanyOfficer {
+	return md.Officers
+}
+
+// Source returns the name of the provider which supplied the field
+// or an empty string if the field is not known
+func (md *MergedData) Source(field Field) string {
+	return md.Sources[field]
+}
+
+// Complete returns true if all fields are known (the address just needs the country)
+func (md *MergedData) Complete() bool {
+	for _, field := range Fields {
+		if _, has := md.Sources[field]; !has && !isAddressField(field) {
+			return false
+		}
+	}
+	return len(md.Address.Country) > 0
+}
+
+// Merge fills fields still missing from data supplied by the named source
+func (md *MergedData) Merge(data CompanyData, source string) {
+	mergeString(md, FieldLongName, &md.LongName, data.GetLongName(), source)
+	mergeString(md, FieldBusinessSummary, &md.BusinessSummary, data.GetBusinessSummary(), source)
+	mergeString(md, FieldIndustry, &md.Industry, data.GetIndustry(), source)
+	mergeString(md, FieldSector, &md.Sector, data.GetSector(), source)
+
+	if addr := data.GetAddress(); addr != nil {
+		md.mergeAddress(*addr, source)
+	}
+
+	if markets := data.GetMarkets(); len(md.Markets) == 0 && len(markets) > 0 {
+		md.Markets = markets
+		md.Sources[FieldMarkets] = source
+	}
+
+	mergeString(md, FieldWebsite, &md.Website, data.GetWebsite(), source)
+
+	if employees := data.GetEmployees(); md.Employees == 0 && employees > 0 {
+		md.Employees = employees
+		md.Sources[FieldEmployees] = source
+	}
+
+	if officers := data.GetOfficers(); len(md.Officers) == 0 && len(officers) > 0 {
+		md.Officers = officers
+		md.Sources[FieldOfficers] = source
+	}
+}
+
+// mergeAddress takes the whole address from the source if no address is known yet
+// or the known one lacks the country supplied by the source, so the address parts
+// never come from different sources
+func (md *MergedData) mergeAddress(addr model.Address, source string) {
+	if addr == (model.Address{}) {
+		return
+	}
+	if md.Address != (model.Address{}) && (len(md.Address.Country) > 0 || len(addr.Country) == 0) {
+		return
+	}
+
+	md.Address = addr
+	for _, part := range []struct {
+		field Field
+		value string
+	}{
+		{FieldAddress, addr.Address},
+		{FieldCity, addr.City},
+		{FieldState, addr.State},
+		{FieldZip, addr.Zip},
+		{FieldCountry, addr.Country},
+	} {
+		if len(part.value) > 0 {
+			md.Sources[part.field] = source
+		} else {
+			delete(md.Sources, part.field)
+		}
+	}
+}
+
+// isAddressField returns true for the fields being parts of the address
+func isAddressField(field Field) bool {
+	switch field {
+	case FieldAddress, FieldCity, FieldState, FieldZip, FieldCountry:
+		return true
+	}
+	return false
+}
+
+// mergeString sets the field value if not set yet and records its source
+func mergeString(md *MergedData, field Field, dst *string, value string, source string) {
+	if len(*dst) > 0 || len(value) == 0 {
+		return
+	}
+	*dst = value
+	md.Sources[field] = source
+}
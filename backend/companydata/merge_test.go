@@ -0,0 +1,90 @@
+package companydata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/k3a/in2tracker/backend/marketdata"
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/stretchr/testify/require"
+)
+
+// testProvider returns fixed data or an error
+type testProvider struct {
+	name  string
+	data  *MergedData
+	err   error
+	calls int
+}
+
+func (p *testProvider) Name() string { return p.name }
+
+func (p *testProvider) GetCompanyData(mkt *marketdata.Market, ticker string) (CompanyData, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.data, nil
+}
+
+func TestMergeCompanyData(t *testing.T) {
+	failing := &testProvider{name: "failing", err: e("connection refused")}
+	partial := &testProvider{name: "partial", data: &MergedData{
+		LongName: "Apple Inc.",
+		Address:  model.Address{Address: "1 Infinite Loop", City: "Cupertino"},
+	}}
+	full := &testProvider{name: "full", data: &MergedData{
+		LongName:        "Apple",
+		BusinessSummary: "Phones",
+		Industry:        "Consumer Electronics",
+		Sector:          "Technology",
+		Address:         model.Address{Address: "One Apple Park Way", City: "Cupertino", State: "CA", Zip: "95014", Country: "United States"},
+		Markets:         []*marketdata.Market{marketdata.MarketUSANasdaq},
+		Website:         "https://www.apple.com",
+		Employees:       137000,
+		Officers:        []model.CompanyOfficer{{Name: "Mr. Timothy D. Cook", Title: "CEO"}},
+	}}
+	unused := &testProvider{name: "unused", data: full.data}
+
+	md, err := mergeCompanyData(context.Background(), []Provider{failing, partial, full, unused}, nil, "AAPL")
+	require.Nil(t, err)
+
+	require.Equal(t, "Apple Inc.", md.GetLongName())
+	require.Equal(t, "Technology", md.GetSector())
+	require.Equal(t, "Consumer Electronics", md.GetIndustry())
+
+	// the address comes as a whole from the source knowing the country
+	require.Equal(t, "One Apple Park Way, Cupertino, CA 95014, United States", md.GetAddress().String())
+	require.Equal(t, "full", md.Source(FieldAddress))
+	require.Equal(t, "full", md.Source(FieldCountry))
+
+	require.Equal(t, "partial", md.Source(FieldLongName))
+	require.Equal(t, "full", md.Source(FieldSector))
+	require.True(t, md.Complete())
+	require.Equal(t, 0, unused.calls)
+
+	// missing fields have no source
+	md, err = mergeCompanyData(context.Background(), []Provider{partial}, nil, "AAPL")
+	require.Nil(t, err)
+	require.Empty(t, md.Source(FieldCountry))
+	require.Equal(t, "partial", md.Source(FieldAddress))
+	require.False(t, md.Complete())
+
+	// the address without the country is replaced as a whole
+	md, err = mergeCompanyData(context.Background(), []Provider{&testProvider{name: "street",
+		data: &MergedData{Address: model.Address{Address: "1 Infinite Loop"}}}, full, partial}, nil, "AAPL")
+	require.Nil(t, err)
+	require.Equal(t, "One Apple Park Way, Cupertino, CA 95014, United States", md.GetAddress().String())
+	require.Equal(t, "full", md.Source(FieldAddress))
+
+	// no data at all
+	_, err = mergeCompanyData(context.Background(), []Provider{failing}, nil, "AAPL")
+	require.Equal(t, failing.err, err)
+	_, err = mergeCompanyData(context.Background(), nil, nil, "AAPL")
+	require.Equal(t, ErrNotAvailable, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = mergeCompanyData(ctx, []Provider{partial}, nil, "AAPL")
+	require.Equal(t, context.Canceled, err)
+}
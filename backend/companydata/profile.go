@@ -0,0 +1,116 @@
+package companydata
+
+import (
+	"context"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/marketdata"
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/lunny/log"
+)
+
+// DefaultProfileMaxAge is the default age after which stored company profiles are refreshed
+const DefaultProfileMaxAge = 90 * 24 * time.Hour
+
+// ProfileStore stores company profiles persistently (implemented by the store)
+type ProfileStore interface {
+	// GetCompanyProfile returns the stored profile or an error if not known
+	GetCompanyProfile(code string) (*model.CompanyProfile, error)
+	// StoreCompanyProfile creates or replaces the profile of the company
+	StoreCompanyProfile(profile *model.CompanyProfile) error
+}
+
+// ProfileCache returns stored company profiles, fetching missing and stale ones
+// from the providers (see GetMergedCompanyData)
+type ProfileCache struct {
+	// MaxAge is the age after which stored profiles are refreshed.
+	// Stored profiles never expire if zero or negative.
+	MaxAge time.Duration
+	// Now returns the current time (replaceable in tests)
+	Now func() time.Time
+
+	store ProfileStore
+	// fetch gets the company data (GetMergedCompanyData by default)
+	fetch func(ctx context.Context, mkt *marketdata.Market, ticker string) (*MergedData, error)
+}
+
+// NewProfileCache creates a profile cache refreshing profiles older than maxAge
+func NewProfileCache(store ProfileStore, maxAge time.Duration) *ProfileCache {
+	return &ProfileCache{
+		MaxAge: maxAge,
+		Now:    time.Now,
+		store:  store,
+		fetch:  GetMergedCompanyData,
+	}
+}
+
+// Stale returns true if the profile should be refreshed
+func (pc *ProfileCache) Stale(profile *model.CompanyProfile) bool {
+	return pc.MaxAge > 0 && pc.Now().Sub(profile.Fetched) > pc.MaxAge
+}
+
+// Stored returns the stored profile of the company regardless of its age
+// (for offline use). Returns ErrNotAvailable if not stored.
+func (pc *ProfileCache) Stored(ticker string) (*model.CompanyProfile, error) {
+	profile, err := pc.store.GetCompanyProfile(ticker)
+	if err != nil {
+		return nil, ErrNotAvailable
+	}
+	return profile, nil
+}
+
+// Get returns the profile of the company. Missing and stale profiles are fetched
+// and stored. The stale profile is returned if it cannot be refreshed.
+func (pc *ProfileCache) Get(ctx context.Context, mkt *marketdata.Market, ticker string) (*model.CompanyProfile, error) {
+	stored, err := pc.store.GetCompanyProfile(ticker)
+	if err != nil {
+		stored = nil
+	}
+	if stored != nil && !pc.Stale(stored) {
+		return stored, nil
+	}
+
+	data, err := pc.fetch(ctx, mkt, ticker)
+	if err != nil {
+		if stored != nil && ctx.Err() == nil {
+			log.Warnf("companydata: unable to refresh profile of %s, using the one from %s: %v",
+				ticker, stored.Fetched.Format("2006-01-02"), err)
+			return stored, nil
+		}
+		return nil, err
+	}
+
+	profile := NewProfile(ticker, data, pc.Now())
+	if stored != nil {
+		profile.ID = stored.ID
+	}
+	if err := pc.store.StoreCompanyProfile(profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// NewProfile creates the company profile from the merged data
+func NewProfile(ticker string, data *MergedData, fetched time.Time) *model.CompanyProfile {
+	profile := &model.CompanyProfile{
+		Code:            ticker,
+		Name:            data.LongName,
+		Sector:          data.Sector,
+		Industry:        data.Industry,
+		BusinessSummary: data.BusinessSummary,
+		Address:         data.Address.Address,
+		City:            data.Address.City,
+		State:           data.Address.State,
+		Zip:             data.Address.Zip,
+		Country:         data.Address.Country,
+		Website:         data.Website,
+		Employees:       data.Employees,
+		Officers:        data.Officers,
+		Sources:         make(map[string]string),
+		Fetched:         fetched,
+	}
+	for field, source := range data.Sources {
+		profile.Sources[string(field)] = source
+	}
+	return profile
+}
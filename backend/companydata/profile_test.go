@@ -0,0 +1,86 @@
+package companydata
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/marketdata"
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/stretchr/testify/require"
+)
+
+// testProfileStore stores profiles in memory
+type testProfileStore map[string]*model.CompanyProfile
+
+func (s testProfileStore) GetCompanyProfile(code string) (*model.CompanyProfile, error) {
+	if p, has := s[code]; has {
+		return p, nil
+	}
+	return nil, ErrNotAvailable
+}
+
+func (s testProfileStore) StoreCompanyProfile(profile *model.CompanyProfile) error {
+	s[profile.Code] = profile
+	return nil
+}
+
+func TestProfileCache(t *testing.T) {
+	now := time.Date(2020, 3, 5, 12, 0, 0, 0, time.UTC)
+	store := make(testProfileStore)
+
+	prov := &testProvider{name: "test", data: &MergedData{
+		LongName: "Apple Inc.",
+		Sector:   "Technology",
+		Address:  model.Address{Country: "United States"},
+	}}
+
+	pc := NewProfileCache(store, 30*24*time.Hour)
+	pc.Now = func() time.Time { return now }
+	pc.fetch = func(ctx context.Context, mkt *marketdata.Market, ticker string) (*MergedData, error) {
+		return mergeCompanyData(ctx, []Provider{prov}, mkt, ticker)
+	}
+
+	_, err := pc.Stored("AAPL")
+	require.Equal(t, ErrNotAvailable, err)
+
+	// fetched and stored
+	profile, err := pc.Get(context.Background(), nil, "AAPL")
+	require.Nil(t, err)
+	require.Equal(t, "Technology", profile.Sector)
+	require.Equal(t, "test", profile.Sources[string(FieldCountry)])
+	require.Equal(t, now, profile.Fetched)
+	require.Equal(t, 1, prov.calls)
+
+	// fresh profile is not refreshed
+	now = now.AddDate(0, 0, 10)
+	_, err = pc.Get(context.Background(), nil, "AAPL")
+	require.Nil(t, err)
+	require.Equal(t, 1, prov.calls)
+
+	// stale profile is refreshed
+	now = now.AddDate(0, 0, 30)
+	prov.data.Sector = "Information Technology"
+	profile, err = pc.Get(context.Background(), nil, "AAPL")
+	require.Nil(t, err)
+	require.Equal(t, 2, prov.calls)
+	require.Equal(t, "Information Technology", profile.Sector)
+	require.Equal(t, now, store["AAPL"].Fetched)
+
+	// stale profile is used if it cannot be refreshed
+	now = now.AddDate(0, 0, 60)
+	prov.err = e("connection refused")
+	profile, err = pc.Get(context.Background(), nil, "AAPL")
+	require.Nil(t, err)
+	require.Equal(t, "Information Technology", profile.Sector)
+
+	_, err = pc.Get(context.Background(), nil, "MSFT")
+	require.Equal(t, prov.err, err)
+
+	// never refreshed without MaxAge
+	pc.MaxAge = 0
+	calls := prov.calls
+	_, err = pc.Get(context.Background(), nil, "AAPL")
+	require.Nil(t, err)
+	require.Equal(t, calls, prov.calls)
+}
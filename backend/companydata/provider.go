@@ -1,6 +1,7 @@
 package companydata
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -26,13 +27,26 @@ type CompanyData interface {
 	GetSector() string
 	GetLongName() string
 	GetMarkets() []*marketdata.Market
+	GetWebsite() string
+	GetEmployees() int
+	GetOfficers() []model.CompanyOfficer
 }
 
 // Provider is common interface for all company data providers
 type Provider interface {
+	// Name returns the name of the provider (recorded as the source of the data)
+	Name() string
+	// GetCompanyData returns data about the company. Fields not known
+	// by the provider are left empty.
 	GetCompanyData(mkt *marketdata.Market, ticker string) (CompanyData, error)
 }
 
+// ContextProvider is a Provider able to stop fetching data when the context
+// is canceled or its deadline is exceeded
+type ContextProvider interface {
+	GetCompanyDataContext(ctx context.Context, mkt *marketdata.Market, ticker string) (CompanyData, error)
+}
+
 // Providers holds all available currency rate providers
 var Providers []Provider
 
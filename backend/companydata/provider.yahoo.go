@@ -1,6 +1,7 @@
 package companydata
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -104,14 +105,38 @@ func (yd *yahooData) GetMarkets() []*marketdata.Market {
 	// TODO: get markets the company is listed at
 	return nil
 }
+func (yd *yahooData) GetWebsite() string {
+	return yd.QuoteSummary.Result[0].AssetProfile.Website
+}
+func (yd *yahooData) GetEmployees() int {
+	return yd.QuoteSummary.Result[0].AssetProfile.FullTimeEmployees
+}
+func (yd *yahooData) GetOfficers() []model.CompanyOfficer {
+	var officers []model.CompanyOfficer
+	for _, o := range yd.QuoteSummary.Result[0].AssetProfile.CompanyOfficers {
+		officers = append(officers, model.CompanyOfficer{
+			Name:       o.Name,
+			Title:      o.Title,
+			Age:        o.Age,
+			FiscalYear: o.FiscalYear,
+			TotalPay:   int64(o.TotalPay.Raw),
+		})
+	}
+	return officers
+}
 
 // YahooProvider is yahoo.com provider
 type YahooProvider struct {
 	httpClient *http.Client
 }
 
+// Name returns the name of the provider
+func (yp *YahooProvider) Name() string {
+	return "Yahoo"
+}
+
 // tryFindMarket tries to find the most relevant market for ticker or nil if not known by Yahoo
-func (yp *YahooProvider) tryFindMarket(ticker string) *marketdata.Market {
+func (yp *YahooProvider) tryFindMarket(ctx context.Context, ticker string) *marketdata.Market {
 	switch ticker {
 	case "VOW3":
 		return marketdata.MarketsEuropeFrankfurtXETRA
@@ -126,7 +151,7 @@ func (yp *YahooProvider) tryFindMarket(ticker string) *marketdata.Market {
 		return nil
 	}
 
-	resp, err := yp.httpClient.Do(req)
+	resp, err := yp.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil
 	}
@@ -161,8 +186,13 @@ func (yp *YahooProvider) tryFindMarket(ticker string) *marketdata.Market {
 
 // GetCompanyData return info about the company
 func (yp *YahooProvider) GetCompanyData(market *marketdata.Market, ticker string) (CompanyData, error) {
+	return yp.GetCompanyDataContext(context.Background(), market, ticker)
+}
+
+// GetCompanyDataContext returns info about the company like GetCompanyData, stopping when ctx is done
+func (yp *YahooProvider) GetCompanyDataContext(ctx context.Context, market *marketdata.Market, ticker string) (CompanyData, error) {
 	if marketdata.MarketEquals(market, marketdata.MarketAny) {
-		market = yp.tryFindMarket(ticker)
+		market = yp.tryFindMarket(ctx, ticker)
 	}
 
 	if !marketdata.MarketEquals(market, marketdata.MarketAny) {
@@ -182,7 +212,7 @@ func (yp *YahooProvider) GetCompanyData(market *marketdata.Market, ticker string
 		return nil, ErrNotAvailable
 	}
 
-	resp, err := yp.httpClient.Do(req)
+	resp, err := yp.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
 		log.Warnf("yahoo: problem fetching data for %s: %v\n", ticker, err)
 		return nil, ErrNotAvailable
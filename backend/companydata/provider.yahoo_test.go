@@ -1,6 +1,7 @@
 package companydata
 
 import (
+	"context"
 	"testing"
 
 	"github.com/k3a/in2tracker/backend/marketdata"
@@ -21,7 +22,7 @@ func TestYahoo(t *testing.T) {
 func TestYahooFindMarket(t *testing.T) {
 	p := NewYahooProvider()
 
-	mkt := p.tryFindMarket("LHA")
+	mkt := p.tryFindMarket(context.Background(), "LHA")
 	if !marketdata.MarketEquals(mkt, marketdata.MarketsEuropeFrankfurtXETRA) {
 		t.Fatalf("wrong market %s reported instad of %s", mkt, marketdata.MarketsEuropeFrankfurtXETRA)
 	}
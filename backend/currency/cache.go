@@ -0,0 +1,369 @@
+package currency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lunny/log"
+)
+
+// DefaultCacheSize is the default number of rates kept in memory by CachingConverter
+const DefaultCacheSize = 4096
+
+// DefaultNegativeTTL is the default time failed conversions are remembered
+const DefaultNegativeTTL = 10 * time.Minute
+
+// CacheProviderName is the provider name reported for rates served from the cache
+const CacheProviderName = "cache"
+
+// RateCache stores conversion rates (multipliers) persistently (implemented by the store)
+type RateCache interface {
+	// GetCurrencyMultiplier returns the stored multiplier or an error if not known
+	GetCurrencyMultiplier(date time.Time, from Currency, to Currency) (float64, error)
+	// StoreCurrencyMultiplier stores the multiplier
+	StoreCurrencyMultiplier(date time.Time, from Currency, to Currency, mult float64) error
+}
+
+// DatedRateCache is a RateCache storing also the effective date of the rates
+// (the date the rate has been published for)
+type DatedRateCache interface {
+	RateCache
+	// GetCurrencyRate returns the stored multiplier and its effective date (zero if unknown)
+	GetCurrencyRate(date time.Time, from Currency, to Currency) (float64, time.Time, error)
+	// StoreCurrencyRate stores the multiplier and its effective date, replacing a stored one
+	StoreCurrencyRate(date time.Time, from Currency, to Currency, mult float64, rateDate time.Time) error
+}
+
+type cacheKey struct {
+	date     time.Time
+	from, to Currency
+	policy   FallbackPolicy
+}
+
+type cacheEntry struct {
+	key      cacheKey
+	rate     float64
+	rateDate time.Time
+	// err is set for negative entries which expire
+	err     error
+	expires time.Time
+}
+
+// CachingConverter converts currencies using Convert, caching daily rates in memory (LRU),
+// in an optional persistent RateCache and remembering unavailable rates for NegativeTTL
+type CachingConverter struct {
+	// NegativeTTL is the time unavailable rates are not retried
+	NegativeTTL time.Duration
+	// Resolver converts rates not cached (DefaultResolver if nil)
+	Resolver *Resolver
+
+	cache RateCache
+	size  int
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+}
+
+// NewCachingConverter creates a new caching converter keeping size rates in memory.
+// The cache can be nil for in-memory caching only.
+func NewCachingConverter(cache RateCache, size int) *CachingConverter {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &CachingConverter{
+		NegativeTTL: DefaultNegativeTTL,
+		cache:       cache,
+		size:        size,
+		entries:     make(map[cacheKey]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// RateDay returns the day (UTC midnight of the calendar day) under which rates are cached
+func RateDay(at time.Time) time.Time {
+	y, m, d := at.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Convert converts currency according to rates known for the specified day
+func (cc *CachingConverter) Convert(amount float64, from Currency, to Currency, at time.Time) (float64, error) {
+	return cc.ConvertContext(context.Background(), amount, from, to, at)
+}
+
+// ConvertDetailed converts currency like ConvertDetailed. Rates served from the cache
+// are reported as a single leg provided by CacheProviderName.
+func (cc *CachingConverter) ConvertDetailed(amount float64, from Currency, to Currency, at time.Time) (*Conversion, error) {
+	return cc.ConvertDetailedContext(context.Background(), amount, from, to, at)
+}
+
+// ConvertContext converts currency like Convert. Fetching rates not cached
+// stops when ctx is canceled or its deadline is exceeded.
+func (cc *CachingConverter) ConvertContext(ctx context.Context, amount float64, from Currency, to Currency, at time.Time) (float64, error) {
+	conv, err := cc.ConvertDetailedContext(ctx, amount, from, to, at)
+	if err != nil {
+		return 0, err
+	}
+	return conv.Converted, nil
+}
+
+// ConvertDetailedContext converts currency like ConvertDetailed, stopping when ctx is done.
+// Just conversions failed with ErrNotAvailable are remembered as failed, other errors
+// (e.g. network ones or interrupted by ctx) are retried. Like in Prefetch, rates which
+// can still change are cached just in memory. Rates failed to be stored in the persistent
+// cache are still returned.
+func (cc *CachingConverter) ConvertDetailedContext(ctx context.Context, amount float64, from Currency, to Currency, at time.Time) (*Conversion, error) {
+	if from == to {
+		return cc.resolver().ConvertDetailedContext(ctx, amount, from, to, at)
+	}
+
+	resolver := cc.resolver()
+	key := cacheKey{RateDay(at), from, to, resolver.policy()}
+
+	// memory
+	if entry := cc.get(key); entry != nil {
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		return cachedConversion(amount, from, to, at, entry.rate, entry.rateDate), nil
+	}
+
+	// persistent cache, direct or reverse
+	if cc.cache != nil {
+		rate, rateDate, err := cc.getStored(key.date, from, to)
+		if err != nil {
+			rate, rateDate, err = cc.getStored(key.date, to, from)
+			if err == nil && rate != 0 {
+				rate = 1.0 / rate
+			}
+		}
+		if err == nil && rate != 0 && key.policy.AcceptsRateDate(key.date, rateDate) {
+			cc.put(key, rate, rateDate, nil)
+			return cachedConversion(amount, from, to, at, rate, rateDate), nil
+		}
+	}
+
+	// live data
+	conv, err := resolver.ConvertDetailedContext(ctx, 1.0, from, to, at)
+	if err != nil {
+		// transient errors (network, ctx) are retried the next time
+		if err == ErrNotAvailable {
+			cc.put(key, 0, time.Time{}, err)
+		}
+		return nil, err
+	}
+	cc.put(key, conv.Rate, conv.RateDate, nil)
+
+	if cc.cache != nil && isFinalConversion(resolver, key.date, conv) {
+		if err := cc.store(key.date, from, to, conv.Rate, conv.RateDate); err != nil {
+			log.Warnf("currency: unable to store %s%s rate of %s: %v", from, to,
+				key.date.Format("2006-01-02"), err)
+		}
+	}
+
+	conv.Amount = amount
+	conv.At = at
+	conv.Converted = amount * conv.Rate
+	return conv, nil
+}
+
+// isFinalConversion returns true if the rates of the conversion for the day can't change
+// anymore: the day is over and each leg has the rate of the business day the provider
+// publishes for the day, not a fallback past its last published rate
+func isFinalConversion(resolver *Resolver, day time.Time, conv *Conversion) bool {
+	if !day.Before(RateDay(time.Now())) {
+		return false
+	}
+
+	for _, leg := range conv.Legs {
+		provider := resolver.providerByName(leg.Provider)
+		if provider == nil || leg.RateDate.IsZero() {
+			return false
+		}
+		effective, err := EffectiveDay(providerCalendar(provider), resolver.policy(), day)
+		if err != nil || !RateDay(leg.RateDate).Equal(effective) {
+			return false
+		}
+	}
+	return true
+}
+
+// Prefetch downloads the rates of the pair for all days between start and end
+// in one shot using a RangeProvider and caches them (in memory and in the persistent
+// cache if it is a RateSink). Rates already in the persistent cache are kept.
+// Rates of today and of days after the last published rate can still change,
+// so they are cached just in memory.
+// Returns ErrNotAvailable if no range provider supports the pair.
+func (cc *CachingConverter) Prefetch(from Currency, to Currency, start time.Time, end time.Time) error {
+	return cc.PrefetchContext(context.Background(), from, to, start, end)
+}
+
+// PrefetchContext downloads the rates like Prefetch, stopping when ctx is done
+func (cc *CachingConverter) PrefetchContext(ctx context.Context, from Currency, to Currency, start time.Time, end time.Time) error {
+	if from == to {
+		return nil
+	}
+
+	today := RateDay(time.Now())
+	start, end = RateDay(start), RateDay(end)
+	if end.After(today) {
+		end = today
+	}
+	if start.After(end) {
+		return nil
+	}
+
+	resolver := cc.resolver()
+	rp, reversed := resolver.rangeProviderFor(from, to)
+	if rp == nil {
+		return ErrNotAvailable
+	}
+
+	// published rates including the days needed by the fallback policy
+	policy := resolver.policy()
+	pubStart, pubEnd := start.AddDate(0, 0, -MaxFallbackDays), end.AddDate(0, 0, MaxFallbackDays)
+
+	var published []HistoricalRate
+	var err error
+	if reversed {
+		published, err = getRates(ctx, rp, to, from, pubStart, pubEnd)
+	} else {
+		published, err = getRates(ctx, rp, from, to, pubStart, pubEnd)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the rate of the days after the last published one is not final yet
+	var lastPublished time.Time
+	for _, r := range published {
+		if day := RateDay(r.Date); day.After(lastPublished) {
+			lastPublished = day
+		}
+	}
+
+	var rates []HistoricalRate
+	for _, r := range fallbackRates(published, policy, start, end) {
+		// rates already stored are kept
+		if cc.cache != nil {
+			if _, _, err := cc.getStored(r.Date, from, to); err == nil {
+				continue
+			}
+		}
+
+		if reversed {
+			r.Rate = 1 / r.Rate
+		}
+		r.From, r.To = from, to
+
+		rateDate := r.RateDate
+		if rateDate.IsZero() {
+			rateDate = r.Date
+		}
+		cc.put(cacheKey{r.Date, from, to, policy}, r.Rate, rateDate, nil)
+		if r.Date.Before(today) && !r.Date.After(lastPublished) {
+			rates = append(rates, r)
+		}
+	}
+
+	if sink, ok := cc.cache.(RateSink); ok && len(rates) > 0 {
+		return sink.StoreCurrencyMultipliers(rates)
+	}
+	return nil
+}
+
+// resolver returns the resolver used for conversions
+func (cc *CachingConverter) resolver() *Resolver {
+	if cc.Resolver != nil {
+		return cc.Resolver
+	}
+	return DefaultResolver()
+}
+
+// getStored returns the rate and its date from the persistent cache
+func (cc *CachingConverter) getStored(date time.Time, from Currency, to Currency) (float64, time.Time, error) {
+	if dc, ok := cc.cache.(DatedRateCache); ok {
+		return dc.GetCurrencyRate(date, from, to)
+	}
+	rate, err := cc.cache.GetCurrencyMultiplier(date, from, to)
+	return rate, time.Time{}, err
+}
+
+// store stores the rate and its date to the persistent cache
+func (cc *CachingConverter) store(date time.Time, from Currency, to Currency, rate float64, rateDate time.Time) error {
+	if dc, ok := cc.cache.(DatedRateCache); ok {
+		return dc.StoreCurrencyRate(date, from, to, rate, rateDate)
+	}
+	return cc.cache.StoreCurrencyMultiplier(date, from, to, rate)
+}
+
+func cachedConversion(amount float64, from Currency, to Currency, at time.Time, rate float64, rateDate time.Time) *Conversion {
+	return &Conversion{
+		Amount:    amount,
+		From:      from,
+		To:        to,
+		At:        at,
+		Converted: amount * rate,
+		Rate:      rate,
+		Legs: []ConversionLeg{{From: from, To: to, Rate: rate, Provider: CacheProviderName,
+			RateDate: rateDate}},
+		RateDate: rateDate,
+	}
+}
+
+// get returns the rate or failed conversion entry from memory (nil if not cached)
+func (cc *CachingConverter) get(key cacheKey) *cacheEntry {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	elem, has := cc.entries[key]
+	if !has {
+		return nil
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if entry.err != nil && time.Now().After(entry.expires) {
+		cc.lru.Remove(elem)
+		delete(cc.entries, key)
+		return nil
+	}
+
+	cc.lru.MoveToFront(elem)
+	return entry
+}
+
+// put stores the rate or a negative entry (err set) to memory, evicting the least recently used
+func (cc *CachingConverter) put(key cacheKey, rate float64, rateDate time.Time, err error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	entry := &cacheEntry{key: key, rate: rate, rateDate: rateDate, err: err}
+	if err != nil {
+		if cc.NegativeTTL <= 0 {
+			return
+		}
+		entry.expires = time.Now().Add(cc.NegativeTTL)
+	}
+
+	if elem, has := cc.entries[key]; has {
+		elem.Value = entry
+		cc.lru.MoveToFront(elem)
+		return
+	}
+
+	cc.entries[key] = cc.lru.PushFront(entry)
+	for cc.lru.Len() > cc.size {
+		last := cc.lru.Back()
+		cc.lru.Remove(last)
+		delete(cc.entries, last.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of rates (including failed conversions) cached in memory
+func (cc *CachingConverter) Len() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.lru.Len()
+}
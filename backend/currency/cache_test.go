@@ -0,0 +1,256 @@
+package currency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testRateCache is an in-memory RateCache
+type testRateCache map[cacheKey]float64
+
+func (c testRateCache) GetCurrencyMultiplier(date time.Time, from Currency, to Currency) (float64, error) {
+	if mult, has := c[cacheKey{date: date, from: from, to: to}]; has {
+		return mult, nil
+	}
+	return 0, ErrNotAvailable
+}
+
+func (c testRateCache) StoreCurrencyMultiplier(date time.Time, from Currency, to Currency, mult float64) error {
+	c[cacheKey{date: date, from: from, to: to}] = mult
+	return nil
+}
+
+// countingProvider counts GetRate calls
+type countingProvider struct {
+	testProvider
+	calls int
+}
+
+func (p *countingProvider) GetRate(from Currency, to Currency, at time.Time) (float64, error) {
+	p.calls++
+	return p.testProvider.GetRate(from, to, at)
+}
+
+func TestCachingConverter(t *testing.T) {
+	prov := &countingProvider{testProvider: testProvider{name: "cnb", to: CZK, rates: map[Currency]float64{USD: 20}}}
+	withTestProviders(t, prov)
+
+	store := make(testRateCache)
+	cc := NewCachingConverter(store, 2)
+
+	day := time.Date(2020, 3, 5, 10, 0, 0, 0, time.UTC)
+	converted, err := cc.Convert(10, USD, CZK, day)
+	require.Nil(t, err)
+	require.Equal(t, 200.0, converted)
+	require.Equal(t, 1, prov.calls)
+	require.Equal(t, 20.0, store[cacheKey{date: RateDay(day), from: USD, to: CZK}])
+
+	// same day served from memory
+	conv, err := cc.ConvertDetailed(1, USD, CZK, day.Add(5*time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, 20.0, conv.Converted)
+	require.Equal(t, CacheProviderName, conv.Legs[0].Provider)
+	require.Equal(t, 1, prov.calls)
+
+	// a new converter shares the persistent cache, also for the reverse pair
+	cc = NewCachingConverter(store, 2)
+	converted, err = cc.Convert(40, CZK, USD, day)
+	require.Nil(t, err)
+	require.Equal(t, 2.0, converted)
+	require.Equal(t, 1, prov.calls)
+
+	// negative caching
+	_, err = cc.Convert(1, JPY, CZK, day)
+	require.Equal(t, ErrNotAvailable, err)
+	_, err = cc.Convert(1, JPY, CZK, day)
+	require.Equal(t, ErrNotAvailable, err)
+	require.Len(t, store, 1)
+
+	// failed conversions are retried after NegativeTTL
+	cc.NegativeTTL = time.Nanosecond
+	key := cacheKey{RateDay(day), JPY, CZK, Fallback}
+	cc.put(key, 0, time.Time{}, ErrNotAvailable)
+	time.Sleep(time.Millisecond)
+	require.Nil(t, cc.get(key))
+}
+
+// failingProvider fails with a network-like error
+type failingProvider struct {
+	testProvider
+}
+
+func (p *failingProvider) GetRate(from Currency, to Currency, at time.Time) (float64, error) {
+	return 0, e("connection refused")
+}
+
+// failingRateCache fails to store rates
+type failingRateCache struct {
+	testRateCache
+}
+
+func (c failingRateCache) StoreCurrencyMultiplier(date time.Time, from Currency, to Currency, mult float64) error {
+	return e("database is locked")
+}
+
+func TestCachingConverterErrors(t *testing.T) {
+	prov := &failingProvider{testProvider: testProvider{name: "cnb", to: CZK, rates: map[Currency]float64{USD: 20}}}
+	withTestProviders(t, prov)
+
+	// transient errors are not cached
+	cc := NewCachingConverter(nil, 2)
+	day := time.Date(2020, 3, 5, 10, 0, 0, 0, time.UTC)
+	_, err := cc.Convert(10, USD, CZK, day)
+	require.NotNil(t, err)
+	require.Nil(t, cc.get(cacheKey{RateDay(day), USD, CZK, Fallback}))
+	require.Equal(t, 0, cc.Len())
+
+	// rates failed to be stored are still returned
+	withTestProviders(t, &testProvider{name: "cnb", to: CZK, rates: map[Currency]float64{USD: 20}})
+	cc = NewCachingConverter(failingRateCache{make(testRateCache)}, 2)
+	converted, err := cc.Convert(10, USD, CZK, day)
+	require.Nil(t, err)
+	require.Equal(t, 200.0, converted)
+}
+
+func TestCachingConverterLRU(t *testing.T) {
+	prov := &countingProvider{testProvider: testProvider{name: "cnb", to: CZK, rates: map[Currency]float64{USD: 20}}}
+	withTestProviders(t, prov)
+
+	cc := NewCachingConverter(nil, 2)
+	day := time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		_, err := cc.Convert(1, USD, CZK, day.AddDate(0, 0, i))
+		require.Nil(t, err)
+	}
+	require.Equal(t, 2, cc.Len())
+	require.Equal(t, 3, prov.calls)
+
+	// the oldest day was evicted
+	_, err := cc.Convert(1, USD, CZK, day.AddDate(0, 0, 2))
+	require.Nil(t, err)
+	require.Equal(t, 3, prov.calls)
+	_, err = cc.Convert(1, USD, CZK, day)
+	require.Nil(t, err)
+	require.Equal(t, 4, prov.calls)
+}
+
+// rangeProvider publishes rates on weekdays and supports GetRates
+type rangeProvider struct {
+	countingProvider
+	rangeCalls int
+	// until is the last day having a published rate (unlimited if zero)
+	until time.Time
+}
+
+func (p *rangeProvider) GetRates(from Currency, to Currency, start time.Time, end time.Time) ([]HistoricalRate, error) {
+	p.rangeCalls++
+	if !p.until.IsZero() && end.After(p.until) {
+		end = p.until
+	}
+	var rates []HistoricalRate
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if WeekendCalendar.IsBusinessDay(day) {
+			rate, err := p.testProvider.GetRate(from, to, day)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, HistoricalRate{Date: day, From: from, To: to, Rate: rate + float64(day.Day())})
+		}
+	}
+	return rates, nil
+}
+
+type testRateSinkCache struct {
+	testRateCache
+	stored []HistoricalRate
+}
+
+func (c *testRateSinkCache) StoreCurrencyMultipliers(rates []HistoricalRate) error {
+	c.stored = append(c.stored, rates...)
+	return nil
+}
+
+func TestCachingConverterPrefetch(t *testing.T) {
+	prov := &rangeProvider{countingProvider: countingProvider{testProvider: testProvider{name: "cnb", to: CZK,
+		rates: map[Currency]float64{USD: 20}}}}
+	withTestProviders(t, prov)
+
+	sink := &testRateSinkCache{testRateCache: make(testRateCache)}
+	cc := NewCachingConverter(sink, 0)
+
+	// already stored rates are kept
+	start := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	sink.StoreCurrencyMultiplier(start.AddDate(0, 0, 30), CZK, USD, 0.5)
+
+	require.Nil(t, cc.Prefetch(CZK, USD, start, time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t, 1, prov.rangeCalls)
+	require.Len(t, sink.stored, 30)
+
+	// saturday uses friday rate, sunday 1st uses the last february rate
+	conv, err := cc.ConvertDetailed(26, CZK, USD, time.Date(2020, 3, 7, 15, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.InDelta(t, 1, conv.Converted, 1e-9)
+	require.Equal(t, time.Date(2020, 3, 6, 0, 0, 0, 0, time.UTC), conv.RateDate)
+	conv, err = cc.ConvertDetailed(1, CZK, USD, start)
+	require.Nil(t, err)
+	require.Equal(t, time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC), conv.RateDate)
+	require.Equal(t, 0, prov.calls)
+
+	// no range provider
+	withTestProviders(t, &testProvider{name: "cnb", to: CZK, rates: map[Currency]float64{USD: 20}})
+	require.Equal(t, ErrNotAvailable, cc.Prefetch(EUR, CZK, start, start.AddDate(0, 1, 0)))
+}
+
+func TestCachingConverterPrefetchUnpublished(t *testing.T) {
+	today := RateDay(time.Now())
+	prov := &rangeProvider{countingProvider: countingProvider{testProvider: testProvider{name: "cnb", to: CZK,
+		rates: map[Currency]float64{USD: 20}}}, until: today.AddDate(0, 0, -3)}
+	withTestProviders(t, prov)
+
+	sink := &testRateSinkCache{testRateCache: make(testRateCache)}
+	cc := NewCachingConverter(sink, 0)
+
+	require.Nil(t, cc.Prefetch(USD, CZK, today.AddDate(0, 0, -20), today.AddDate(0, 0, 5)))
+	require.NotEmpty(t, sink.stored)
+	for _, r := range sink.stored {
+		require.False(t, r.Date.After(prov.until), r.Date)
+	}
+
+	// days after the last published rate are served just from memory
+	_, err := cc.Convert(1, USD, CZK, today)
+	require.Nil(t, err)
+	require.Equal(t, 0, prov.calls)
+}
+
+func TestCachingConverterFinalRates(t *testing.T) {
+	// the provider doesn't publish on czech holidays it doesn't report
+	prov := &datedProvider{testProvider{name: "cnb", to: CZK, rates: map[Currency]float64{USD: 20}},
+		WeekendCalendar, CZCalendar}
+	withTestProviders(t, prov)
+
+	store := make(testRateCache)
+	cc := NewCachingConverter(store, 0)
+
+	// saturday uses the rate of friday, which is final
+	saturday := day("2020-10-31")
+	_, err := cc.Convert(1, USD, CZK, saturday)
+	require.Nil(t, err)
+	require.Contains(t, store, cacheKey{date: saturday, from: USD, to: CZK})
+
+	// the holiday rate is a fallback past the last published rate (not final)
+	holiday := day("2020-10-28")
+	conv, err := cc.ConvertDetailed(1, USD, CZK, holiday)
+	require.Nil(t, err)
+	require.Equal(t, day("2020-10-27"), conv.RateDate)
+	require.NotContains(t, store, cacheKey{date: holiday, from: USD, to: CZK})
+
+	// today's rate can still change
+	today := RateDay(time.Now())
+	_, err = cc.Convert(1, USD, CZK, today)
+	require.Nil(t, err)
+	require.NotContains(t, store, cacheKey{date: today, from: USD, to: CZK})
+	require.Len(t, store, 1)
+}
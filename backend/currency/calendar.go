@@ -0,0 +1,115 @@
+package currency
+
+import "time"
+
+// Calendar decides which days rates are published on
+type Calendar interface {
+	// IsBusinessDay returns true if a rate is published for the day
+	IsBusinessDay(day time.Time) bool
+}
+
+// CalendarProvider is implemented by providers publishing rates according to a calendar.
+// Providers not implementing it use WeekendCalendar.
+type CalendarProvider interface {
+	// Calendar returns the business-day calendar of the provider
+	Calendar() Calendar
+}
+
+// MonthDay is a yearly holiday with a fixed date
+type MonthDay struct {
+	Month time.Month
+	Day   int
+}
+
+// HolidayCalendar is a calendar with weekends and public holidays off
+type HolidayCalendar struct {
+	// Holidays with a fixed date
+	Holidays []MonthDay
+	// GoodFridaySince is the first year Good Friday is a holiday (0 if not a holiday)
+	GoodFridaySince int
+	// EasterMonday is true if Easter Monday is a holiday
+	EasterMonday bool
+}
+
+// WeekendCalendar has only weekends off
+var WeekendCalendar Calendar = &HolidayCalendar{}
+
+// CZCalendar is the calendar of Czech public holidays (CNB business days)
+var CZCalendar Calendar = &HolidayCalendar{
+	Holidays: []MonthDay{
+		{time.January, 1}, {time.May, 1}, {time.May, 8}, {time.July, 5}, {time.July, 6},
+		{time.September, 28}, {time.October, 28}, {time.November, 17},
+		{time.December, 24}, {time.December, 25}, {time.December, 26},
+	},
+	GoodFridaySince: 2016,
+	EasterMonday:    true,
+}
+
+// TARGETCalendar is the TARGET2 calendar (ECB business days)
+var TARGETCalendar Calendar = &HolidayCalendar{
+	Holidays: []MonthDay{
+		{time.January, 1}, {time.May, 1}, {time.December, 25}, {time.December, 26},
+	},
+	GoodFridaySince: 2000,
+	EasterMonday:    true,
+}
+
+// IsBusinessDay returns true if the day is neither a weekend nor a holiday
+func (c *HolidayCalendar) IsBusinessDay(day time.Time) bool {
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return false
+	}
+
+	year, month, dom := day.Date()
+	for _, h := range c.Holidays {
+		if h.Month == month && h.Day == dom {
+			return false
+		}
+	}
+
+	if c.GoodFridaySince > 0 || c.EasterMonday {
+		easter := EasterSunday(year)
+		if c.GoodFridaySince > 0 && year >= c.GoodFridaySince && sameDay(day, easter.AddDate(0, 0, -2)) {
+			return false
+		}
+		if c.EasterMonday && sameDay(day, easter.AddDate(0, 0, 1)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// EasterSunday returns the date of (Gregorian) Easter Sunday of the year
+func EasterSunday(year int) time.Time {
+	// anonymous Gregorian algorithm
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	r := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*r + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// providerCalendar returns the calendar of the provider
+func providerCalendar(provider Provider) Calendar {
+	if cp, ok := provider.(CalendarProvider); ok {
+		return cp.Calendar()
+	}
+	return WeekendCalendar
+}
@@ -1,64 +1,156 @@
 package currency
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type currencyPairType string
 
-var pairToProvider = make(map[currencyPairType]Provider)
+// Pivots are the currencies tried as intermediate steps of cross-rate conversions
+var Pivots = []Currency{CZK, EUR, USD}
+
+// maxLegs is the maximal number of conversions used for a cross rate
+const maxLegs = 3
 
 // currencyPair creates the pair representation
 func currencyPair(from Currency, to Currency) currencyPairType {
 	return currencyPairType(string(from) + string(to))
 }
 
+// ConversionLeg describes a single direct conversion of a (cross-rate) conversion
+type ConversionLeg struct {
+	From Currency
+	To   Currency
+	// Rate is the multiplier converting From to To
+	Rate float64
+	// Provider is the name of the provider which provided the rate
+	Provider string
+	// Reversed is true if the provider rate for To->From was used
+	Reversed bool
+	// RateDate is the date the rate has been published for (differs from the requested
+	// day for weekends and holidays according to the fallback policy, zero if unknown)
+	RateDate time.Time
+}
+
+// Conversion is a result of a currency conversion
+type Conversion struct {
+	Amount float64
+	From   Currency
+	To     Currency
+	At     time.Time
+	// Converted is the Amount in the To currency
+	Converted float64
+	// Rate is the final multiplier converting From to To
+	Rate float64
+	// Legs are the direct conversions used (empty for identity, more than one for a cross rate)
+	Legs []ConversionLeg
+	// RateDate is the date of the oldest rate used (zero for identity or if unknown)
+	RateDate time.Time
+}
+
+// setLegs sets the legs, rate and converted amount
+func (c *Conversion) setLegs(legs []ConversionLeg) {
+	c.Legs = legs
+	c.Rate = 1
+	c.RateDate = time.Time{}
+	for i, l := range legs {
+		c.Rate *= l.Rate
+		if i == 0 || l.RateDate.Before(c.RateDate) {
+			c.RateDate = l.RateDate
+		}
+	}
+	c.Converted = c.Amount * c.Rate
+}
+
 // ConvertNow converts currencie at rates now using the first available provider
 func ConvertNow(amount float64, from Currency, to Currency) (float64, error) {
 	return Convert(amount, from, to, time.Now())
 }
 
 // Convert converts currency according to rates known for the specified time,
-// using the first available provider
+// using the first available provider. If no provider supports the pair directly,
+// the cross rate through Pivots is used. Days without a published rate
+// are handled according to the Fallback policy. Uses the DefaultResolver.
 func Convert(amount float64, from Currency, to Currency, at time.Time) (float64, error) {
-	// check identity
-	if from == to {
-		return amount, nil
-	}
+	return DefaultResolver().Convert(amount, from, to, at)
+}
+
+// ConvertDetailed converts currency like Convert and reports the legs
+// and providers used for the conversion. Uses the DefaultResolver.
+func ConvertDetailed(amount float64, from Currency, to Currency, at time.Time) (*Conversion, error) {
+	return DefaultResolver().ConvertDetailed(amount, from, to, at)
+}
+
+// ConvertContext converts currency like Convert. Fetching rates stops
+// when ctx is canceled or its deadline is exceeded.
+func ConvertContext(ctx context.Context, amount float64, from Currency, to Currency, at time.Time) (float64, error) {
+	return DefaultResolver().ConvertContext(ctx, amount, from, to, at)
+}
+
+// ConvertDetailedContext converts currency like ConvertDetailed. Fetching rates stops
+// when ctx is canceled or its deadline is exceeded.
+func ConvertDetailedContext(ctx context.Context, amount float64, from Currency, to Currency, at time.Time) (*Conversion, error) {
+	return DefaultResolver().ConvertDetailedContext(ctx, amount, from, to, at)
+}
+
+// pivotPaths returns all paths from -> pivots... -> to using numPivots distinct pivots
+func pivotPaths(from Currency, to Currency, numPivots int) [][]Currency {
+	var paths [][]Currency
 
-	// try existing provider known to be working first
-	provider, has := pairToProvider[currencyPair(from, to)]
-	if !has {
-		provider, has = pairToProvider[currencyPair(to, from)]
-		if has && provider.AllowsReverse() {
-			rate, err := provider.GetRate(to, from, at)
-			if err == nil {
-				return amount / rate, nil
+	var walk func(path []Currency)
+	walk = func(path []Currency) {
+		if len(path) == numPivots+1 {
+			paths = append(paths, append(append([]Currency{}, path...), to))
+			return
+		}
+	pivots:
+		for _, p := range Pivots {
+			if p == to {
+				continue
+			}
+			for _, c := range path {
+				if c == p {
+					continue pivots
+				}
 			}
+			walk(append(path, p))
 		}
 	}
+	walk([]Currency{from})
+
+	return paths
+}
 
-	// try all providers
+// providerLeg gets the rate of the provider, using its To->From rate if reversed
+func providerLeg(ctx context.Context, provider Provider, policy FallbackPolicy, from Currency, to Currency,
+	at time.Time, reversed bool) (*ConversionLeg, error) {
+	var rate float64
+	var rateDate time.Time
 	var err error
-	for _, provider := range Providers {
-		var rate, converted float64
-
-		if provider.Supports(from, to) {
-			pairToProvider[currencyPair(from, to)] = provider
-			rate, err = provider.GetRate(from, to, at)
-			converted = amount * rate
-		} else if provider.Supports(to, from) && provider.AllowsReverse() {
-			pairToProvider[currencyPair(to, from)] = provider
-			rate, err = provider.GetRate(to, from, at)
-			converted = amount / rate
-		}
 
-		if err == nil {
-			return converted, nil
+	if reversed {
+		rate, rateDate, err = getRateWithFallback(ctx, provider, policy, to, from, at)
+		if err == nil && rate != 0 {
+			rate = 1 / rate
 		}
+	} else {
+		rate, rateDate, err = getRateWithFallback(ctx, provider, policy, from, to, at)
 	}
 
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if rate == 0 {
+		return nil, ErrNotAvailable
 	}
 
-	return 0, ErrNotAvailable
+	return &ConversionLeg{
+		From:     from,
+		To:       to,
+		Rate:     rate,
+		Provider: provider.Name(),
+		Reversed: reversed,
+		RateDate: rateDate,
+	}, nil
 }
@@ -0,0 +1,99 @@
+package currency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testProvider provides fixed rates to the target currency
+type testProvider struct {
+	name  string
+	to    Currency
+	rates map[Currency]float64
+}
+
+func (p *testProvider) Name() string        { return p.name }
+func (p *testProvider) AllowsReverse() bool { return true }
+
+func (p *testProvider) Supports(from Currency, to Currency) bool {
+	_, has := p.rates[from]
+	return has && to == p.to
+}
+
+func (p *testProvider) GetRate(from Currency, to Currency, at time.Time) (float64, error) {
+	if !p.Supports(from, to) {
+		return 0, ErrNotAvailable
+	}
+	return p.rates[from], nil
+}
+
+// withTestProviders replaces registered providers for the duration of the test
+func withTestProviders(t *testing.T, providers ...Provider) {
+	origProviders, origResolver := Providers, DefaultResolver()
+	Providers = providers
+	SetDefaultResolver(NewResolver())
+	t.Cleanup(func() {
+		Providers = origProviders
+		SetDefaultResolver(origResolver)
+	})
+}
+
+func TestConvertCrossRate(t *testing.T) {
+	cnb := &testProvider{name: "cnb", to: CZK, rates: map[Currency]float64{USD: 20, EUR: 25}}
+	ecb := &testProvider{name: "ecb", to: GBP, rates: map[Currency]float64{EUR: 0.8}}
+	withTestProviders(t, cnb, ecb)
+
+	now := time.Date(2020, 3, 5, 12, 0, 0, 0, time.UTC)
+	day := RateDay(now)
+
+	// identity
+	conv, err := ConvertDetailed(10, USD, USD, now)
+	require.Nil(t, err)
+	require.Equal(t, 10.0, conv.Converted)
+	require.Len(t, conv.Legs, 0)
+
+	// direct and reversed
+	conv, err = ConvertDetailed(10, USD, CZK, now)
+	require.Nil(t, err)
+	require.Equal(t, 200.0, conv.Converted)
+	require.Equal(t, []ConversionLeg{{From: USD, To: CZK, Rate: 20, Provider: "cnb", RateDate: day}}, conv.Legs)
+	require.Equal(t, day, conv.RateDate)
+
+	conv, err = ConvertDetailed(250, CZK, EUR, now)
+	require.Nil(t, err)
+	require.InDelta(t, 10.0, conv.Converted, 1e-9)
+	require.True(t, conv.Legs[0].Reversed)
+
+	// through CZK
+	conv, err = ConvertDetailed(10, USD, EUR, now)
+	require.Nil(t, err)
+	require.InDelta(t, 8.0, conv.Converted, 1e-9)
+	require.InDelta(t, 0.8, conv.Rate, 1e-9)
+	require.Len(t, conv.Legs, 2)
+	require.Equal(t, CZK, conv.Legs[0].To)
+	require.Equal(t, "cnb", conv.Legs[1].Provider)
+
+	converted, err := Convert(10, USD, EUR, now)
+	require.Nil(t, err)
+	require.InDelta(t, 8.0, converted, 1e-9)
+
+	// two pivots, two providers
+	conv, err = ConvertDetailed(10, USD, GBP, now)
+	require.Nil(t, err)
+	require.InDelta(t, 6.4, conv.Converted, 1e-9)
+	require.Len(t, conv.Legs, 3)
+	require.Equal(t, []Currency{USD, CZK, EUR}, []Currency{conv.Legs[0].From, conv.Legs[1].From, conv.Legs[2].From})
+	require.Equal(t, "ecb", conv.Legs[2].Provider)
+
+	// unknown currency
+	_, err = ConvertDetailed(10, USD, JPY, now)
+	require.Equal(t, ErrNotAvailable, err)
+}
+
+func TestPivotPaths(t *testing.T) {
+	require.Equal(t, [][]Currency{{USD, CZK, GBP}, {USD, EUR, GBP}}, pivotPaths(USD, GBP, 1))
+	require.Equal(t, [][]Currency{{USD, EUR, CZK}}, pivotPaths(USD, CZK, 1)[:1])
+	require.Len(t, pivotPaths(GBP, JPY, 2), 6)
+}
@@ -48,6 +48,15 @@ const (
 	TWD     = Currency("TWD")
 )
 
+// knownCurrencies holds all the currencies defined in this package
+var knownCurrencies = map[Currency]bool{
+	AUD: true, BRL: true, CZK: true, GBN: true, CNY: true, DKK: true, EUR: true, PHP: true,
+	HKD: true, HRK: true, INR: true, IDR: true, ILS: true, JPY: true, ZAR: true, KRW: true,
+	CAD: true, HUF: true, MYR: true, MXN: true, XDR: true, NOK: true, NZD: true, PLN: true,
+	RON: true, RUB: true, SGD: true, SEK: true, CHF: true, THB: true, TRY: true, USD: true,
+	GBP: true, ARS: true, ISK: true, ZAC: true, SAR: true, ILA: true, TWD: true,
+}
+
 var currencyNameMap = map[Currency]string{
 	AUD: "Australian dollar",
 	BRL: "Brazilian real",
@@ -74,6 +83,11 @@ func (c Currency) Name() string {
 	return c.String()
 }
 
+// Known returns true if the currency is one of the ISO 4217 codes defined in this package
+func (c Currency) Known() bool {
+	return knownCurrencies[c]
+}
+
 // FromString returns a Currency from its string identiier
 func FromString(currencyIdent string) Currency {
 	return Currency(currencyIdent)
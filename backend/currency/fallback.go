@@ -0,0 +1,138 @@
+package currency
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// FallbackPolicy decides which rate is used for days without a published rate
+// (weekends and holidays)
+type FallbackPolicy string
+
+// Fallback policies
+const (
+	// FallbackPrevious uses the rate of the previous business day
+	FallbackPrevious FallbackPolicy = "previous"
+	// FallbackNext uses the rate of the next business day
+	FallbackNext FallbackPolicy = "next"
+	// FallbackStrict fails with ErrNotBusinessDay for days without a published rate
+	FallbackStrict FallbackPolicy = "strict"
+)
+
+// Fallback is the policy used by Convert
+var Fallback = FallbackPrevious
+
+// MaxFallbackDays is the maximal number of days searched for a business day
+const MaxFallbackDays = 10
+
+// ErrNotBusinessDay is returned by the strict fallback policy for days without a rate
+var ErrNotBusinessDay = e("no rate is published for the day")
+
+// FallbackPolicyFromName returns the policy by its name
+func FallbackPolicyFromName(name string) (FallbackPolicy, error) {
+	switch policy := FallbackPolicy(strings.ToLower(name)); policy {
+	case FallbackPrevious, FallbackNext, FallbackStrict:
+		return policy, nil
+	}
+	return "", e("unknown fallback policy %s (previous, next or strict)", name)
+}
+
+// DatedProvider is implemented by providers reporting the date the returned rate
+// has been published for. Other providers are assumed to return the rate of the requested day.
+type DatedProvider interface {
+	// GetRateDated gets the currency rate for the specified time like GetRate
+	// and the effective date of the rate
+	GetRateDated(from Currency, to Currency, at time.Time) (float64, time.Time, error)
+}
+
+// EffectiveDay returns the business day whose rate is used for the time under the policy
+func EffectiveDay(cal Calendar, policy FallbackPolicy, at time.Time) (time.Time, error) {
+	day := RateDay(at)
+
+	step := 0
+	switch policy {
+	case FallbackPrevious:
+		step = -1
+	case FallbackNext:
+		step = 1
+	case FallbackStrict:
+		if !cal.IsBusinessDay(day) {
+			return day, ErrNotBusinessDay
+		}
+		return day, nil
+	default:
+		return day, e("unknown fallback policy %s", policy)
+	}
+
+	for i := 0; i <= MaxFallbackDays; i++ {
+		if cal.IsBusinessDay(day) {
+			if step > 0 && day.After(time.Now()) {
+				// not published yet
+				return day, ErrNotAvailable
+			}
+			return day, nil
+		}
+		day = day.AddDate(0, 0, step)
+	}
+	return day, ErrNotBusinessDay
+}
+
+// AcceptsRateDate checks whether the rate published for rateDate can be used
+// for the day under the policy. Unknown (zero) rate dates are accepted
+// by FallbackPrevious only.
+func (p FallbackPolicy) AcceptsRateDate(day time.Time, rateDate time.Time) bool {
+	day = RateDay(day)
+	if rateDate.IsZero() {
+		return p == FallbackPrevious
+	}
+	rateDate = RateDay(rateDate)
+
+	switch p {
+	case FallbackPrevious:
+		return !rateDate.After(day)
+	case FallbackNext:
+		return !rateDate.Before(day)
+	case FallbackStrict:
+		return rateDate.Equal(day)
+	}
+	return false
+}
+
+// getRateWithFallback gets the provider rate for the business day given by the policy
+// and returns the effective date of the rate. Providers not implementing ContextProvider
+// are not called once ctx is done.
+func getRateWithFallback(ctx context.Context, provider Provider, policy FallbackPolicy, from Currency, to Currency,
+	at time.Time) (float64, time.Time, error) {
+	day, err := EffectiveDay(providerCalendar(provider), policy, at)
+	if err != nil {
+		return 0, day, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, day, err
+	}
+
+	var rate float64
+	var rateDate time.Time
+
+	switch p := provider.(type) {
+	case ContextProvider:
+		rate, rateDate, err = p.GetRateDatedContext(ctx, from, to, day)
+	case DatedProvider:
+		rate, rateDate, err = p.GetRateDated(from, to, day)
+	default:
+		rate, err := provider.GetRate(from, to, day)
+		return rate, day, err
+	}
+	if err != nil {
+		return 0, rateDate, err
+	}
+	rateDate = RateDay(rateDate)
+
+	// unexpected holiday of the provider
+	if !rateDate.Equal(day) && !(policy == FallbackPrevious && rateDate.Before(day)) {
+		return 0, rateDate, ErrNotAvailable
+	}
+
+	return rate, rateDate, nil
+}
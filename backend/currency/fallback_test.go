@@ -0,0 +1,118 @@
+package currency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func day(date string) time.Time {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestCalendars(t *testing.T) {
+	require.Equal(t, day("2020-04-12"), EasterSunday(2020))
+	require.Equal(t, day("2019-04-21"), EasterSunday(2019))
+
+	require.True(t, CZCalendar.IsBusinessDay(day("2020-03-05")))
+	require.False(t, CZCalendar.IsBusinessDay(day("2020-03-07")))     // saturday
+	require.False(t, CZCalendar.IsBusinessDay(day("2020-10-28")))     // independence day
+	require.False(t, CZCalendar.IsBusinessDay(day("2020-04-10")))     // good friday
+	require.True(t, CZCalendar.IsBusinessDay(day("2015-04-03")))      // good friday before 2016
+	require.False(t, CZCalendar.IsBusinessDay(day("2020-04-13")))     // easter monday
+	require.True(t, TARGETCalendar.IsBusinessDay(day("2020-10-28")))  // czech holiday only
+	require.False(t, TARGETCalendar.IsBusinessDay(day("2020-12-26"))) // saturday anyway
+	require.False(t, TARGETCalendar.IsBusinessDay(day("2019-12-26")))
+}
+
+func TestEffectiveDay(t *testing.T) {
+	saturday := day("2020-10-31")
+
+	eff, err := EffectiveDay(CZCalendar, FallbackPrevious, saturday.Add(15*time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, day("2020-10-30"), eff)
+
+	eff, err = EffectiveDay(CZCalendar, FallbackNext, saturday)
+	require.Nil(t, err)
+	require.Equal(t, day("2020-11-02"), eff)
+
+	_, err = EffectiveDay(CZCalendar, FallbackStrict, saturday)
+	require.Equal(t, ErrNotBusinessDay, err)
+
+	// tuesday after the holiday, previous skips the weekend and the holiday
+	eff, err = EffectiveDay(CZCalendar, FallbackPrevious, day("2020-10-28"))
+	require.Nil(t, err)
+	require.Equal(t, day("2020-10-27"), eff)
+
+	_, err = EffectiveDay(CZCalendar, FallbackNext, time.Now().AddDate(0, 0, 7))
+	require.Equal(t, ErrNotAvailable, err)
+
+	policy, err := FallbackPolicyFromName("Next")
+	require.Nil(t, err)
+	require.Equal(t, FallbackNext, policy)
+	_, err = FallbackPolicyFromName("nearest")
+	require.NotNil(t, err)
+
+	require.True(t, FallbackPrevious.AcceptsRateDate(saturday, time.Time{}))
+	require.False(t, FallbackStrict.AcceptsRateDate(saturday, time.Time{}))
+	require.True(t, FallbackPrevious.AcceptsRateDate(saturday, day("2020-10-30")))
+	require.False(t, FallbackNext.AcceptsRateDate(saturday, day("2020-10-30")))
+}
+
+// datedProvider publishes rates on business days of the published calendar
+// and reports cal as its calendar
+type datedProvider struct {
+	testProvider
+	cal       Calendar
+	published Calendar
+}
+
+func (p *datedProvider) Calendar() Calendar { return p.cal }
+
+func (p *datedProvider) GetRateDated(from Currency, to Currency, at time.Time) (float64, time.Time, error) {
+	rate, err := p.testProvider.GetRate(from, to, at)
+	// a rate of the previous business day (like CNB does)
+	for !p.published.IsBusinessDay(at) {
+		at = at.AddDate(0, 0, -1)
+	}
+	return rate, at, err
+}
+
+func TestConvertFallback(t *testing.T) {
+	prov := &datedProvider{testProvider{name: "cnb", to: CZK, rates: map[Currency]float64{USD: 20}}, CZCalendar, CZCalendar}
+	withTestProviders(t, prov)
+
+	origFallback := Fallback
+	defer func() { Fallback = origFallback }()
+
+	saturday := day("2020-10-31")
+
+	conv, err := ConvertDetailed(1, USD, CZK, saturday)
+	require.Nil(t, err)
+	require.Equal(t, day("2020-10-30"), conv.RateDate)
+
+	Fallback = FallbackNext
+	conv, err = ConvertDetailed(1, USD, CZK, saturday)
+	require.Nil(t, err)
+	require.Equal(t, day("2020-11-02"), conv.RateDate)
+	require.Equal(t, day("2020-11-02"), conv.Legs[0].RateDate)
+
+	Fallback = FallbackStrict
+	_, err = ConvertDetailed(1, USD, CZK, saturday)
+	require.Equal(t, ErrNotBusinessDay, err)
+
+	// provider holiday unknown to the calendar
+	prov.cal = WeekendCalendar
+	_, err = ConvertDetailed(1, USD, CZK, day("2020-10-28"))
+	require.Equal(t, ErrNotAvailable, err)
+
+	Fallback = FallbackPrevious
+	conv, err = ConvertDetailed(1, USD, CZK, day("2020-10-28"))
+	require.Nil(t, err)
+	require.Equal(t, day("2020-10-27"), conv.RateDate)
+}
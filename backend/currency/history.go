@@ -0,0 +1,91 @@
+package currency
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// HistoricalRate is a conversion rate (multiplier) known for the date
+type HistoricalRate struct {
+	Date time.Time
+	From Currency
+	To   Currency
+	Rate float64
+	// RateDate is the date the rate has been published for if it differs from Date
+	// (weekends and holidays), zero otherwise
+	RateDate time.Time
+}
+
+// RateSink receives bulk loaded rates (implemented by the store)
+type RateSink interface {
+	// StoreCurrencyMultipliers stores the rates, replacing already known ones
+	StoreCurrencyMultipliers(rates []HistoricalRate) error
+}
+
+// RangeProvider is implemented by providers able to return rates for a date range
+// in bulk (much cheaper than calling GetRate for every day)
+type RangeProvider interface {
+	// GetRates returns the rates published between start and end (inclusive), sorted by date.
+	// Days without a published rate (weekends and holidays) are not returned.
+	GetRates(from Currency, to Currency, start time.Time, end time.Time) ([]HistoricalRate, error)
+}
+
+// RangeContextProvider is a RangeProvider able to stop fetching rates when the context
+// is canceled or its deadline is exceeded
+type RangeContextProvider interface {
+	// GetRatesContext returns the rates like GetRates
+	GetRatesContext(ctx context.Context, from Currency, to Currency, start time.Time, end time.Time) ([]HistoricalRate, error)
+}
+
+// getRates returns the rates of the range provider. Providers not implementing
+// RangeContextProvider are not called once ctx is done.
+func getRates(ctx context.Context, rp RangeProvider, from Currency, to Currency, start time.Time,
+	end time.Time) ([]HistoricalRate, error) {
+	if p, ok := rp.(RangeContextProvider); ok {
+		return p.GetRatesContext(ctx, from, to, start, end)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return rp.GetRates(from, to, start, end)
+}
+
+// fallbackRates returns the rates for every day between start and end chosen
+// from the published rates according to the policy
+func fallbackRates(published []HistoricalRate, policy FallbackPolicy, start time.Time, end time.Time) []HistoricalRate {
+	sort.SliceStable(published, func(i, j int) bool {
+		return published[i].Date.Before(published[j].Date)
+	})
+
+	byDay := make(map[time.Time]HistoricalRate)
+	for _, r := range published {
+		byDay[RateDay(r.Date)] = r
+	}
+
+	step := 0
+	switch policy {
+	case FallbackPrevious:
+		step = -1
+	case FallbackNext:
+		step = 1
+	}
+
+	var rates []HistoricalRate
+	for day := RateDay(start); !day.After(end); day = day.AddDate(0, 0, 1) {
+		pub, found := byDay[day]
+		for i := 1; !found && step != 0 && i <= MaxFallbackDays; i++ {
+			pub, found = byDay[day.AddDate(0, 0, i*step)]
+		}
+		if !found {
+			continue
+		}
+
+		rate := HistoricalRate{Date: day, From: pub.From, To: pub.To, Rate: pub.Rate}
+		if pubDay := RateDay(pub.Date); !pubDay.Equal(day) {
+			rate.RateDate = pubDay
+		}
+		rates = append(rates, rate)
+	}
+	return rates
+}
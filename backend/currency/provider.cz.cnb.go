@@ -1,8 +1,14 @@
 package currency
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"strings"
@@ -10,19 +16,29 @@ import (
 	"github.com/k3a/in2tracker/backend/utils"
 )
 
+// CNBBaseURL is the location of the cnb.cz exchange rate files
+const CNBBaseURL = "http://www.cnb.cz/cs/financni_trhy/devizovy_trh/kurzy_devizoveho_trhu/"
+
 // CZCNB receives data from
 type CZCNB struct {
 	allowedSrcCurrencies []Currency
 	httpClient           *http.Client
+	baseURL              string
+
+	// mu guards allowedSrcCurrencies and years
+	mu sync.Mutex
+	// yearly rates by date (YYYY-MM-DD) and currency
+	years map[int]map[string]map[Currency]float64
 }
 
 // NewCZCNB creates a new cnb.cz currency rates provider
 func NewCZCNB() Provider {
 	return &CZCNB{
-		nil,
-		&http.Client{
+		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		baseURL: CNBBaseURL,
+		years:   make(map[int]map[string]map[Currency]float64),
 	}
 }
 
@@ -37,23 +53,26 @@ func (c *CZCNB) AllowsReverse() bool {
 	return true // rates are "middle"
 }
 
-// Supports checks whether the providet supports the currency conversion
+// cnbCurrencies holds the currencies having CNB rates (including the ones no longer published)
+var cnbCurrencies = map[Currency]bool{
+	AUD: true, BRL: true, CAD: true, CNY: true, DKK: true, EUR: true, PHP: true, HKD: true,
+	HRK: true, INR: true, IDR: true, ISK: true, ILS: true, JPY: true, ZAR: true, KRW: true,
+	HUF: true, MYR: true, MXN: true, XDR: true, NOK: true, NZD: true, PLN: true, RON: true,
+	RUB: true, SGD: true, SEK: true, CHF: true, THB: true, TRY: true, USD: true, GBP: true,
+	"BGN": true,
+}
+
+// Supports checks whether the providet supports the currency conversion.
+// Currencies listed in the downloaded rates are supported as well.
 func (c *CZCNB) Supports(from Currency, to Currency) bool {
 	if to != CZK {
 		return false
 	}
-
-	if c.allowedSrcCurrencies == nil {
-		// make at least one request to get the list first
-		_, err := c.GetRate(USD, CZK, time.Now().AddDate(0, 0, -1))
-		if err != nil {
-			fmt.Printf("Unable to fetch supported currencies by cnb.cz! %s\n",
-				err.Error())
-			return false
-		}
+	if cnbCurrencies[from] {
+		return true
 	}
 
-	for _, currency := range c.allowedSrcCurrencies {
+	for _, currency := range c.allowedCurrencies() {
 		if currency == from {
 			return true
 		}
@@ -62,27 +81,100 @@ func (c *CZCNB) Supports(from Currency, to Currency) bool {
 	return false
 }
 
+// allowedCurrencies returns the currencies known to be supported (nil if not fetched yet)
+func (c *CZCNB) allowedCurrencies() []Currency {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.allowedSrcCurrencies
+}
+
+// Calendar returns the business-day calendar of the provider
+func (c *CZCNB) Calendar() Calendar {
+	return CZCalendar
+}
+
 // GetRate gets the currency rate for the specified time. Returns ErrNotAvailable error
 // if the conversion rate for the specified time is not known
 func (c *CZCNB) GetRate(from Currency, to Currency, at time.Time) (float64, error) {
+	return c.GetRateContext(context.Background(), from, to, at)
+}
+
+// GetRateContext gets the currency rate like GetRate, stopping when ctx is done
+func (c *CZCNB) GetRateContext(ctx context.Context, from Currency, to Currency, at time.Time) (float64, error) {
+	rate, _, err := c.GetRateDatedContext(ctx, from, to, at)
+	return rate, err
+}
+
+// GetRateDated gets the currency rate for the specified time and the date the rate
+// has been issued for (the last business day for weekends and holidays)
+func (c *CZCNB) GetRateDated(from Currency, to Currency, at time.Time) (float64, time.Time, error) {
+	return c.GetRateDatedContext(context.Background(), from, to, at)
+}
+
+// GetRateDatedContext gets the currency rate like GetRateDated, stopping when ctx is done
+func (c *CZCNB) GetRateDatedContext(ctx context.Context, from Currency, to Currency, at time.Time) (float64, time.Time, error) {
 	if to != CZK {
-		return 0, ErrNotAvailable
+		return 0, time.Time{}, ErrNotAvailable
+	}
+
+	// already downloaded yearly rates
+	if rate, issued, found := c.findYearRate(from, at); found {
+		if rate == 0 {
+			return 0, issued, ErrNotAvailable
+		}
+		return rate, issued, nil
 	}
 
-	url := fmt.Sprintf("http://www.cnb.cz/cs/financni_trhy/devizovy_trh/kurzy_devizoveho_trhu/"+
-		"denni_kurz.txt?date=%02d.%02d.%04d", at.Day(), at.Month(), at.Year())
+	url := fmt.Sprintf(c.baseURL+"denni_kurz.txt?date=%02d.%02d.%04d", at.Day(), at.Month(), at.Year())
 
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.get(ctx, url)
 	if err != nil {
-		return 0, err
+		return 0, time.Time{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, e("cnb.cz server returned code %d", resp.StatusCode)
+		return 0, time.Time{}, e("cnb.cz server returned code %d", resp.StatusCode)
 	}
 
-	csv := utils.NewCSVReader(resp.Body)
+	issued, rates, currencies, err := parseCNBDaily(resp.Body)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if at.Sub(issued) > MaxRateAge {
+		return 0, time.Time{}, ErrOldData
+	}
+
+	// allowed currencies
+	c.mu.Lock()
+	if c.allowedSrcCurrencies == nil {
+		c.allowedSrcCurrencies = currencies
+	}
+	c.mu.Unlock()
+
+	// try to find a matching rate
+	rate, found := rates[from]
+	if !found {
+		return 0, issued, ErrNotAvailable
+	}
+
+	return rate, issued, nil
+}
+
+// get requests the url, stopping when ctx is done
+func (c *CZCNB) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.httpClient.Do(req)
+}
+
+// parseCNBDaily parses the daily rate file ("06.01.2017 #5" header followed
+// by "země|měna|množství|kód|kurz" CSV). Returns the issue date, rates
+// (per one unit) and currencies in the file order.
+func parseCNBDaily(reader io.Reader) (time.Time, map[Currency]float64, []Currency, error) {
+	csv := utils.NewCSVReader(reader)
 	csv.Comma = '|'
 
 	var rows []struct {
@@ -93,51 +185,223 @@ func (c *CZCNB) GetRate(from Currency, to Currency, at time.Time) (float64, erro
 		Rate         utils.CZFloat64String `csv:"kurz"`
 	}
 
-	err = csv.Unmarshal(&rows)
+	err := csv.Unmarshal(&rows)
 	if err != nil {
-		return 0, err
+		return time.Time{}, nil, nil, err
 	}
 
 	// check the garbage - parse the date
 	headerParts := strings.Split(csv.GarbageString(), " ")
 	if len(headerParts) < 2 {
 		// wrong format (should be similar to "06.01.2017 #5")
-		return 0, ErrBadFormat
+		return time.Time{}, nil, nil, ErrBadFormat
 	}
 	issued, err := time.Parse("02.01.2006", headerParts[0])
 	if err != nil {
 		// unable to parse isssue date from the header
-		return 0, ErrBadFormat
+		return time.Time{}, nil, nil, ErrBadFormat
+	}
+
+	rates := make(map[Currency]float64)
+	var currencies []Currency
+	for _, r := range rows {
+		if r.Amount.Float64 == 0 {
+			return time.Time{}, nil, nil, ErrBadFormat
+		}
+		if _, has := rates[r.Currency]; !has {
+			rates[r.Currency] = r.Rate.Float64 / r.Amount.Float64
+			currencies = append(currencies, r.Currency)
+		}
 	}
-	if at.Sub(issued) > 5*24*time.Hour {
-		return 0, ErrOldData
+
+	return issued, rates, currencies, nil
+}
+
+// findYearRate finds the rate issued for the day or the last one before it
+// in the downloaded yearly rates. Returns false if the day is not covered.
+func (c *CZCNB) findYearRate(from Currency, at time.Time) (float64, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	day := RateDay(at)
+	year, has := c.years[day.Year()]
+	if !has || !cnbYearCovers(year, day) {
+		return 0, time.Time{}, false
 	}
 
-	// allowed currencies
-	if c.allowedSrcCurrencies == nil {
-		for _, r := range rows {
-			c.allowedSrcCurrencies = append(c.allowedSrcCurrencies, r.Currency)
+	for d := day; day.Sub(d) <= MaxRateAge; d = d.AddDate(0, 0, -1) {
+		dayRates, has := c.years[d.Year()][d.Format("2006-01-02")]
+		if !has {
+			continue
 		}
+		return dayRates[from], d, true
 	}
+	return 0, time.Time{}, false
+}
 
-	// try to find a matching rate
-	found := false
-	rate := 0.0
-	for _, r := range rows {
-		if c.allowedSrcCurrencies == nil {
-			c.allowedSrcCurrencies = append(c.allowedSrcCurrencies, r.Currency)
+// cnbYearCovers checks whether the yearly rates contain rates issued on the day or later
+func cnbYearCovers(year map[string]map[Currency]float64, day time.Time) bool {
+	key := day.Format("2006-01-02")
+	for date := range year {
+		if date >= key {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRates returns the rates issued between start and end (inclusive) using
+// the yearly rate files (a single request per year)
+func (c *CZCNB) GetRates(from Currency, to Currency, start time.Time, end time.Time) ([]HistoricalRate, error) {
+	return c.GetRatesContext(context.Background(), from, to, start, end)
+}
+
+// GetRatesContext returns the rates like GetRates, stopping when ctx is done
+func (c *CZCNB) GetRatesContext(ctx context.Context, from Currency, to Currency, start time.Time, end time.Time) ([]HistoricalRate, error) {
+	if to != CZK {
+		return nil, ErrNotAvailable
+	}
+
+	start, end = RateDay(start), RateDay(end)
+	startKey, endKey := start.Format("2006-01-02"), end.Format("2006-01-02")
+
+	var rates []HistoricalRate
+	for y := start.Year(); y <= end.Year(); y++ {
+		year, err := c.loadYear(ctx, y)
+		if err != nil {
+			return nil, err
 		}
-		if !found && r.Currency == from {
-			rate = r.Rate.Float64 / r.Amount.Float64
-			found = true
+
+		for date, dayRates := range year {
+			rate, has := dayRates[from]
+			if !has || date < startKey || date > endKey {
+				continue
+			}
+			issued, _ := time.Parse("2006-01-02", date)
+			rates = append(rates, HistoricalRate{Date: issued, From: from, To: CZK, Rate: rate})
 		}
 	}
 
-	if !found {
-		return 0, ErrNotAvailable
+	if len(rates) == 0 {
+		return nil, ErrNotAvailable
 	}
 
-	return rate, nil
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Date.Before(rates[j].Date)
+	})
+	return rates, nil
+}
+
+// loadYear downloads and parses the yearly rates (years in the past are downloaded once).
+// The lock is not held while downloading.
+func (c *CZCNB) loadYear(ctx context.Context, y int) (map[string]map[Currency]float64, error) {
+	c.mu.Lock()
+	year, has := c.years[y]
+	c.mu.Unlock()
+	if has && y < time.Now().Year() {
+		return year, nil
+	}
+
+	resp, err := c.get(ctx, fmt.Sprintf(c.baseURL+"rok.txt?rok=%04d", y))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, e("cnb.cz server returned code %d", resp.StatusCode)
+	}
+
+	year, err = parseCNBYear(bufio.NewScanner(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.years[y] = year
+
+	if c.allowedSrcCurrencies == nil {
+		seen := make(map[Currency]bool)
+		for _, dayRates := range year {
+			for cur := range dayRates {
+				if !seen[cur] {
+					seen[cur] = true
+					c.allowedSrcCurrencies = append(c.allowedSrcCurrencies, cur)
+				}
+			}
+		}
+	}
+
+	return year, nil
+}
+
+// parseCNBYear parses the yearly rate file. The file consists of header lines
+// ("Datum|1 AUD|100 JPY|...", repeated when the list of currencies changes)
+// followed by daily lines ("02.01.2020|15,868|20,856|...").
+func parseCNBYear(scanner *bufio.Scanner) (map[string]map[Currency]float64, error) {
+	type column struct {
+		currency Currency
+		amount   float64
+	}
+
+	year := make(map[string]map[Currency]float64)
+	var columns []column
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Split(line, "|")
+
+		if fields[0] == "Datum" {
+			columns = nil
+			for _, f := range fields[1:] {
+				parts := strings.Fields(f)
+				if len(parts) != 2 {
+					return nil, ErrBadFormat
+				}
+				amount, err := strconv.ParseFloat(parts[0], 64)
+				if err != nil || amount == 0 {
+					return nil, ErrBadFormat
+				}
+				columns = append(columns, column{FromString(parts[1]), amount})
+			}
+			continue
+		}
+
+		if columns == nil || len(fields) != len(columns)+1 {
+			return nil, ErrBadFormat
+		}
+		issued, err := time.Parse("02.01.2006", fields[0])
+		if err != nil {
+			return nil, ErrBadFormat
+		}
+
+		dayRates := make(map[Currency]float64)
+		for i, col := range columns {
+			value := strings.Replace(strings.TrimSpace(fields[i+1]), ",", ".", 1)
+			if len(value) == 0 {
+				continue
+			}
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, ErrBadFormat
+			}
+			dayRates[col.currency] = rate / col.amount
+		}
+		year[issued.Format("2006-01-02")] = dayRates
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(year) == 0 {
+		return nil, ErrBadFormat
+	}
+	return year, nil
 }
 
 func init() {
@@ -1,7 +1,13 @@
 package currency
 
-import "testing"
-import "time"
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
 
 func TestCZCNB(t *testing.T) {
 	cnb := NewCZCNB()
@@ -18,3 +24,57 @@ func TestCZCNB(t *testing.T) {
 		t.Fatal("wrong rate")
 	}
 }
+
+func newCNBTestServer(t *testing.T, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.URL.Path != "/rok.txt" || r.URL.Query().Get("rok") != "2020" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, "provider.cz.cnb_test_rok.txt")
+	}))
+}
+
+func TestCZCNBGetRates(t *testing.T) {
+	requests := 0
+	srv := newCNBTestServer(t, &requests)
+	defer srv.Close()
+
+	cnb := NewCZCNB().(*CZCNB)
+	cnb.baseURL = srv.URL + "/"
+
+	rates, err := cnb.GetRates(USD, CZK, time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 7, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Len(t, rates, 3)
+	require.Equal(t, HistoricalRate{Date: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), From: USD, To: CZK, Rate: 22.725}, rates[0])
+	require.Equal(t, 22.621, rates[1].Rate)
+	require.Equal(t, 1, requests)
+
+	// currencies added later in the year
+	rates, err = cnb.GetRates(GBP, CZK, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Len(t, rates, 1)
+	require.Equal(t, 29.745, rates[0].Rate)
+
+	// daily rates are served from the downloaded year, weekend from friday
+	rate, issued, err := cnb.GetRateDated(EUR, CZK, time.Date(2020, 1, 5, 12, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, 25.36, rate)
+	require.Equal(t, time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), issued)
+	rate, _, err = cnb.GetRateDated(JPY, CZK, time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.InDelta(t, 0.20975, rate, 1e-9)
+	require.True(t, cnb.Supports(AUD, CZK))
+	require.Equal(t, 1, requests)
+
+	_, err = cnb.GetRates(USD, CZK, time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC))
+	require.NotNil(t, err)
+
+	_, err = cnb.GetRates(USD, EUR, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, ErrNotAvailable, err)
+}
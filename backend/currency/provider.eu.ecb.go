@@ -0,0 +1,433 @@
+package currency
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ECBBaseURL is the location of the ECB euro foreign exchange reference rate feeds
+const ECBBaseURL = "https://www.ecb.europa.eu/stats/eurofxref/"
+
+// ecbDateLayout is the date format used by the feeds
+const ecbDateLayout = "2006-01-02"
+
+// ecbFeedMaxAge is how long a loaded feed is used for dates after its newest rate
+// before downloading it again (feeds are updated every business day)
+const ecbFeedMaxAge = time.Hour
+
+// ecbCurrencies holds the currencies having euro reference rates (including the ones
+// no longer published, e.g. replaced by the euro)
+var ecbCurrencies = map[Currency]bool{
+	USD: true, JPY: true, CZK: true, DKK: true, GBP: true, HUF: true, PLN: true, RON: true,
+	SEK: true, CHF: true, ISK: true, NOK: true, TRY: true, AUD: true, BRL: true, CAD: true,
+	CNY: true, HKD: true, IDR: true, ILS: true, INR: true, KRW: true, MXN: true, MYR: true,
+	NZD: true, PHP: true, SGD: true, THB: true, ZAR: true, HRK: true, RUB: true,
+	"BGN": true, "CYP": true, "EEK": true, "LTL": true, "LVL": true, "MTL": true, "ROL": true,
+	"SIT": true, "SKK": true, "TRL": true,
+}
+
+// EUECB provides euro foreign exchange reference rates published by the European Central Bank.
+// All rates are EUR-based (1 EUR = rate XXX).
+type EUECB struct {
+	baseURL    string
+	httpClient *http.Client
+
+	// mu guards rates, newest and loaded (not held while downloading)
+	mu sync.Mutex
+	// rates by date (YYYY-MM-DD) and currency
+	rates map[string]map[Currency]float64
+	// the newest date (YYYY-MM-DD) having rates
+	newest string
+	// feeds already loaded, by the time of loading
+	loaded map[string]time.Time
+	// feedMaxAge is how long a loaded feed is used for dates after the newest rate
+	feedMaxAge time.Duration
+}
+
+// NewEUECB creates a new ecb.europa.eu currency rates provider using feeds at the base URL
+func NewEUECB(baseURL string) *EUECB {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &EUECB{
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		rates:      make(map[string]map[Currency]float64),
+		loaded:     make(map[string]time.Time),
+		feedMaxAge: ecbFeedMaxAge,
+	}
+}
+
+// Name returns the name of the provider
+func (c *EUECB) Name() string {
+	return "ECB.europa.eu"
+}
+
+// AllowsReverse specifies whether the provider allows reversing rates
+// (e.g. for EURUSD use USDEUR)
+func (c *EUECB) AllowsReverse() bool {
+	return true // reference rates are "middle"
+}
+
+// Supports checks whether the provider supports the currency conversion
+func (c *EUECB) Supports(from Currency, to Currency) bool {
+	return from == EUR && ecbCurrencies[to]
+}
+
+// Calendar returns the business-day calendar of the provider
+func (c *EUECB) Calendar() Calendar {
+	return TARGETCalendar
+}
+
+// GetRate gets the currency rate for the specified time. Returns ErrNotAvailable error
+// if the conversion rate for the specified time is not known
+func (c *EUECB) GetRate(from Currency, to Currency, at time.Time) (float64, error) {
+	return c.GetRateContext(context.Background(), from, to, at)
+}
+
+// GetRateContext gets the currency rate like GetRate, stopping when ctx is done
+func (c *EUECB) GetRateContext(ctx context.Context, from Currency, to Currency, at time.Time) (float64, error) {
+	rate, _, err := c.GetRateDatedContext(ctx, from, to, at)
+	return rate, err
+}
+
+// GetRateDated gets the currency rate for the specified time and the date the rate
+// has been published for (the last one published for days without rates)
+func (c *EUECB) GetRateDated(from Currency, to Currency, at time.Time) (float64, time.Time, error) {
+	return c.GetRateDatedContext(context.Background(), from, to, at)
+}
+
+// GetRateDatedContext gets the currency rate like GetRateDated, stopping when ctx is done
+func (c *EUECB) GetRateDatedContext(ctx context.Context, from Currency, to Currency, at time.Time) (float64, time.Time, error) {
+	if from != EUR {
+		return 0, time.Time{}, ErrNotAvailable
+	}
+
+	// try rates already loaded (unless the date is after the newest one,
+	// which could have been published since), then the feed covering the date
+	if c.covers(at) {
+		if rate, date, err := c.findRate(to, at); err == nil {
+			return rate, date, nil
+		}
+	}
+
+	feed := "eurofxref-hist.xml"
+	if time.Since(at) < 80*24*time.Hour {
+		feed = "eurofxref-hist-90d.xml"
+	}
+	if err := c.loadFeed(ctx, feed, at); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return c.findRate(to, at)
+}
+
+// GetRates returns the rates published between start and end (inclusive)
+func (c *EUECB) GetRates(from Currency, to Currency, start time.Time, end time.Time) ([]HistoricalRate, error) {
+	return c.GetRatesContext(context.Background(), from, to, start, end)
+}
+
+// GetRatesContext returns the rates like GetRates, stopping when ctx is done
+func (c *EUECB) GetRatesContext(ctx context.Context, from Currency, to Currency, start time.Time, end time.Time) ([]HistoricalRate, error) {
+	if from != EUR {
+		return nil, ErrNotAvailable
+	}
+
+	feed := "eurofxref-hist.xml"
+	if time.Since(start) < 80*24*time.Hour {
+		feed = "eurofxref-hist-90d.xml"
+	}
+	if err := c.loadFeed(ctx, feed, end); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	startKey, endKey := RateDay(start).Format(ecbDateLayout), RateDay(end).Format(ecbDateLayout)
+
+	var rates []HistoricalRate
+	for date, dayRates := range c.rates {
+		rate, has := dayRates[to]
+		if !has || date < startKey || date > endKey {
+			continue
+		}
+		published, _ := time.Parse(ecbDateLayout, date)
+		rates = append(rates, HistoricalRate{Date: published, From: EUR, To: to, Rate: rate})
+	}
+
+	if len(rates) == 0 {
+		return nil, ErrNotAvailable
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Date.Before(rates[j].Date)
+	})
+	return rates, nil
+}
+
+// covers returns true if rates up to the day of at have been loaded
+func (c *EUECB) covers(at time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return RateDay(at).Format(ecbDateLayout) <= c.newest
+}
+
+// findRate finds the rate published on the date or the last one before it
+func (c *EUECB) findRate(to Currency, at time.Time) (float64, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	for d := day; day.Sub(d) <= MaxRateAge; d = d.AddDate(0, 0, -1) {
+		if dayRates, has := c.rates[d.Format(ecbDateLayout)]; has {
+			if rate, has := dayRates[to]; has {
+				return rate, d, nil
+			}
+			return 0, d, ErrNotAvailable
+		}
+	}
+	return 0, time.Time{}, ErrNotAvailable
+}
+
+// addRate adds a parsed rate
+func (c *EUECB) addRate(date string, to Currency, rate float64) {
+	dayRates, has := c.rates[date]
+	if !has {
+		dayRates = make(map[Currency]float64)
+		c.rates[date] = dayRates
+	}
+	dayRates[to] = rate
+	if date > c.newest {
+		c.newest = date
+	}
+}
+
+// fetch downloads the feed, stopping when ctx is done
+func (c *EUECB) fetch(ctx context.Context, feed string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+feed, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, e("ecb server returned code %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// loadFeed downloads and parses the XML feed unless already loaded and either
+// covering the day of until or loaded less than feedMaxAge ago.
+// The lock is not held while downloading.
+func (c *EUECB) loadFeed(ctx context.Context, feed string, until time.Time) error {
+	c.mu.Lock()
+	loadedAt, loaded := c.loaded[feed]
+	c.mu.Unlock()
+	if loaded && (c.covers(until) || time.Since(loadedAt) < c.feedMaxAge) {
+		return nil
+	}
+
+	data, err := c.fetch(ctx, feed)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.parseXML(bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	c.loaded[feed] = time.Now()
+	return nil
+}
+
+// ecbCube represents the time Cube of the XML feeds
+type ecbCube struct {
+	Time  string `xml:"time,attr"`
+	Rates []struct {
+		Currency string `xml:"currency,attr"`
+		Rate     string `xml:"rate,attr"`
+	} `xml:"Cube"`
+}
+
+// parseXML parses the eurofxref XML feed
+func (c *EUECB) parseXML(reader io.Reader) error {
+	dec := xml.NewDecoder(reader)
+
+	found := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ErrBadFormat
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "Cube" || !hasXMLAttr(se, "time") {
+			continue
+		}
+
+		var cube ecbCube
+		if err := dec.DecodeElement(&cube, &se); err != nil {
+			return ErrBadFormat
+		}
+		if _, err := time.Parse(ecbDateLayout, cube.Time); err != nil {
+			return ErrBadFormat
+		}
+
+		for _, r := range cube.Rates {
+			rate, err := strconv.ParseFloat(r.Rate, 64)
+			if err != nil {
+				return ErrBadFormat
+			}
+			c.addRate(cube.Time, FromString(r.Currency), rate)
+			found = true
+		}
+	}
+
+	if !found {
+		return ErrBadFormat
+	}
+	return nil
+}
+
+func hasXMLAttr(se xml.StartElement, name string) bool {
+	for _, attr := range se.Attr {
+		if attr.Name.Local == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCSV parses the eurofxref historical CSV (Date,USD,JPY,...) and returns
+// the number of rates parsed. Missing rates are marked N/A.
+func (c *EUECB) parseCSV(reader io.Reader) (int, error) {
+	rd := csv.NewReader(reader)
+	rd.FieldsPerRecord = -1
+	rd.TrimLeadingSpace = true
+
+	header, err := rd.Read()
+	if err != nil || len(header) < 2 || header[0] != "Date" {
+		return 0, ErrBadFormat
+	}
+
+	num := 0
+	for {
+		row, err := rd.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return num, ErrBadFormat
+		}
+
+		if _, err := time.Parse(ecbDateLayout, row[0]); err != nil {
+			return num, ErrBadFormat
+		}
+
+		for i := 1; i < len(row) && i < len(header); i++ {
+			code := strings.TrimSpace(header[i])
+			value := strings.TrimSpace(row[i])
+			if len(code) == 0 || len(value) == 0 || value == "N/A" {
+				continue
+			}
+
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return num, ErrBadFormat
+			}
+			c.addRate(row[0], FromString(code), rate)
+			num++
+		}
+	}
+
+	return num, nil
+}
+
+// LoadHistory downloads the complete history of rates (zipped CSV feed)
+// and stores all the EUR-based rates to the sink. Returns the number of stored rates.
+func (c *EUECB) LoadHistory(sink RateSink) (int, error) {
+	data, err := c.fetch(context.Background(), "eurofxref-hist.zip")
+	if err != nil {
+		return 0, err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, ErrBadFormat
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	parsed := false
+	for _, f := range zr.File {
+		if !strings.HasSuffix(strings.ToLower(f.Name), ".csv") {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return 0, err
+		}
+		_, err = c.parseCSV(rc)
+		rc.Close()
+		if err != nil {
+			return 0, err
+		}
+		parsed = true
+	}
+	if !parsed {
+		return 0, ErrBadFormat
+	}
+	c.loaded["eurofxref-hist.xml"] = time.Now()
+
+	// store sorted by date and currency
+	var dates []string
+	for date := range c.rates {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	var rates []HistoricalRate
+	for _, date := range dates {
+		at, _ := time.Parse(ecbDateLayout, date)
+		first := len(rates)
+		for cur, rate := range c.rates[date] {
+			rates = append(rates, HistoricalRate{Date: at, From: EUR, To: cur, Rate: rate})
+		}
+		dayRates := rates[first:]
+		sort.Slice(dayRates, func(i, j int) bool { return dayRates[i].To < dayRates[j].To })
+	}
+
+	if err := sink.StoreCurrencyMultipliers(rates); err != nil {
+		return 0, err
+	}
+
+	return len(rates), nil
+}
+
+func init() {
+	RegisterProvider(NewEUECB(ECBBaseURL))
+}
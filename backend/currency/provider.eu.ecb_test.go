@@ -0,0 +1,195 @@
+package currency
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newECBTestServer serves the recorded feed fixtures and counts the requests
+func newECBTestServer(t *testing.T, requests map[string]int) *httptest.Server {
+	fixtures := map[string]string{
+		"/eurofxref-daily.xml":    "provider.eu.ecb_test_daily.xml",
+		"/eurofxref-hist-90d.xml": "provider.eu.ecb_test_daily.xml",
+		"/eurofxref-hist.xml":     "provider.eu.ecb_test_hist.xml",
+	}
+
+	csvData, err := ioutil.ReadFile("provider.eu.ecb_test_hist.csv")
+	require.Nil(t, err)
+
+	var zipData bytes.Buffer
+	zw := zip.NewWriter(&zipData)
+	f, err := zw.Create("eurofxref-hist.csv")
+	require.Nil(t, err)
+	_, err = f.Write(csvData)
+	require.Nil(t, err)
+	require.Nil(t, zw.Close())
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+
+		if r.URL.Path == "/eurofxref-hist.zip" {
+			w.Write(zipData.Bytes())
+			return
+		}
+
+		fixture, ok := fixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+func TestEUECB(t *testing.T) {
+	requests := make(map[string]int)
+	srv := newECBTestServer(t, requests)
+	defer srv.Close()
+
+	ecb := NewEUECB(srv.URL)
+	require.True(t, ecb.Supports(EUR, USD))
+	require.True(t, ecb.Supports(EUR, CZK))
+	require.False(t, ecb.Supports(USD, CZK))
+	require.False(t, ecb.Supports(EUR, Currency("XXX")))
+	require.Empty(t, requests)
+
+	// exact date
+	rate, err := ecb.GetRate(EUR, CZK, time.Date(2020, 3, 5, 15, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, 25.405, rate)
+
+	// weekend uses the last published rate
+	rate, err = ecb.GetRate(EUR, USD, time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, 1.0977, rate)
+
+	// history loaded only once
+	rate, err = ecb.GetRate(EUR, GBP, time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, 0.86783, rate)
+	require.Equal(t, 1, requests["/eurofxref-hist.xml"])
+
+	// too old
+	_, err = ecb.GetRate(EUR, USD, time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, ErrNotAvailable, err)
+
+	// only EUR-based
+	_, err = ecb.GetRate(USD, CZK, time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, ErrNotAvailable, err)
+}
+
+func TestEUECBNewlyPublished(t *testing.T) {
+	yesterday := RateDay(time.Now()).AddDate(0, 0, -1)
+	today := yesterday.AddDate(0, 0, 1)
+
+	// the 90-day feed publishes today's rate after it has been loaded
+	var cubes string
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `<Envelope><Cube>%s</Cube></Envelope>`, cubes)
+	}))
+	defer srv.Close()
+
+	cube := func(day time.Time, rate string) string {
+		return fmt.Sprintf(`<Cube time="%s"><Cube currency="CZK" rate="%s"/></Cube>`, day.Format(ecbDateLayout), rate)
+	}
+	cubes = cube(yesterday, "25.1")
+
+	ecb := NewEUECB(srv.URL)
+	rate, date, err := ecb.GetRateDated(EUR, CZK, today)
+	require.Nil(t, err)
+	require.Equal(t, 25.1, rate)
+	require.True(t, date.Equal(yesterday))
+
+	// the feed loaded recently is not downloaded again
+	_, _, err = ecb.GetRateDated(EUR, CZK, today)
+	require.Nil(t, err)
+	require.Equal(t, 1, requests)
+
+	// the expired feed is downloaded again for dates after its newest rate
+	cubes = cube(today, "25.2") + cube(yesterday, "25.1")
+	ecb.feedMaxAge = 0
+	rate, date, err = ecb.GetRateDated(EUR, CZK, today)
+	require.Nil(t, err)
+	require.Equal(t, 25.2, rate)
+	require.True(t, date.Equal(today))
+	require.Equal(t, 2, requests)
+
+	// but not for the dates it covers
+	rate, _, err = ecb.GetRateDated(EUR, CZK, yesterday)
+	require.Nil(t, err)
+	require.Equal(t, 25.1, rate)
+	require.Equal(t, 2, requests)
+}
+
+type testRateSink map[string]float64
+
+func (s testRateSink) StoreCurrencyMultipliers(rates []HistoricalRate) error {
+	for _, r := range rates {
+		s[r.Date.Format("2006-01-02")+" "+r.From.String()+r.To.String()] = r.Rate
+	}
+	return nil
+}
+
+func TestEUECBLoadHistory(t *testing.T) {
+	requests := make(map[string]int)
+	srv := newECBTestServer(t, requests)
+	defer srv.Close()
+
+	ecb := NewEUECB(srv.URL)
+	sink := make(testRateSink)
+
+	num, err := ecb.LoadHistory(sink)
+	require.Nil(t, err)
+	require.Equal(t, 21, num)
+	require.Len(t, sink, 21)
+	require.Equal(t, 0.585274, sink["2007-12-31 EURCYP"])
+	require.Equal(t, 1.1336, sink["2020-03-06 EURUSD"])
+	_, has := sink["2020-03-06 EURCYP"]
+	require.False(t, has)
+
+	// loaded history is used for rates as well
+	rate, err := ecb.GetRate(EUR, JPY, time.Date(2008, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, 164.93, rate)
+	require.Equal(t, 0, requests["/eurofxref-hist.xml"])
+}
+
+func TestEUECBFetchUnlocked(t *testing.T) {
+	release := make(chan struct{})
+	fetching := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetching <- struct{}{}
+		<-release
+		http.ServeFile(w, r, "provider.eu.ecb_test_hist.xml")
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ecb := NewEUECB(srv.URL)
+	at := time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC)
+	go ecb.GetRate(EUR, CZK, at)
+	<-fetching
+
+	// other requests are not blocked by the download in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ecb.GetRateContext(ctx, EUR, CZK, at)
+	require.Equal(t, context.Canceled, errors.Unwrap(err))
+}
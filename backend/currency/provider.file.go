@@ -0,0 +1,254 @@
+package currency
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileDateLayout is the date format of rate dates in CSV and JSON files
+const fileDateLayout = "2006-01-02"
+
+// fileRate is a rate record of CSV and JSON files
+type fileRate struct {
+	Date string
+	From Currency
+	To   Currency
+	Rate float64
+}
+
+// FileProvider provides rates loaded from local files, allowing reproducible
+// computations and offline runs. Supported files are:
+//   - CNB daily files (denni_kurz.txt) and CNB yearly files (rok.txt), e.g. archived snapshots
+//   - CSV files with Date,From,To,Rate header (date as YYYY-MM-DD)
+//   - JSON arrays of {"Date": "YYYY-MM-DD", "From": "USD", "To": "CZK", "Rate": 21.5}
+type FileProvider struct {
+	mu sync.RWMutex
+	// rates by date (YYYY-MM-DD) and pair
+	rates map[string]map[currencyPairType]float64
+	pairs map[currencyPairType]bool
+}
+
+// NewFileProvider creates a provider of rates from the files or directories (loaded recursively)
+func NewFileProvider(paths ...string) (*FileProvider, error) {
+	p := &FileProvider{
+		rates: make(map[string]map[currencyPairType]float64),
+		pairs: make(map[currencyPairType]bool),
+	}
+	for _, path := range paths {
+		if err := p.Load(path); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Name returns the name of the provider
+func (p *FileProvider) Name() string {
+	return "file"
+}
+
+// AllowsReverse specifies whether the provider allows reversing rates
+// (e.g. for EURUSD use USDEUR)
+func (p *FileProvider) AllowsReverse() bool {
+	return true
+}
+
+// Supports checks whether the provider supports the currency conversion
+func (p *FileProvider) Supports(from Currency, to Currency) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pairs[currencyPair(from, to)]
+}
+
+// GetRate gets the currency rate for the specified time. Returns ErrNotAvailable error
+// if the conversion rate for the specified time is not known
+func (p *FileProvider) GetRate(from Currency, to Currency, at time.Time) (float64, error) {
+	rate, _, err := p.GetRateDated(from, to, at)
+	return rate, err
+}
+
+// GetRateDated gets the rate of the day or the last one known within MaxRateAge before
+// and the date of the rate
+func (p *FileProvider) GetRateDated(from Currency, to Currency, at time.Time) (float64, time.Time, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	pair := currencyPair(from, to)
+	day := RateDay(at)
+	for d := day; day.Sub(d) <= MaxRateAge; d = d.AddDate(0, 0, -1) {
+		if rate, has := p.rates[d.Format(fileDateLayout)][pair]; has {
+			return rate, d, nil
+		}
+	}
+	return 0, time.Time{}, ErrNotAvailable
+}
+
+// GetRates returns the rates known between start and end (inclusive)
+func (p *FileProvider) GetRates(from Currency, to Currency, start time.Time, end time.Time) ([]HistoricalRate, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	pair := currencyPair(from, to)
+	startKey, endKey := RateDay(start).Format(fileDateLayout), RateDay(end).Format(fileDateLayout)
+
+	var rates []HistoricalRate
+	for date, dayRates := range p.rates {
+		rate, has := dayRates[pair]
+		if !has || date < startKey || date > endKey {
+			continue
+		}
+		day, _ := time.Parse(fileDateLayout, date)
+		rates = append(rates, HistoricalRate{Date: day, From: from, To: to, Rate: rate})
+	}
+
+	if len(rates) == 0 {
+		return nil, ErrNotAvailable
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Date.Before(rates[j].Date)
+	})
+	return rates, nil
+}
+
+// Load loads rates from the file or all the files of the directory (recursively)
+func (p *FileProvider) Load(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return p.loadFile(path)
+	}
+
+	return filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(filePath)) {
+		case ".txt", ".csv", ".json":
+			return p.loadFile(filePath)
+		}
+		return nil
+	})
+}
+
+// loadFile loads the rate file of any supported format
+func (p *FileProvider) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = p.loadJSON(bytes.NewReader(data))
+	case ".csv":
+		err = p.loadCSV(bytes.NewReader(data))
+	default:
+		err = p.loadCNB(data)
+	}
+
+	if err != nil {
+		return e("unable to load rates from %s: %s", path, err)
+	}
+	return nil
+}
+
+// loadCNB loads a CNB daily or yearly file
+func (p *FileProvider) loadCNB(data []byte) error {
+	if bytes.HasPrefix(data, []byte("Datum|")) {
+		year, err := parseCNBYear(bufio.NewScanner(bytes.NewReader(data)))
+		if err != nil {
+			return err
+		}
+		for date, dayRates := range year {
+			for cur, rate := range dayRates {
+				p.add(date, cur, CZK, rate)
+			}
+		}
+		return nil
+	}
+
+	issued, rates, _, err := parseCNBDaily(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for cur, rate := range rates {
+		p.add(issued.Format(fileDateLayout), cur, CZK, rate)
+	}
+	return nil
+}
+
+// loadJSON loads a JSON array of rates
+func (p *FileProvider) loadJSON(reader io.Reader) error {
+	var rates []fileRate
+	if err := json.NewDecoder(reader).Decode(&rates); err != nil {
+		return err
+	}
+	return p.addFileRates(rates)
+}
+
+// loadCSV loads CSV with Date,From,To,Rate header
+func (p *FileProvider) loadCSV(reader io.Reader) error {
+	rd := csv.NewReader(reader)
+	rd.TrimLeadingSpace = true
+
+	records, err := rd.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != "Date,From,To,Rate" {
+		return ErrBadFormat
+	}
+
+	var rates []fileRate
+	for _, rec := range records[1:] {
+		rate, err := strconv.ParseFloat(rec[3], 64)
+		if err != nil {
+			return ErrBadFormat
+		}
+		rates = append(rates, fileRate{rec[0], FromString(rec[1]), FromString(rec[2]), rate})
+	}
+	return p.addFileRates(rates)
+}
+
+func (p *FileProvider) addFileRates(rates []fileRate) error {
+	for _, r := range rates {
+		if _, err := time.Parse(fileDateLayout, r.Date); err != nil || r.Rate <= 0 {
+			return ErrBadFormat
+		}
+		p.add(r.Date, r.From, r.To, r.Rate)
+	}
+	return nil
+}
+
+// add adds the rate for the date (YYYY-MM-DD)
+func (p *FileProvider) add(date string, from Currency, to Currency, rate float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pair := currencyPair(from, to)
+	dayRates, has := p.rates[date]
+	if !has {
+		dayRates = make(map[currencyPairType]float64)
+		p.rates[date] = dayRates
+	}
+	dayRates[pair] = rate
+	p.pairs[pair] = true
+}
@@ -0,0 +1,78 @@
+package currency
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "rates.csv"),
+		[]byte("Date,From,To,Rate\n2020-01-10,EUR,USD,1.1091\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "rates.json"),
+		[]byte(`[{"Date": "2020-01-10", "From": "GBP", "To": "CZK", "Rate": 29.6}]`), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ignored.md"), []byte("# notes"), 0644))
+
+	p, err := NewFileProvider(dir, "provider.cz.cnb_test_rok.txt", "provider.file_test_denni_kurz.txt")
+	require.Nil(t, err)
+
+	require.True(t, p.Supports(USD, CZK))
+	require.True(t, p.Supports(EUR, USD))
+	require.False(t, p.Supports(CZK, USD))
+
+	// CNB daily file
+	rate, err := p.GetRate(JPY, CZK, time.Date(2020, 1, 9, 10, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.InDelta(t, 0.20873, rate, 1e-9)
+
+	// CNB yearly file, weekend uses the last rate
+	rate, rateDate, err := p.GetRateDated(EUR, CZK, time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, 25.36, rate)
+	require.Equal(t, time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), rateDate)
+
+	// CSV and JSON
+	rate, err = p.GetRate(EUR, USD, time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, 1.1091, rate)
+	rate, err = p.GetRate(GBP, CZK, time.Date(2020, 1, 11, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, 29.6, rate)
+
+	_, err = p.GetRate(USD, CZK, time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, ErrNotAvailable, err)
+
+	rates, err := p.GetRates(USD, CZK, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Len(t, rates, 6)
+	require.Equal(t, 22.767, rates[5].Rate)
+}
+
+func TestFileProviderOffline(t *testing.T) {
+	p, err := NewFileProvider("provider.file_test_denni_kurz.txt")
+	require.Nil(t, err)
+	withTestProviders(t, p)
+
+	// cross rate from a single CNB file
+	conv, err := ConvertDetailed(22.767, USD, EUR, time.Date(2020, 1, 9, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.InDelta(t, 22.767/25.27, conv.Converted/22.767, 1e-9)
+	require.Len(t, conv.Legs, 2)
+	require.Equal(t, "file", conv.Legs[0].Provider)
+}
+
+func TestFileProviderBadFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rates.csv")
+	require.Nil(t, ioutil.WriteFile(path, []byte("When,Rate\n2020-01-10,1.1\n"), 0644))
+
+	_, err := NewFileProvider(path)
+	require.NotNil(t, err)
+
+	_, err = NewFileProvider(filepath.Join(dir, "missing.json"))
+	require.NotNil(t, err)
+}
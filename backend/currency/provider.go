@@ -1,6 +1,7 @@
 package currency
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"time"
@@ -17,6 +18,10 @@ var (
 	ErrOldData      = e("provider received old data")
 )
 
+// MaxRateAge is the maximal age of the last published rate used for days
+// without a published rate (weekends, holidays)
+const MaxRateAge = 5 * 24 * time.Hour
+
 // Provider provides a currency conversion
 type Provider interface {
 	// Name returns the name of the provider
@@ -33,6 +38,16 @@ type Provider interface {
 	GetRate(from Currency, to Currency, at time.Time) (float64, error)
 }
 
+// ContextProvider is a Provider able to stop fetching rates when the context
+// is canceled or its deadline is exceeded
+type ContextProvider interface {
+	// GetRateContext gets the currency rate like GetRate
+	GetRateContext(ctx context.Context, from Currency, to Currency, at time.Time) (float64, error)
+	// GetRateDatedContext gets the currency rate and the date the rate
+	// has been published for like DatedProvider.GetRateDated
+	GetRateDatedContext(ctx context.Context, from Currency, to Currency, at time.Time) (float64, time.Time, error)
+}
+
 // Providers holds all available currency rate providers
 var Providers []Provider
 
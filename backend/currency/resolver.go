@@ -0,0 +1,248 @@
+package currency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/utils"
+)
+
+// Resolver converts currencies selecting providers for currency pairs. It remembers
+// the provider working for each pair and skips providers failing for the pair until
+// they are re-probed. It is safe for concurrent use.
+type Resolver struct {
+	// Fallback is the policy for days without a published rate (the package Fallback if empty)
+	Fallback FallbackPolicy
+	// Selector tracks selected providers and their health per pair
+	Selector *utils.ProviderSelector
+
+	// providers used (registered Providers if nil)
+	providers []Provider
+}
+
+var (
+	defaultResolver   = NewResolver()
+	defaultResolverMu sync.RWMutex
+)
+
+// NewResolver creates a resolver using the providers in the order of preference.
+// The registered Providers are used if none are specified.
+func NewResolver(providers ...Provider) *Resolver {
+	return &Resolver{
+		Selector:  utils.NewProviderSelector(),
+		providers: providers,
+	}
+}
+
+// DefaultResolver returns the resolver used by the package-level functions
+func DefaultResolver() *Resolver {
+	defaultResolverMu.RLock()
+	defer defaultResolverMu.RUnlock()
+	return defaultResolver
+}
+
+// SetDefaultResolver replaces the resolver used by the package-level functions
+func SetDefaultResolver(r *Resolver) {
+	defaultResolverMu.Lock()
+	defer defaultResolverMu.Unlock()
+	defaultResolver = r
+}
+
+// Providers returns the providers used by the resolver
+func (r *Resolver) Providers() []Provider {
+	if r.providers != nil {
+		return r.providers
+	}
+	return Providers
+}
+
+// providerByName returns the provider of the name or nil if not used by the resolver
+func (r *Resolver) providerByName(name string) Provider {
+	for _, provider := range r.Providers() {
+		if provider.Name() == name {
+			return provider
+		}
+	}
+	return nil
+}
+
+// policy returns the fallback policy used
+func (r *Resolver) policy() FallbackPolicy {
+	if len(r.Fallback) > 0 {
+		return r.Fallback
+	}
+	return Fallback
+}
+
+// Health returns the health of the provider for the currency pair
+func (r *Resolver) Health(from Currency, to Currency, provider Provider) utils.ProviderHealth {
+	return r.Selector.Health(string(currencyPair(from, to)), provider)
+}
+
+// Convert converts currency according to rates known for the specified time
+// (see the package-level Convert)
+func (r *Resolver) Convert(amount float64, from Currency, to Currency, at time.Time) (float64, error) {
+	return r.ConvertContext(context.Background(), amount, from, to, at)
+}
+
+// ConvertContext converts currency like Convert, stopping when ctx is done
+func (r *Resolver) ConvertContext(ctx context.Context, amount float64, from Currency, to Currency, at time.Time) (float64, error) {
+	conv, err := r.ConvertDetailedContext(ctx, amount, from, to, at)
+	if err != nil {
+		return 0, err
+	}
+	return conv.Converted, nil
+}
+
+// ConvertDetailed converts currency like Convert and reports the legs
+// and providers used for the conversion
+func (r *Resolver) ConvertDetailed(amount float64, from Currency, to Currency, at time.Time) (*Conversion, error) {
+	return r.ConvertDetailedContext(context.Background(), amount, from, to, at)
+}
+
+// ConvertDetailedContext converts currency like ConvertDetailed, stopping when ctx is done
+func (r *Resolver) ConvertDetailedContext(ctx context.Context, amount float64, from Currency, to Currency, at time.Time) (*Conversion, error) {
+	conv := &Conversion{
+		Amount: amount,
+		From:   from,
+		To:     to,
+		At:     at,
+		Rate:   1,
+	}
+
+	// check identity
+	if from == to {
+		conv.Converted = amount
+		return conv, nil
+	}
+
+	// direct conversion
+	leg, err := r.convertLeg(ctx, from, to, at)
+	if err == nil {
+		conv.setLegs([]ConversionLeg{*leg})
+		return conv, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// cross rates, shortest paths first
+	failed := make(map[currencyPairType]bool)
+	failed[currencyPair(from, to)] = true
+
+	for numLegs := 2; numLegs <= maxLegs; numLegs++ {
+		for _, path := range pivotPaths(from, to, numLegs-1) {
+			legs, legErr := r.convertPath(ctx, path, at, failed)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if legErr != nil {
+				if err == nil || err == ErrNotAvailable {
+					err = legErr
+				}
+				continue
+			}
+
+			conv.setLegs(legs)
+			return conv, nil
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return nil, ErrNotAvailable
+}
+
+// convertPath converts through all the currencies of the path.
+// Pairs known to fail are remembered in failed.
+func (r *Resolver) convertPath(ctx context.Context, path []Currency, at time.Time, failed map[currencyPairType]bool) ([]ConversionLeg, error) {
+	var legs []ConversionLeg
+	for i := 1; i < len(path); i++ {
+		pair := currencyPair(path[i-1], path[i])
+		if failed[pair] {
+			return nil, ErrNotAvailable
+		}
+
+		leg, err := r.convertLeg(ctx, path[i-1], path[i], at)
+		if err != nil {
+			failed[pair] = true
+			return nil, err
+		}
+		legs = append(legs, *leg)
+	}
+	return legs, nil
+}
+
+// isProviderFailure returns true if the error means the provider is not working
+// (as opposed to the rate not being published)
+func isProviderFailure(err error) bool {
+	return err != nil && err != ErrNotAvailable && err != ErrNotBusinessDay && err != ErrOldData
+}
+
+// convertLeg finds the rate for the direct conversion using the selected provider
+// or the first working one. Providers are not marked failed when ctx is done.
+func (r *Resolver) convertLeg(ctx context.Context, from Currency, to Currency, at time.Time) (*ConversionLeg, error) {
+	policy := r.policy()
+	key := string(currencyPair(from, to))
+
+	providers := r.Providers()
+	candidates := make([]interface{}, len(providers))
+	for i, p := range providers {
+		candidates[i] = p
+	}
+
+	var err error
+	for _, i := range r.Selector.Order(key, candidates) {
+		provider := providers[i]
+
+		var leg *ConversionLeg
+		if provider.Supports(from, to) {
+			leg, err = providerLeg(ctx, provider, policy, from, to, at, false)
+		} else if provider.AllowsReverse() && provider.Supports(to, from) {
+			leg, err = providerLeg(ctx, provider, policy, from, to, at, true)
+		} else {
+			continue
+		}
+
+		if err == nil {
+			r.Selector.Succeeded(key, provider)
+			return leg, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if isProviderFailure(err) {
+			r.Selector.Failed(key, provider, err)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	// all the providers of the pair are skipped for failing
+	if err := r.Selector.LastError(key); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrNotAvailable
+}
+
+// rangeProviderFor returns the first range provider supporting the pair
+// and whether its reversed rates are needed
+func (r *Resolver) rangeProviderFor(from Currency, to Currency) (RangeProvider, bool) {
+	for _, provider := range r.Providers() {
+		rp, ok := provider.(RangeProvider)
+		if !ok {
+			continue
+		}
+		if provider.Supports(from, to) {
+			return rp, false
+		}
+		if provider.AllowsReverse() && provider.Supports(to, from) {
+			return rp, true
+		}
+	}
+	return nil, false
+}
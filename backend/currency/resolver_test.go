@@ -0,0 +1,177 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyProvider fails with err while it is set
+type flakyProvider struct {
+	testProvider
+
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (p *flakyProvider) GetRate(from Currency, to Currency, at time.Time) (float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.err != nil {
+		return 0, p.err
+	}
+	return p.testProvider.GetRate(from, to, at)
+}
+
+func (p *flakyProvider) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func (p *flakyProvider) numCalls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func TestResolverHealth(t *testing.T) {
+	at := time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC)
+	now := at
+
+	primary := &flakyProvider{testProvider: testProvider{name: "primary", to: CZK, rates: map[Currency]float64{USD: 20}}}
+	backup := &testProvider{name: "backup", to: CZK, rates: map[Currency]float64{USD: 22}}
+
+	r := NewResolver(primary, backup)
+	r.Selector.Now = func() time.Time { return now }
+
+	conv, err := r.ConvertDetailed(1, USD, CZK, at)
+	require.Nil(t, err)
+	require.Equal(t, "primary", conv.Legs[0].Provider)
+
+	// failing provider is skipped until re-probed
+	primary.setErr(errors.New("connection refused"))
+	conv, err = r.ConvertDetailed(1, USD, CZK, at)
+	require.Nil(t, err)
+	require.Equal(t, "backup", conv.Legs[0].Provider)
+	require.Equal(t, 1, r.Health(USD, CZK, primary).Failures)
+
+	primary.setErr(nil)
+	calls := primary.numCalls()
+	conv, err = r.ConvertDetailed(1, USD, CZK, at)
+	require.Nil(t, err)
+	require.Equal(t, "backup", conv.Legs[0].Provider)
+	require.Equal(t, calls, primary.numCalls())
+
+	// re-probed after RetryAfter, backup stays selected until TTL expires
+	now = now.Add(r.Selector.RetryAfter)
+	conv, err = r.ConvertDetailed(1, USD, CZK, at)
+	require.Nil(t, err)
+	require.Equal(t, "backup", conv.Legs[0].Provider)
+
+	now = now.Add(r.Selector.TTL + time.Second)
+	conv, err = r.ConvertDetailed(1, USD, CZK, at)
+	require.Nil(t, err)
+	require.Equal(t, "primary", conv.Legs[0].Provider)
+	require.True(t, r.Health(USD, CZK, primary).Healthy())
+
+	// missing rates do not count as failures
+	_, err = r.Convert(1, GBP, CZK, at)
+	require.Equal(t, ErrNotAvailable, err)
+	require.True(t, r.Health(GBP, CZK, primary).Healthy())
+}
+
+func TestResolverSkippedProvider(t *testing.T) {
+	at := time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC)
+	only := &flakyProvider{testProvider: testProvider{name: "only", to: CZK, rates: map[Currency]float64{USD: 20}}}
+	r := NewResolver(only)
+
+	// a transient error doesn't make the provider skipped
+	only.setErr(errors.New("connection reset"))
+	_, err := r.Convert(1, USD, CZK, at)
+	require.EqualError(t, err, "connection reset")
+	only.setErr(nil)
+	_, err = r.Convert(1, USD, CZK, at)
+	require.Nil(t, err)
+
+	// the error of the provider skipped for failing repeatedly is returned
+	only.setErr(errors.New("connection refused"))
+	for i := 0; i < r.Selector.MaxFailures; i++ {
+		_, err = r.Convert(1, USD, CZK, at)
+		require.EqualError(t, err, "connection refused")
+	}
+	calls := only.numCalls()
+	_, err = r.Convert(1, USD, CZK, at)
+	require.EqualError(t, err, "connection refused")
+	require.Equal(t, calls, only.numCalls())
+}
+
+func TestResolverConcurrent(t *testing.T) {
+	at := time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	flaky := &flakyProvider{testProvider: testProvider{name: "flaky", to: CZK, rates: map[Currency]float64{USD: 20, EUR: 25}}}
+	stable := &testProvider{name: "stable", to: CZK, rates: map[Currency]float64{USD: 20, EUR: 25}}
+
+	r := NewResolver(flaky, stable)
+	cc := NewCachingConverter(nil, 16)
+	cc.Resolver = r
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if j%10 == 0 {
+					if i%2 == 0 {
+						flaky.setErr(errors.New("timeout"))
+					} else {
+						flaky.setErr(nil)
+					}
+				}
+
+				amount, err := r.Convert(1, EUR, USD, at.AddDate(0, 0, -j%5))
+				require.Nil(t, err)
+				require.InDelta(t, 1.25, amount, 1e-9)
+
+				amount, err = cc.Convert(2, USD, CZK, at)
+				require.Nil(t, err)
+				require.InDelta(t, 40, amount, 1e-9)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestResolverContext(t *testing.T) {
+	at := time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	prov := &flakyProvider{testProvider: testProvider{name: "flaky", to: CZK, rates: map[Currency]float64{USD: 20}}}
+	r := NewResolver(prov)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := r.ConvertContext(ctx, 1, USD, CZK, at)
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, 0, prov.numCalls())
+	require.True(t, r.Health(USD, CZK, prov).Healthy())
+
+	// canceled conversions are not cached as failed
+	cc := NewCachingConverter(nil, 16)
+	cc.Resolver = r
+	_, err = cc.ConvertContext(ctx, 1, USD, CZK, at)
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, 0, cc.Len())
+
+	amount, err := cc.ConvertContext(context.Background(), 2, USD, CZK, at)
+	require.Nil(t, err)
+	require.Equal(t, 40.0, amount)
+}
@@ -0,0 +1,110 @@
+package currency
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ConvertFunc converts amount between currencies at the specified time
+type ConvertFunc func(amount float64, from Currency, to Currency, at time.Time) (float64, error)
+
+type uniformRateKey struct {
+	year     int
+	from, to Currency
+}
+
+// UniformRate holds a yearly uniform rate of a currency pair
+type UniformRate struct {
+	Year int
+	From Currency
+	To   Currency
+	Rate float64
+}
+
+// UniformRates converts currencies at yearly uniform rates (Czech "jednotný kurz").
+// Published rates can be set explicitly, otherwise they are computed
+// as the average of the rates valid on the last day of each month of the year.
+// For the current year, just the month ends already passed are averaged.
+type UniformRates struct {
+	// Now returns the current time (replaceable in tests)
+	Now func() time.Time
+
+	convert ConvertFunc
+	rates   map[uniformRateKey]float64
+}
+
+// NewUniformRates creates uniform rates computing missing rates using the convert function
+// (e.g. Convert or a caching converter)
+func NewUniformRates(convert ConvertFunc) *UniformRates {
+	return &UniformRates{
+		Now:     time.Now,
+		convert: convert,
+		rates:   make(map[uniformRateKey]float64),
+	}
+}
+
+// LoadUniformRates loads JSON array of published uniform rates
+func LoadUniformRates(reader io.Reader) ([]*UniformRate, error) {
+	var rates []*UniformRate
+	if err := json.NewDecoder(reader).Decode(&rates); err != nil {
+		return nil, e("unable to decode uniform rates: %s", err)
+	}
+	return rates, nil
+}
+
+// Set sets the published uniform rate for the year
+func (u *UniformRates) Set(rate *UniformRate) {
+	u.rates[uniformRateKey{rate.Year, rate.From, rate.To}] = rate.Rate
+}
+
+// Rate returns the uniform rate for the year
+func (u *UniformRates) Rate(year int, from Currency, to Currency) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	if rate, has := u.rates[uniformRateKey{year, from, to}]; has {
+		return rate, nil
+	}
+	if rate, has := u.rates[uniformRateKey{year, to, from}]; has && rate != 0 {
+		return 1 / rate, nil
+	}
+
+	// average of the month-end rates published so far (the rate of today may not be yet)
+	now := u.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	sum := 0.0
+	months := 0
+	for month := time.January; month <= time.December; month++ {
+		lastDay := time.Date(year, month+1, 0, 12, 0, 0, 0, time.UTC)
+		if !lastDay.Before(today) {
+			break
+		}
+		rate, err := u.convert(1.0, from, to, lastDay)
+		if err != nil {
+			return 0, err
+		}
+		sum += rate
+		months++
+	}
+	if months == 0 {
+		return 0, ErrNotAvailable
+	}
+	rate := sum / float64(months)
+
+	// the average of an unfinished year changes with the next month end
+	if months == 12 {
+		u.rates[uniformRateKey{year, from, to}] = rate
+	}
+	return rate, nil
+}
+
+// Convert converts the amount at the uniform rate of the year of the time specified
+func (u *UniformRates) Convert(amount float64, from Currency, to Currency, at time.Time) (float64, error) {
+	rate, err := u.Rate(at.Year(), from, to)
+	if err != nil {
+		return 0, err
+	}
+	return amount * rate, nil
+}
@@ -0,0 +1,68 @@
+package currency
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniformRates(t *testing.T) {
+	var asked []time.Time
+	u := NewUniformRates(func(amount float64, from Currency, to Currency, at time.Time) (float64, error) {
+		asked = append(asked, at)
+		return amount * float64(at.Month()), nil
+	})
+
+	// average of 1..12
+	rate, err := u.Rate(2020, USD, CZK)
+	require.Nil(t, err)
+	require.Equal(t, 6.5, rate)
+	require.Len(t, asked, 12)
+	require.Equal(t, 29, asked[1].Day())
+	require.Equal(t, 31, asked[11].Day())
+
+	// computed only once
+	converted, err := u.Convert(10, USD, CZK, time.Date(2020, 5, 5, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.Equal(t, 65.0, converted)
+	require.Len(t, asked, 12)
+
+	// published
+	rates, err := LoadUniformRates(strings.NewReader(`[{"Year":2021,"From":"USD","To":"CZK","Rate":21.72}]`))
+	require.Nil(t, err)
+	u.Set(rates[0])
+
+	converted, err = u.Convert(10, CZK, USD, time.Date(2021, 5, 5, 0, 0, 0, 0, time.UTC))
+	require.Nil(t, err)
+	require.InDelta(t, 10/21.72, converted, 1e-9)
+	require.Len(t, asked, 12)
+}
+
+func TestUniformRatesCurrentYear(t *testing.T) {
+	var asked []time.Time
+	u := NewUniformRates(func(amount float64, from Currency, to Currency, at time.Time) (float64, error) {
+		asked = append(asked, at)
+		return amount * float64(at.Month()), nil
+	})
+	u.Now = func() time.Time { return time.Date(2021, 3, 31, 10, 0, 0, 0, time.UTC) }
+
+	// the march rate is not published yet
+	rate, err := u.Rate(2021, USD, CZK)
+	require.Nil(t, err)
+	require.Equal(t, 1.5, rate)
+	require.Len(t, asked, 2)
+
+	// not cached until the year is over
+	u.Now = func() time.Time { return time.Date(2021, 4, 1, 10, 0, 0, 0, time.UTC) }
+	rate, err = u.Rate(2021, USD, CZK)
+	require.Nil(t, err)
+	require.Equal(t, 2.0, rate)
+	require.Len(t, asked, 5)
+
+	// nothing published yet
+	u.Now = func() time.Time { return time.Date(2022, 1, 15, 10, 0, 0, 0, time.UTC) }
+	_, err = u.Rate(2022, USD, CZK)
+	require.Equal(t, ErrNotAvailable, err)
+}
@@ -0,0 +1,380 @@
+package importers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/utils"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// CSVMappingColumns maps Transaction fields to CSV column names.
+// Only Time and either Type or Reference (with type rules) are required.
+type CSVMappingColumns struct {
+	Time        string `json:"time"`
+	Type        string `json:"type"`
+	Item        string `json:"item"`
+	Quantity    string `json:"quantity"`
+	Price       string `json:"price"`
+	NetTotal    string `json:"netTotal"`
+	Currency    string `json:"currency"`
+	Fee         string `json:"fee"`
+	FeeCurrency string `json:"feeCurrency"`
+	Reference   string `json:"reference"`
+}
+
+// CSVMappingTypeRule maps text matching the regular expression to the transaction type
+type CSVMappingTypeRule struct {
+	// Column to match (column name, defaults to the reference column)
+	Column string `json:"column"`
+	// Match is a regular expression the column value must match
+	Match string `json:"match"`
+	// Type is the resulting transaction type (e.g. TTBuy)
+	Type TransactionType `json:"type"`
+
+	re *regexp.Regexp
+}
+
+// CSVMapping describes a CSV export of a broker.
+// It is loaded from JSON by LoadCSVMapping.
+type CSVMapping struct {
+	// Name of the importer (used for --format)
+	Name string `json:"name"`
+	// Detect lists strings which all must be present in the beginning of the file
+	// for the importer to be detected
+	Detect []string `json:"detect"`
+	// Delimiter is the column delimiter (default ',')
+	Delimiter string `json:"delimiter"`
+	// Encoding is a charmap name (e.g. "Windows 1250"), UTF-8 is used if empty
+	Encoding string `json:"encoding"`
+	// DateLayout is the Go time layout of the time column (e.g. "02.01.2006 15:04")
+	DateLayout string `json:"dateLayout"`
+	// TimeZone is the location of times in the file (e.g. "Europe/Prague"), UTC if empty
+	TimeZone string `json:"timeZone"`
+	// Decimal is the number format - "cz" for "1 234,56" or "computer" (default) for "1234.56"
+	Decimal string `json:"decimal"`
+	// Default currency used if there is no currency column or it is empty
+	Currency currency.Currency `json:"currency"`
+	// Columns maps transaction fields to column names
+	Columns CSVMappingColumns `json:"columns"`
+	// Types are rules deciding transaction type, the first matching rule wins
+	Types []*CSVMappingTypeRule `json:"types"`
+	// Skip lists regular expressions, rows having any column matching one of them are skipped
+	// (e.g. sum lines)
+	Skip []string `json:"skip"`
+}
+
+// CSVMappingImporter imports CSV files described declaratively by CSVMapping,
+// allowing to support a new broker export without writing Go code.
+type CSVMappingImporter struct {
+	mapping  *CSVMapping
+	comma    rune
+	encoding encoding.Encoding
+	timeLoc  *time.Location
+	skip     []*regexp.Regexp
+}
+
+// LoadCSVMapping loads the mapping from JSON
+func LoadCSVMapping(reader io.Reader) (*CSVMapping, error) {
+	mapping := new(CSVMapping)
+	if err := json.NewDecoder(reader).Decode(mapping); err != nil {
+		return nil, e("unable to decode csv mapping: %v", err)
+	}
+	return mapping, nil
+}
+
+// normalizeEncodingName makes "windows-1250" and "Windows 1250" equal
+func normalizeEncodingName(name string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// NewCSVMappingImporter creates the importer from the mapping, validating it
+func NewCSVMappingImporter(mapping *CSVMapping) (*CSVMappingImporter, error) {
+	imp := &CSVMappingImporter{mapping: mapping, comma: ','}
+
+	if len(mapping.Name) == 0 {
+		return nil, e("csv mapping must have a name")
+	}
+	if len(mapping.Columns.Time) == 0 {
+		return nil, e("csv mapping %s must map the time column", mapping.Name)
+	}
+	if len(mapping.Columns.Type) == 0 && len(mapping.Types) == 0 {
+		return nil, e("csv mapping %s must have type column or type rules", mapping.Name)
+	}
+
+	if len(mapping.Delimiter) > 0 {
+		r, size := utf8.DecodeRuneInString(mapping.Delimiter)
+		if size != len(mapping.Delimiter) {
+			return nil, e("csv mapping %s: delimiter must be a single character", mapping.Name)
+		}
+		imp.comma = r
+	}
+
+	if len(mapping.Encoding) > 0 && normalizeEncodingName(mapping.Encoding) != "utf8" {
+		for _, enc := range charmap.All {
+			if normalizeEncodingName(fmt.Sprint(enc)) == normalizeEncodingName(mapping.Encoding) {
+				imp.encoding = enc
+				break
+			}
+		}
+		if imp.encoding == nil {
+			return nil, e("csv mapping %s: unknown encoding %s", mapping.Name, mapping.Encoding)
+		}
+	}
+
+	switch mapping.Decimal {
+	case "", "computer", "cz":
+	default:
+		return nil, e("csv mapping %s: unknown decimal style %s", mapping.Name, mapping.Decimal)
+	}
+
+	if len(mapping.DateLayout) == 0 {
+		mapping.DateLayout = "2006-01-02 15:04:05"
+	}
+
+	imp.timeLoc = time.UTC
+	if len(mapping.TimeZone) > 0 {
+		timeLoc, err := time.LoadLocation(mapping.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		imp.timeLoc = timeLoc
+	}
+
+	for _, rule := range mapping.Types {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, e("csv mapping %s: bad type rule %s: %v", mapping.Name, rule.Match, err)
+		}
+		rule.re = re
+	}
+
+	for _, skip := range mapping.Skip {
+		re, err := regexp.Compile(skip)
+		if err != nil {
+			return nil, e("csv mapping %s: bad skip rule %s: %v", mapping.Name, skip, err)
+		}
+		imp.skip = append(imp.skip, re)
+	}
+
+	return imp, nil
+}
+
+// Name returns a name of the importer
+func (imp *CSVMappingImporter) Name() string {
+	return imp.mapping.Name
+}
+
+// Detect returns true if the header contains all the Detect strings of the mapping
+func (imp *CSVMappingImporter) Detect(header []byte) bool {
+	if len(imp.mapping.Detect) == 0 {
+		return false
+	}
+	for _, str := range imp.mapping.Detect {
+		if !bytes.Contains(header, []byte(str)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (imp *CSVMappingImporter) parseFloat(str string) (float64, error) {
+	if len(str) == 0 {
+		return 0, nil
+	}
+	if imp.mapping.Decimal == "cz" {
+		return utils.ParseCZFloat(str)
+	}
+	var fs utils.Float64String
+	err := fs.UnmarshalCSV(str)
+	return fs.Float64, err
+}
+
+// decideType decides the transaction type using the type column and rules
+func (imp *CSVMappingImporter) decideType(row []string, colNameToIndex map[string]int) TransactionType {
+	for _, rule := range imp.mapping.Types {
+		column := rule.Column
+		if len(column) == 0 {
+			column = imp.mapping.Columns.Reference
+		}
+		i, has := colNameToIndex[column]
+		if !has || i >= len(row) {
+			continue
+		}
+		if rule.re.MatchString(strings.TrimSpace(row[i])) {
+			return rule.Type
+		}
+	}
+
+	if i, has := colNameToIndex[imp.mapping.Columns.Type]; has && i < len(row) {
+		tt := TransactionType(strings.TrimSpace(row[i]))
+		switch tt {
+		case TTFee, TTBuy, TTSell, TTDividend, TTInterest, TTDeposit, TTWithdrawal,
+			TTSplitMultiplier, TTReturnOfCapital, TTMergerCash, TTCashInLieu:
+			return tt
+		}
+	}
+
+	return TTInvalid
+}
+
+// Import parses data from the reader and returns transactions
+func (imp *CSVMappingImporter) Import(reader io.Reader) ([]*Transaction, error) {
+	var csvrd *utils.CSVReader
+	if imp.encoding != nil {
+		csvrd = utils.NewCSVReaderWithEncoding(reader, imp.encoding)
+	} else {
+		csvrd = utils.NewCSVReader(reader)
+	}
+	csvrd.Comma = imp.comma
+
+	// parse columns
+	columns, err := csvrd.GoCSVReader().Read()
+	if err != nil {
+		return nil, err
+	}
+	colNameToIndex := make(map[string]int)
+	for i, cname := range columns {
+		colNameToIndex[strings.TrimSpace(cname)] = i
+	}
+
+	// ensure we have all the mapped columns
+	cols := imp.mapping.Columns
+	for _, rc := range []string{cols.Time, cols.Type, cols.Item, cols.Quantity, cols.Price,
+		cols.NetTotal, cols.Currency, cols.Fee, cols.FeeCurrency, cols.Reference} {
+		if _, has := colNameToIndex[rc]; len(rc) > 0 && !has {
+			return nil, e("missing column %s", rc)
+		}
+	}
+
+	// returns trimmed column value or empty string if not mapped
+	field := func(row []string, column string) string {
+		if i, has := colNameToIndex[column]; has && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var outArr []*Transaction
+	var row []string
+	lineNum := 1
+rows:
+	for {
+		lineNum++
+		row, err = csvrd.GoCSVReader().Read()
+		if err != nil {
+			break
+		}
+
+		newTransaction := &Transaction{
+			Item:        field(row, cols.Item),
+			Reference:   field(row, cols.Reference),
+			Currency:    currency.FromString(field(row, cols.Currency)),
+			FeeCurrency: currency.FromString(field(row, cols.FeeCurrency)),
+		}
+
+		for _, re := range imp.skip {
+			for _, col := range row {
+				if re.MatchString(strings.TrimSpace(col)) {
+					continue rows
+				}
+			}
+		}
+
+		// date/time
+		str := field(row, cols.Time)
+		newTransaction.Time, err = time.ParseInLocation(imp.mapping.DateLayout, str, imp.timeLoc)
+		if err != nil {
+			return nil, e("unable to parse date string %s on line %d", str, lineNum)
+		}
+
+		// numbers
+		numbers := []struct {
+			column string
+			dest   *float64
+		}{
+			{cols.Quantity, &newTransaction.Quantity},
+			{cols.Price, &newTransaction.Price},
+			{cols.NetTotal, &newTransaction.NetTotal},
+			{cols.Fee, &newTransaction.Fee},
+		}
+		for _, num := range numbers {
+			str = field(row, num.column)
+			if *num.dest, err = imp.parseFloat(str); err != nil {
+				return nil, e("unable to parse %s %s on line %d", num.column, str, lineNum)
+			}
+		}
+		newTransaction.Quantity = math.Abs(newTransaction.Quantity)
+		newTransaction.Price = math.Abs(newTransaction.Price)
+		newTransaction.Fee = math.Abs(newTransaction.Fee)
+
+		// currencies
+		if len(newTransaction.Currency) == 0 {
+			newTransaction.Currency = imp.mapping.Currency
+			if len(newTransaction.Currency) == 0 {
+				newTransaction.Currency = currency.Invalid
+			}
+		}
+		if len(newTransaction.FeeCurrency) == 0 {
+			newTransaction.FeeCurrency = newTransaction.Currency
+		}
+
+		// transaction type decision
+		newTransaction.Type = imp.decideType(row, colNameToIndex)
+		if newTransaction.Type == TTInvalid {
+			return nil, e("unknown transaction type on line %d: %#v", lineNum, newTransaction)
+		}
+
+		// compute net total if not exported
+		if len(cols.NetTotal) == 0 {
+			fee := 0.0
+			if newTransaction.FeeCurrency == newTransaction.Currency {
+				fee = newTransaction.Fee
+			}
+			newTransaction.NetTotal = newTransaction.Quantity * newTransaction.Price
+			if newTransaction.Type == TTBuy {
+				newTransaction.NetTotal += fee // paid together with the price
+			} else if newTransaction.Type == TTSell {
+				newTransaction.NetTotal -= fee // deducted from the revenue
+			}
+		}
+
+		// last-chance fixes, making signs consistent
+		switch newTransaction.Type {
+		case TTBuy, TTWithdrawal:
+			newTransaction.NetTotal = -math.Abs(newTransaction.NetTotal)
+		case TTSell, TTDeposit:
+			newTransaction.NetTotal = math.Abs(newTransaction.NetTotal)
+		case TTFee:
+			if newTransaction.Fee == 0 {
+				newTransaction.Fee = math.Abs(newTransaction.NetTotal)
+			}
+			newTransaction.NetTotal = -newTransaction.Fee
+			newTransaction.Quantity = 0
+			newTransaction.Price = 0
+		case TTDividend, TTInterest:
+			newTransaction.Quantity = 0
+			newTransaction.Price = 0
+		}
+		if newTransaction.Fee == 0 {
+			newTransaction.FeeCurrency = currency.Invalid
+		}
+
+		outArr = append(outArr, newTransaction)
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+
+	return outArr, err
+}
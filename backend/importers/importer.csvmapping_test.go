@@ -0,0 +1,79 @@
+package importers
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCSVMapping(t *testing.T) {
+	mappingFile, err := os.Open("importer.csvmapping_test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mappingFile.Close()
+
+	mapping, err := LoadCSVMapping(mappingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imp, err := NewCSVMappingImporter(mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open("importer.csvmapping_test.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	trs, err := imp.Import(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNum := 5
+	if len(trs) != wantNum {
+		t.Fatalf("wrong number of parsed transactions (%d parsed != %d)", len(trs), wantNum)
+	}
+
+	buy := trs[1]
+	if buy.Type != TTBuy || buy.Item != "CEZ" || buy.Quantity != 10 || buy.Price != 500.5 {
+		t.Fatalf("bad buy parsed %v", buy)
+	}
+	if buy.NetTotal != -5045 {
+		t.Fatalf("bad buy net total %.2f", buy.NetTotal)
+	}
+
+	sell := trs[2]
+	if sell.Type != TTSell || sell.NetTotal != 2560 {
+		t.Fatalf("bad sell parsed %v", sell)
+	}
+
+	fee := trs[4]
+	if fee.Type != TTFee || fee.Reference != "Poplatek za vedení účtu" || fee.Fee != 50 {
+		t.Fatalf("bad fee parsed %v", fee)
+	}
+
+	// ensure some basic rules
+	verifyImporter(trs, t)
+
+	for _, it := range trs {
+		t.Logf("%v", *it)
+	}
+}
+
+func TestCSVMappingInvalid(t *testing.T) {
+	if _, err := NewCSVMappingImporter(&CSVMapping{Name: "bad"}); err == nil {
+		t.Fatal("mapping without columns must be rejected")
+	}
+
+	if _, err := NewCSVMappingImporter(&CSVMapping{
+		Name:     "bad",
+		Encoding: "klingon",
+		Columns:  CSVMappingColumns{Time: "Date", Type: "Type"},
+	}); err == nil {
+		t.Fatal("mapping with unknown encoding must be rejected")
+	}
+}
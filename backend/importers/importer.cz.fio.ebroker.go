@@ -1,6 +1,7 @@
 package importers
 
 import (
+	"bytes"
 	"io"
 
 	"regexp"
@@ -14,7 +15,16 @@ import (
 	"golang.org/x/text/encoding/charmap"
 )
 
-type CZFioImporter struct {
+// CZFioImporter imports fio.cz e-Broker CSV exports
+type CZFioImporter struct{}
+
+// NewCZFioImporter creates a fio.cz transaction importer
+func NewCZFioImporter() *CZFioImporter {
+	return &CZFioImporter{}
+}
+
+// fioColumns holds columns of the imported data (the importer itself is shared)
+type fioColumns struct {
 	// mapping colum names to column array index
 	colNameToIndex map[string]int
 	// mapping volumes for individual currencies to column array index
@@ -23,18 +33,30 @@ type CZFioImporter struct {
 	feeCols map[currency.Currency]int
 }
 
-// NewCZFioImporter creates a fio.cz transaction importer
-func NewCZFioImporter() *CZFioImporter {
-	return &CZFioImporter{
+func newFioColumns(columns []string) *fioColumns {
+	cols := &fioColumns{
 		make(map[string]int),
 		make(map[currency.Currency]int),
 		make(map[currency.Currency]int),
 	}
+
+	reVolume := regexp.MustCompile(`Objem v (\S+)`)
+	reFee := regexp.MustCompile(`Poplatky v (\S+)`)
+	for i, cname := range columns {
+		cols.colNameToIndex[cname] = i
+
+		if arr := reVolume.FindStringSubmatch(cname); len(arr) == 2 {
+			cols.volumeCols[currency.FromString(arr[1])] = i
+		} else if arr := reFee.FindStringSubmatch(cname); len(arr) == 2 {
+			cols.feeCols[currency.FromString(arr[1])] = i
+		}
+	}
+	return cols
 }
 
-func (imp *CZFioImporter) validateColumns(reqCols []string) error {
+func (cols *fioColumns) validateColumns(reqCols []string) error {
 	for _, rc := range reqCols {
-		if _, has := imp.colNameToIndex[rc]; !has {
+		if _, has := cols.colNameToIndex[rc]; !has {
 			return e("missing column %s", rc)
 		}
 	}
@@ -46,6 +68,13 @@ func (imp *CZFioImporter) Name() string {
 	return "fio.cz"
 }
 
+// Detect returns true if the header looks like fio e-Broker CSV export
+func (imp *CZFioImporter) Detect(header []byte) bool {
+	// column names are plain ASCII so there is no need to decode windows-1250
+	return bytes.Contains(header, []byte("Datum obchodu")) &&
+		bytes.Contains(header, []byte("Text FIO"))
+}
+
 var reDividendText = regexp.MustCompile(`(?i)divid\.|dividenda|Korekce výnosu|Stock Dividend Cash Distribution|Refundable U.S. Fed Tax`)
 var reFeeText = regexp.MustCompile(`(?i)fee|poplatek`)
 var reDeposit = regexp.MustCompile(`(?i)Vloženo na účet|Převod z účtu`)
@@ -53,7 +82,6 @@ var reWithdrawal = regexp.MustCompile(`(?i)Vybráno z|Převod na účet`)
 
 // Import parses data from the reader and returns transactions
 func (imp *CZFioImporter) Import(reader io.Reader) ([]*Transaction, error) {
-
 	csvrd := utils.NewCSVReaderWithEncoding(reader, charmap.Windows1250)
 	csvrd.Comma = ';'
 
@@ -64,20 +92,10 @@ func (imp *CZFioImporter) Import(reader io.Reader) ([]*Transaction, error) {
 	}
 
 	// process columns
-	reVolume := regexp.MustCompile(`Objem v (\S+)`)
-	reFee := regexp.MustCompile(`Poplatky v (\S+)`)
-	for i, cname := range columns {
-		imp.colNameToIndex[cname] = i
-
-		if arr := reVolume.FindStringSubmatch(cname); len(arr) == 2 {
-			imp.volumeCols[currency.FromString(arr[1])] = i
-		} else if arr := reFee.FindStringSubmatch(cname); len(arr) == 2 {
-			imp.feeCols[currency.FromString(arr[1])] = i
-		}
-	}
+	cols := newFioColumns(columns)
 
 	// ensure we have all the important columns
-	err = imp.validateColumns([]string{"Datum obchodu", "Směr", "Symbol", "Cena", "Počet", "Měna", "Text FIO"})
+	err = cols.validateColumns([]string{"Datum obchodu", "Směr", "Symbol", "Cena", "Počet", "Měna", "Text FIO"})
 	if err != nil {
 		return nil, err
 	}
@@ -96,17 +114,17 @@ func (imp *CZFioImporter) Import(reader io.Reader) ([]*Transaction, error) {
 		newTransaction := &Transaction{}
 
 		// direction
-		trDir := strings.TrimSpace(row[imp.colNameToIndex["Směr"]])
+		trDir := strings.TrimSpace(row[cols.colNameToIndex["Směr"]])
 
 		// item
-		newTransaction.Item = strings.TrimSpace(row[imp.colNameToIndex["Symbol"]])
+		newTransaction.Item = strings.TrimSpace(row[cols.colNameToIndex["Symbol"]])
 		if newTransaction.Item == "Součet" {
 			// skip the sum line
 			continue
 		}
 
 		// text
-		newTransaction.Reference = strings.TrimSpace(row[imp.colNameToIndex["Text FIO"]])
+		newTransaction.Reference = strings.TrimSpace(row[cols.colNameToIndex["Text FIO"]])
 		if strings.Contains(newTransaction.Reference, "volitelné dividendy") {
 			// skip "distribuce prav volitelne dividendy" line
 			//TODO: verify it's ok
@@ -114,21 +132,21 @@ func (imp *CZFioImporter) Import(reader io.Reader) ([]*Transaction, error) {
 		}
 
 		// quantity
-		field := strings.TrimSpace(row[imp.colNameToIndex["Počet"]])
+		field := strings.TrimSpace(row[cols.colNameToIndex["Počet"]])
 		newTransaction.Quantity, err = utils.ParseCZFloat(field)
 		if err != nil {
 			return nil, e("unable to parse Počet on line %d", lineNum)
 		}
 
 		// price
-		field = strings.TrimSpace(row[imp.colNameToIndex["Cena"]])
+		field = strings.TrimSpace(row[cols.colNameToIndex["Cena"]])
 		newTransaction.Price, err = utils.ParseCZFloat(field)
 		if err != nil {
 			return nil, e("unable to parse Cena on line %d", lineNum)
 		}
 
 		// date/time
-		field = strings.TrimSpace(row[imp.colNameToIndex["Datum obchodu"]])
+		field = strings.TrimSpace(row[cols.colNameToIndex["Datum obchodu"]])
 		timeLoc, err := time.LoadLocation("Europe/Prague")
 		if err != nil {
 			return nil, err
@@ -140,7 +158,7 @@ func (imp *CZFioImporter) Import(reader io.Reader) ([]*Transaction, error) {
 
 		// fee and fee currency
 		newTransaction.FeeCurrency = currency.Invalid
-		for c, i := range imp.feeCols {
+		for c, i := range cols.feeCols {
 			field = strings.TrimSpace(row[i])
 			if len(field) > 0 {
 				newTransaction.Fee, err = utils.ParseCZFloat(field)
@@ -154,7 +172,7 @@ func (imp *CZFioImporter) Import(reader io.Reader) ([]*Transaction, error) {
 
 		// net total
 		trNetTotalCurrency := currency.Invalid
-		for c, i := range imp.volumeCols {
+		for c, i := range cols.volumeCols {
 			field = strings.TrimSpace(row[i])
 			if len(field) > 0 {
 				newTransaction.NetTotal, err = utils.ParseCZFloat(field)
@@ -219,7 +237,7 @@ func (imp *CZFioImporter) Import(reader io.Reader) ([]*Transaction, error) {
 		}
 
 		// transaction currency
-		field = strings.TrimSpace(row[imp.colNameToIndex["Měna"]])
+		field = strings.TrimSpace(row[cols.colNameToIndex["Měna"]])
 		if len(field) == 0 {
 			// currency not specified, use net total currency
 			newTransaction.Currency = trNetTotalCurrency
@@ -249,3 +267,7 @@ func (imp *CZFioImporter) Import(reader io.Reader) ([]*Transaction, error) {
 
 	return outArr, err
 }
+
+func init() {
+	RegisterImporter(NewCZFioImporter())
+}
@@ -1,13 +1,18 @@
 package importers
 
 import (
+	"bufio"
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/marketdata"
+	"github.com/k3a/in2tracker/backend/model"
 	"github.com/k3a/in2tracker/backend/utils"
 )
 
@@ -38,6 +43,8 @@ const (
 	TTReturnOfCapital = TransactionType("TTReturnOfCapital")
 	// Cash returned because of stock merger
 	TTMergerCash = TransactionType("TTMergerCash")
+	// Cash paid for fractional items remaining after a split, fractional items in Quantity
+	TTCashInLieu = TransactionType("TTCashInLieu")
 )
 
 func (tt TransactionType) String() string {
@@ -52,6 +59,10 @@ type Transaction struct {
 	Type TransactionType
 	// item this transaction belongs to
 	Item string
+	// ISIN of the item (empty if not provided by the broker)
+	ISIN string
+	// market the item was traded on (nil if not known)
+	Market *marketdata.Market
 	// for purchases/sales of items - number of items sold/bought - UNSIGNED
 	Quantity float64
 	// price at which an item was bought/sold - UNSIGNED
@@ -66,6 +77,8 @@ type Transaction struct {
 	FeeCurrency currency.Currency
 	// text reference
 	Reference string
+	// hash of the stored transaction (empty if not loaded from the store)
+	storedHash string
 }
 
 // String returns printable representation for debug
@@ -75,26 +88,136 @@ func (t *Transaction) String() string {
 		t.Fee, t.FeeCurrency, utils.StringPreview(t.Reference, 10))
 }
 
-// Hash returns sha1 hash representing transaction uniquely
+// Hash returns sha1 hash representing transaction uniquely.
+// Transactions loaded from the store keep their stored hash, which differs
+// for identical transactions reported in one statement (see store.SaveTransactions).
 func (t *Transaction) Hash() string {
+	if len(t.storedHash) > 0 {
+		return t.storedHash
+	}
 	hashInp := fmt.Sprintf("%d%s%f%f", t.Time.Unix(), t.Item, t.Quantity, t.NetTotal)
 	hashBytes := sha1.Sum([]byte(hashInp))
 	return hex.EncodeToString(hashBytes[:])
 }
 
+// Model converts the transaction to the model stored in the portfolio
+func (t *Transaction) Model(portfolioID int64) *model.Transaction {
+	return &model.Transaction{
+		PortfolioID: portfolioID,
+		Hash:        t.Hash(),
+		Time:        t.Time,
+		Type:        t.Type.String(),
+		Item:        t.Item,
+		Market:      t.Market.Code(),
+		Quantity:    t.Quantity,
+		Price:       t.Price,
+		NetTotal:    t.NetTotal,
+		Currency:    t.Currency.String(),
+		Fee:         t.Fee,
+		FeeCurrency: t.FeeCurrency.String(),
+		Reference:   t.Reference,
+		ISIN:        t.ISIN,
+	}
+}
+
+// Identifiers returns identifiers of the traded item
+func (t *Transaction) Identifiers() model.ItemIdentifiers {
+	return model.ItemIdentifiers{
+		Ticker:   t.Item,
+		Market:   t.Market.Code(),
+		Currency: t.Currency.String(),
+		ISIN:     t.ISIN,
+	}
+}
+
+// TransactionFromModel converts the stored transaction model back to the transaction
+func TransactionFromModel(mt *model.Transaction) *Transaction {
+	t := &Transaction{
+		Time:        mt.Time,
+		Type:        TransactionType(mt.Type),
+		Item:        mt.Item,
+		Quantity:    mt.Quantity,
+		Price:       mt.Price,
+		NetTotal:    mt.NetTotal,
+		Currency:    currency.FromString(mt.Currency),
+		Fee:         mt.Fee,
+		FeeCurrency: currency.FromString(mt.FeeCurrency),
+		Reference:   mt.Reference,
+		ISIN:        mt.ISIN,
+		storedHash:  mt.Hash,
+	}
+	if len(mt.Market) > 0 {
+		t.Market = marketdata.MarketFromString(mt.Market)
+	}
+	return t
+}
+
 func e(format string, args ...interface{}) error {
 	return fmt.Errorf("importer: "+format, args...)
 }
 
 // Errors
 var (
-	ErrBadFormat = e("unable to parse the provided data")
+	ErrBadFormat     = e("unable to parse the provided data")
+	ErrUnknownFormat = e("unable to detect format of the provided data")
 )
 
 // Importer allows importing transaction data
 type Importer interface {
 	// Name returns a name of the importer
 	Name() string
+	// Detect returns true if the header (first few kilobytes of the data)
+	// looks like the format supported by the importer. It should return fast.
+	Detect(header []byte) bool
 	// Import parses data from the reader and returns transactions
 	Import(reader io.Reader) ([]*Transaction, error)
 }
+
+// detectHeaderSize is the number of bytes passed to Importer.Detect
+const detectHeaderSize = 4096
+
+// Importers holds all available importers
+var Importers []Importer
+
+// RegisterImporter registers a new importer
+func RegisterImporter(importer Importer) {
+	for _, imp := range Importers {
+		if imp == importer {
+			panic("Attempt to register already-registered importer " +
+				reflect.TypeOf(importer).String())
+		}
+	}
+	Importers = append(Importers, importer)
+}
+
+// FromName returns the registered importer with the name (case insensitive)
+// or nil if there is no such importer
+func FromName(name string) Importer {
+	for _, imp := range Importers {
+		if strings.EqualFold(imp.Name(), name) {
+			return imp
+		}
+	}
+	return nil
+}
+
+// Detect probes the beginning of the data to find the importer able to import it.
+// It returns the importer and a reader which must be used instead of the original
+// one as the probed bytes are already consumed from the original reader.
+// Returns ErrUnknownFormat if no registered importer recognizes the data.
+func Detect(reader io.Reader) (Importer, io.Reader, error) {
+	bufrd := bufio.NewReaderSize(reader, detectHeaderSize)
+
+	header, err := bufrd.Peek(detectHeaderSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, bufrd, err
+	}
+
+	for _, imp := range Importers {
+		if imp.Detect(header) {
+			return imp, bufrd, nil
+		}
+	}
+
+	return nil, bufrd, ErrUnknownFormat
+}
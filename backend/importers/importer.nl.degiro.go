@@ -0,0 +1,397 @@
+package importers
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/marketdata"
+	"github.com/k3a/in2tracker/backend/utils"
+)
+
+// DegiroImporter imports degiro.com Transactions.csv and Account.csv exports (English).
+// Trades are imported from Transactions.csv while dividends, taxes, fees, cash transfers
+// and autoFX currency conversions are imported from Account.csv.
+// Trade-related rows of Account.csv are skipped as they duplicate Transactions.csv.
+// Use ImportStatements to get a single transaction stream from both files.
+type DegiroImporter struct {
+	timeLoc *time.Location
+}
+
+// NewDegiroImporter creates a degiro.com transaction importer
+func NewDegiroImporter() *DegiroImporter {
+	timeLoc, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		timeLoc = time.UTC
+	}
+	return &DegiroImporter{timeLoc}
+}
+
+// Name returns a name of the importer
+func (imp *DegiroImporter) Name() string {
+	return "degiro.com"
+}
+
+// Detect returns true if the header looks like Degiro Transactions.csv or Account.csv
+func (imp *DegiroImporter) Detect(header []byte) bool {
+	return isDegiroTransactions(header) || isDegiroAccount(header)
+}
+
+func isDegiroTransactions(header []byte) bool {
+	return bytes.Contains(header, []byte("ISIN")) &&
+		bytes.Contains(header, []byte("Reference exchange")) &&
+		bytes.Contains(header, []byte("Venue"))
+}
+
+func isDegiroAccount(header []byte) bool {
+	return bytes.Contains(header, []byte("ISIN")) &&
+		bytes.Contains(header, []byte("Value date")) &&
+		bytes.Contains(header, []byte("Description"))
+}
+
+var reDegiroDividendTax = regexp.MustCompile(`(?i)^dividend\s*tax`)
+var reDegiroDividend = regexp.MustCompile(`(?i)^(dividend|capital return)`)
+var reDegiroFee = regexp.MustCompile(`(?i)connectivity fee|connection fee|custody fee|stamp duty`)
+var reDegiroDeposit = regexp.MustCompile(`(?i)deposit$`)
+var reDegiroWithdrawal = regexp.MustCompile(`(?i)withdrawal$`)
+var reDegiroFXCredit = regexp.MustCompile(`(?i)^(fx credit|valuta creditering)`)
+var reDegiroFXDebit = regexp.MustCompile(`(?i)^(fx debit|valuta debitering)`)
+var reDegiroTrade = regexp.MustCompile(`(?i)^(buy|sell) |transaction (and/or third party )?fee`)
+var reDegiroInternal = regexp.MustCompile(`(?i)cash sweep|money market|fund price change|^cash market fund`)
+
+// parseDegiroFloat parses numbers like "1,234.56", "-2697.10" or "1,50"
+func parseDegiroFloat(str string) (float64, error) {
+	str = strings.TrimSpace(str)
+	if len(str) == 0 {
+		return 0, nil
+	}
+	if strings.Contains(str, ",") && !strings.Contains(str, ".") {
+		return utils.ParseCZFloat(str)
+	}
+	return strconv.ParseFloat(strings.Replace(str, ",", "", -1), 64)
+}
+
+// degiroRows reads the CSV header and rows, providing access to columns by name
+type degiroRows struct {
+	csvrd          *utils.CSVReader
+	colNameToIndex map[string]int
+	row            []string
+	lineNum        int
+}
+
+func newDegiroRows(reader io.Reader) (*degiroRows, error) {
+	csvrd := utils.NewCSVReader(reader)
+	csvrd.Comma = ','
+
+	columns, err := csvrd.GoCSVReader().Read()
+	if err != nil {
+		return nil, err
+	}
+	csvrd.GoCSVReader().FieldsPerRecord = -1
+
+	rows := &degiroRows{csvrd, make(map[string]int), nil, 1}
+	for i, cname := range columns {
+		if _, has := rows.colNameToIndex[cname]; !has && len(cname) > 0 {
+			rows.colNameToIndex[cname] = i
+		}
+	}
+	return rows, nil
+}
+
+func (r *degiroRows) validateColumns(reqCols []string) error {
+	for _, rc := range reqCols {
+		if _, has := r.colNameToIndex[rc]; !has {
+			return e("missing column %s", rc)
+		}
+	}
+	return nil
+}
+
+// next reads the next row, returns io.EOF at the end
+func (r *degiroRows) next() (err error) {
+	r.lineNum++
+	r.row, err = r.csvrd.GoCSVReader().Read()
+	return err
+}
+
+// field returns trimmed value of the named column shifted by offset
+// (unnamed currency columns follow the named value columns)
+func (r *degiroRows) field(column string, offset int) string {
+	i, has := r.colNameToIndex[column]
+	if !has || i+offset >= len(r.row) {
+		return ""
+	}
+	return strings.TrimSpace(r.row[i+offset])
+}
+
+func (r *degiroRows) float(column string, offset int) (float64, error) {
+	str := r.field(column, offset)
+	f, err := parseDegiroFloat(str)
+	if err != nil {
+		return 0, e("unable to parse %s %s on line %d", column, str, r.lineNum)
+	}
+	return f, nil
+}
+
+func (r *degiroRows) time(timeLoc *time.Location) (time.Time, error) {
+	str := r.field("Date", 0) + " " + r.field("Time", 0)
+	t, err := time.ParseInLocation("02-01-2006 15:04", str, timeLoc)
+	if err != nil {
+		return t, e("unable to parse date string %s on line %d", str, r.lineNum)
+	}
+	return t, nil
+}
+
+// importTransactions imports trades from Transactions.csv
+func (imp *DegiroImporter) importTransactions(rows *degiroRows) ([]*Transaction, error) {
+	err := rows.validateColumns([]string{"Date", "Time", "Product", "ISIN", "Venue",
+		"Quantity", "Price", "Local value", "Exchange rate",
+		"Transaction and/or third party fees"})
+	if err != nil {
+		return nil, err
+	}
+
+	var outArr []*Transaction
+	for {
+		if err = rows.next(); err != nil {
+			break
+		}
+
+		newTransaction := &Transaction{
+			Item:      rows.field("ISIN", 0), // ticker is not exported
+			ISIN:      rows.field("ISIN", 0),
+			Reference: rows.field("Product", 0),
+			Currency:  currency.FromString(rows.field("Price", 1)),
+		}
+
+		newTransaction.Market = marketdata.MarketFromString(rows.field("Venue", 0))
+		if marketdata.MarketEquals(newTransaction.Market, marketdata.MarketAny) {
+			newTransaction.Market = marketdata.MarketFromString(rows.field("Reference exchange", 0))
+		}
+
+		if newTransaction.Time, err = rows.time(imp.timeLoc); err != nil {
+			return nil, err
+		}
+
+		var localValue, rate, fee float64
+		if newTransaction.Quantity, err = rows.float("Quantity", 0); err != nil {
+			return nil, err
+		}
+		if newTransaction.Price, err = rows.float("Price", 0); err != nil {
+			return nil, err
+		}
+		if localValue, err = rows.float("Local value", 0); err != nil {
+			return nil, err
+		}
+		if rate, err = rows.float("Exchange rate", 0); err != nil {
+			return nil, err
+		}
+		if fee, err = rows.float("Transaction and/or third party fees", 0); err != nil {
+			return nil, err
+		}
+
+		if newTransaction.Quantity > 0 {
+			newTransaction.Type = TTBuy
+		} else if newTransaction.Quantity < 0 {
+			newTransaction.Type = TTSell
+		} else {
+			return nil, e("zero quantity on line %d", rows.lineNum)
+		}
+
+		// fee is in the account currency, net total must be in the local one
+		newTransaction.Fee = math.Abs(fee)
+		if newTransaction.Fee != 0 {
+			newTransaction.FeeCurrency = currency.FromString(rows.field("Transaction and/or third party fees", 1))
+		} else {
+			newTransaction.FeeCurrency = currency.Invalid
+		}
+		if rate == 0 || newTransaction.FeeCurrency == newTransaction.Currency {
+			rate = 1 // exchange rate is local currency units per account currency unit
+		}
+		newTransaction.NetTotal = localValue - newTransaction.Fee*rate
+
+		newTransaction.Quantity = math.Abs(newTransaction.Quantity)
+		newTransaction.Price = math.Abs(newTransaction.Price)
+
+		outArr = append(outArr, newTransaction)
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+
+	return outArr, err
+}
+
+// importAccount imports cash movements from Account.csv
+func (imp *DegiroImporter) importAccount(rows *degiroRows) ([]*Transaction, error) {
+	err := rows.validateColumns([]string{"Date", "Time", "Product", "ISIN",
+		"Description", "Change"})
+	if err != nil {
+		return nil, err
+	}
+
+	var outArr []*Transaction
+	// autoFX legs waiting for the other leg, by time, oldest first
+	fxCredits := make(map[string][]*Transaction)
+	fxDebits := make(map[string][]*Transaction)
+
+	for {
+		if err = rows.next(); err != nil {
+			break
+		}
+
+		description := rows.field("Description", 0)
+		if len(description) == 0 || reDegiroInternal.MatchString(description) {
+			continue
+		}
+
+		newTransaction := &Transaction{
+			Item:      rows.field("ISIN", 0),
+			ISIN:      rows.field("ISIN", 0),
+			Reference: description,
+			Currency:  currency.FromString(rows.field("Change", 0)),
+		}
+		if newTransaction.Time, err = rows.time(imp.timeLoc); err != nil {
+			return nil, err
+		}
+		if newTransaction.NetTotal, err = rows.float("Change", 1); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case reDegiroFXCredit.MatchString(description), reDegiroFXDebit.MatchString(description):
+			// autoFX conversion is reported as two legs at the same time,
+			// resulting in buying the credited currency for the debited one;
+			// several conversions may share the time and have no order id,
+			// so each leg is paired with the oldest waiting leg of the other kind
+			key := rows.field("Date", 0) + rows.field("Time", 0) + rows.field("Order Id", 0)
+			isCredit := reDegiroFXCredit.MatchString(description)
+			own, other := fxDebits, fxCredits
+			if isCredit {
+				own, other = fxCredits, fxDebits
+			}
+			if len(other[key]) == 0 {
+				own[key] = append(own[key], newTransaction)
+				continue
+			}
+			credit, debit := other[key][0], newTransaction
+			if len(other[key]) == 1 {
+				delete(other, key)
+			} else {
+				other[key] = other[key][1:]
+			}
+			if isCredit {
+				credit, debit = debit, credit
+			}
+
+			newTransaction = &Transaction{
+				Time:        credit.Time,
+				Type:        TTBuy,
+				Item:        credit.Currency.String(),
+				Quantity:    math.Abs(credit.NetTotal),
+				NetTotal:    -math.Abs(debit.NetTotal),
+				Currency:    debit.Currency,
+				FeeCurrency: currency.Invalid,
+				Reference:   "autoFX " + debit.Currency.String() + " to " + credit.Currency.String(),
+			}
+			if newTransaction.Quantity == 0 {
+				return nil, e("zero FX credit on line %d", rows.lineNum)
+			}
+			newTransaction.Price = -newTransaction.NetTotal / newTransaction.Quantity
+		case reDegiroTrade.MatchString(description):
+			continue // imported from Transactions.csv
+		case reDegiroDividendTax.MatchString(description):
+			newTransaction.Type = TTDividend // negative net total is tax paid
+		case reDegiroDividend.MatchString(description):
+			newTransaction.Type = TTDividend
+		case reDegiroFee.MatchString(description):
+			newTransaction.Type = TTFee
+			newTransaction.Fee = -newTransaction.NetTotal
+			newTransaction.FeeCurrency = newTransaction.Currency
+			if newTransaction.Fee < 0 {
+				// fee refund
+				newTransaction.Fee = 0
+				newTransaction.FeeCurrency = currency.Invalid
+			}
+		case reDegiroDeposit.MatchString(description) && newTransaction.NetTotal >= 0:
+			newTransaction.Type = TTDeposit
+			newTransaction.Item = ""
+		case reDegiroWithdrawal.MatchString(description) && newTransaction.NetTotal <= 0:
+			newTransaction.Type = TTWithdrawal
+			newTransaction.Item = ""
+		default:
+			return nil, e("unknown transaction type on line %d: %s", rows.lineNum, description)
+		}
+
+		if newTransaction.Type == TTDividend && len(newTransaction.Item) == 0 {
+			return nil, e("dividend without ISIN on line %d", rows.lineNum)
+		}
+
+		outArr = append(outArr, newTransaction)
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+	if err == nil && (len(fxCredits) > 0 || len(fxDebits) > 0) {
+		credits, debits := 0, 0
+		for _, legs := range fxCredits {
+			credits += len(legs)
+		}
+		for _, legs := range fxDebits {
+			debits += len(legs)
+		}
+		err = e("incomplete autoFX conversion (%d credits, %d debits without the other leg)",
+			credits, debits)
+	}
+
+	return outArr, err
+}
+
+// Import parses data from either Transactions.csv or Account.csv and returns transactions
+func (imp *DegiroImporter) Import(reader io.Reader) ([]*Transaction, error) {
+	rows, err := newDegiroRows(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, has := rows.colNameToIndex["Venue"]; has {
+		return imp.importTransactions(rows)
+	} else if _, has := rows.colNameToIndex["Description"]; has {
+		return imp.importAccount(rows)
+	}
+
+	return nil, ErrBadFormat
+}
+
+// ImportStatements imports both Transactions.csv and Account.csv returning
+// a single transaction stream sorted from the oldest
+func (imp *DegiroImporter) ImportStatements(transactions io.Reader, account io.Reader) ([]*Transaction, error) {
+	trades, err := imp.Import(transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	cash, err := imp.Import(account)
+	if err != nil {
+		return nil, err
+	}
+
+	outArr := append(trades, cash...)
+	sort.SliceStable(outArr, func(i, j int) bool {
+		return outArr[i].Time.Before(outArr[j].Time)
+	})
+
+	return outArr, nil
+}
+
+func init() {
+	RegisterImporter(NewDegiroImporter())
+}
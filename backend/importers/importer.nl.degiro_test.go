@@ -0,0 +1,82 @@
+package importers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/k3a/in2tracker/backend/marketdata"
+)
+
+func TestDegiro(t *testing.T) {
+	trsFile, err := os.Open("importer.nl.degiro_transactions_test.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trsFile.Close()
+
+	accFile, err := os.Open("importer.nl.degiro_account_test.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer accFile.Close()
+
+	imp := NewDegiroImporter()
+
+	trs, err := imp.ImportStatements(trsFile, accFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNum := 11
+	if len(trs) != wantNum {
+		t.Fatalf("wrong number of parsed transactions (%d parsed != %d)", len(trs), wantNum)
+	}
+
+	for i := 1; i < len(trs); i++ {
+		if trs[i].Time.Before(trs[i-1].Time) {
+			t.Fatal("transactions not sorted by time")
+		}
+	}
+
+	buy := trs[1]
+	if buy.Type != TTBuy || buy.Item != "US0378331005" || buy.ISIN != "US0378331005" ||
+		buy.Quantity != 10 || buy.Currency != "USD" {
+		t.Fatalf("bad buy parsed %v", buy)
+	}
+	if !marketdata.MarketEquals(buy.Market, marketdata.MarketUSANasdaq) {
+		t.Fatalf("bad venue parsed %s", buy.Market)
+	}
+	if buy.Fee != 0.54 || buy.FeeCurrency != "EUR" || buy.NetTotal > -2900.6 || buy.NetTotal < -2900.61 {
+		t.Fatalf("bad buy fee or net total %v", buy)
+	}
+
+	fx := trs[2]
+	if fx.Type != TTBuy || fx.Item != "USD" || fx.Currency != "EUR" ||
+		fx.Quantity != 2900 || fx.NetTotal != -2607.45 {
+		t.Fatalf("bad autoFX parsed %v", fx)
+	}
+
+	dividendFx := trs[5]
+	if dividendFx.Type != TTBuy || dividendFx.Item != "EUR" || dividendFx.Currency != "USD" {
+		t.Fatalf("bad dividend autoFX parsed %v", dividendFx)
+	}
+
+	xetra := trs[6]
+	if !marketdata.MarketEquals(xetra.Market, marketdata.MarketsEuropeFrankfurtXETRA) {
+		t.Fatalf("bad venue parsed %s", xetra.Market)
+	}
+
+	// conversions in the same minute without an order id are paired in order
+	firstFx, secondFx := trs[9], trs[10]
+	if firstFx.Item != "USD" || firstFx.Quantity != 122.5 || firstFx.NetTotal != -100 ||
+		secondFx.Item != "USD" || secondFx.Quantity != 61.25 || secondFx.NetTotal != -50 {
+		t.Fatalf("bad same-time autoFX parsed %v %v", firstFx, secondFx)
+	}
+
+	// ensure some basic rules
+	verifyImporter(trs, t)
+
+	for _, it := range trs {
+		t.Logf("%v", *it)
+	}
+}
@@ -0,0 +1,352 @@
+package importers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/lunny/log"
+)
+
+// IBKRFlexImporter imports Interactive Brokers Flex Query XML statements.
+// Trades, CashTransactions and CorporateActions sections are supported.
+type IBKRFlexImporter struct {
+	// location used for parsing statement times (IBKR reports in US Eastern time)
+	timeLoc *time.Location
+}
+
+// NewIBKRFlexImporter creates an Interactive Brokers Flex Query importer
+func NewIBKRFlexImporter() *IBKRFlexImporter {
+	timeLoc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		timeLoc = time.UTC
+	}
+	return &IBKRFlexImporter{timeLoc}
+}
+
+// Name returns a name of the importer
+func (imp *IBKRFlexImporter) Name() string {
+	return "interactivebrokers.com"
+}
+
+// Detect returns true if the header looks like Flex Query XML
+func (imp *IBKRFlexImporter) Detect(header []byte) bool {
+	return bytes.Contains(header, []byte("<FlexQueryResponse"))
+}
+
+type ibkrTrade struct {
+	LevelOfDetail        string `xml:"levelOfDetail,attr"`
+	AssetCategory        string `xml:"assetCategory,attr"`
+	Currency             string `xml:"currency,attr"`
+	Symbol               string `xml:"symbol,attr"`
+	ISIN                 string `xml:"isin,attr"`
+	DateTime             string `xml:"dateTime,attr"`
+	TradeDate            string `xml:"tradeDate,attr"`
+	TradeTime            string `xml:"tradeTime,attr"`
+	Quantity             string `xml:"quantity,attr"`
+	TradePrice           string `xml:"tradePrice,attr"`
+	IBCommission         string `xml:"ibCommission,attr"`
+	IBCommissionCurrency string `xml:"ibCommissionCurrency,attr"`
+	NetCash              string `xml:"netCash,attr"`
+	BuySell              string `xml:"buySell,attr"`
+	Description          string `xml:"description,attr"`
+}
+
+type ibkrCashTransaction struct {
+	LevelOfDetail string `xml:"levelOfDetail,attr"`
+	AccountID     string `xml:"accountId,attr"`
+	Currency      string `xml:"currency,attr"`
+	Symbol        string `xml:"symbol,attr"`
+	ISIN          string `xml:"isin,attr"`
+	DateTime      string `xml:"dateTime,attr"`
+	Amount        string `xml:"amount,attr"`
+	Type          string `xml:"type,attr"`
+	Description   string `xml:"description,attr"`
+}
+
+type ibkrCorporateAction struct {
+	LevelOfDetail string `xml:"levelOfDetail,attr"`
+	Currency      string `xml:"currency,attr"`
+	Symbol        string `xml:"symbol,attr"`
+	ISIN          string `xml:"isin,attr"`
+	DateTime      string `xml:"dateTime,attr"`
+	Type          string `xml:"type,attr"`
+	Description   string `xml:"description,attr"`
+}
+
+// time layouts used by Flex Queries, depending on the query settings
+var ibkrTimeLayouts = []string{
+	"20060102;150405",
+	"2006-01-02;15:04:05",
+	"20060102 150405",
+	"2006-01-02 15:04:05",
+	"20060102",
+	"2006-01-02",
+}
+
+var reIBKRSplit = regexp.MustCompile(`(?i)SPLIT\s+([\d.]+)\s+FOR\s+([\d.]+)`)
+
+func (imp *IBKRFlexImporter) parseTime(str string) (time.Time, error) {
+	str = strings.TrimSpace(str)
+	for _, layout := range ibkrTimeLayouts {
+		if t, err := time.ParseInLocation(layout, str, imp.timeLoc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, e("unable to parse ibkr date string %s", str)
+}
+
+// parseIBKRFloat parses optional float attribute (empty means zero)
+func parseIBKRFloat(str string) (float64, error) {
+	str = strings.TrimSpace(strings.Replace(str, ",", "", -1))
+	if len(str) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseFloat(str, 64)
+}
+
+// isIBKRSummary returns true if the row is a summary of other detail rows
+func isIBKRSummary(levelOfDetail string) bool {
+	return len(levelOfDetail) > 0 &&
+		!strings.EqualFold(levelOfDetail, "EXECUTION") &&
+		!strings.EqualFold(levelOfDetail, "DETAIL")
+}
+
+func (imp *IBKRFlexImporter) convertTrade(it *ibkrTrade) (*Transaction, error) {
+	tr := &Transaction{
+		Item:        strings.TrimSpace(it.Symbol),
+		ISIN:        strings.TrimSpace(it.ISIN),
+		Currency:    currency.FromString(it.Currency),
+		FeeCurrency: currency.FromString(it.IBCommissionCurrency),
+		Reference:   strings.TrimSpace(it.Description),
+	}
+
+	var err error
+	if len(it.DateTime) > 0 {
+		tr.Time, err = imp.parseTime(it.DateTime)
+	} else if len(strings.TrimSpace(it.TradeTime)) > 0 {
+		tr.Time, err = imp.parseTime(it.TradeDate + ";" + it.TradeTime)
+	} else {
+		tr.Time, err = imp.parseTime(it.TradeDate)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if tr.Quantity, err = parseIBKRFloat(it.Quantity); err != nil {
+		return nil, e("unable to parse trade quantity %s", it.Quantity)
+	}
+	if tr.Price, err = parseIBKRFloat(it.TradePrice); err != nil {
+		return nil, e("unable to parse trade price %s", it.TradePrice)
+	}
+	if tr.Fee, err = parseIBKRFloat(it.IBCommission); err != nil {
+		return nil, e("unable to parse trade commission %s", it.IBCommission)
+	}
+	if tr.NetTotal, err = parseIBKRFloat(it.NetCash); err != nil {
+		return nil, e("unable to parse trade net cash %s", it.NetCash)
+	}
+
+	// direction
+	switch strings.ToUpper(strings.TrimSpace(it.BuySell)) {
+	case "BUY":
+		tr.Type = TTBuy
+	case "SELL":
+		tr.Type = TTSell
+	default:
+		if tr.Quantity > 0 {
+			tr.Type = TTBuy
+		} else if tr.Quantity < 0 {
+			tr.Type = TTSell
+		} else {
+			return nil, e("unknown trade direction %s for %s", it.BuySell, it.Symbol)
+		}
+	}
+
+	// currency conversions are reported as EUR.USD - buying EUR for USD
+	if strings.EqualFold(it.AssetCategory, "CASH") {
+		if parts := strings.Split(tr.Item, "."); len(parts) == 2 {
+			tr.Item = parts[0]
+			tr.Currency = currency.FromString(parts[1])
+		}
+	}
+
+	tr.Quantity = math.Abs(tr.Quantity)
+	tr.Price = math.Abs(tr.Price)
+	tr.Fee = math.Abs(tr.Fee)
+	if tr.Fee == 0 {
+		tr.FeeCurrency = currency.Invalid
+	}
+
+	return tr, nil
+}
+
+func (imp *IBKRFlexImporter) convertCashTransaction(it *ibkrCashTransaction) (*Transaction, error) {
+	tr := &Transaction{
+		Item:        strings.TrimSpace(it.Symbol),
+		ISIN:        strings.TrimSpace(it.ISIN),
+		Currency:    currency.FromString(it.Currency),
+		FeeCurrency: currency.Invalid,
+		Reference:   strings.TrimSpace(it.Description),
+	}
+
+	var err error
+	if tr.Time, err = imp.parseTime(it.DateTime); err != nil {
+		return nil, err
+	}
+	if tr.NetTotal, err = parseIBKRFloat(it.Amount); err != nil {
+		return nil, e("unable to parse cash transaction amount %s", it.Amount)
+	}
+
+	switch strings.TrimSpace(it.Type) {
+	case "Dividends", "Payment In Lieu Of Dividends", "Withholding Tax":
+		// positive amount is income, negative tax paid
+		tr.Type = TTDividend
+	case "Deposits/Withdrawals", "Deposits & Withdrawals":
+		tr.Item = ""
+		if tr.NetTotal >= 0 {
+			tr.Type = TTDeposit
+		} else {
+			tr.Type = TTWithdrawal
+		}
+	case "Other Fees", "Commission Adjustments", "Broker Interest Paid":
+		tr.Type = TTFee
+		if tr.NetTotal < 0 {
+			tr.Fee = -tr.NetTotal
+			tr.FeeCurrency = tr.Currency
+		}
+	case "Broker Interest Received", "Bond Interest Received":
+		tr.Type = TTInterest
+		if len(tr.Item) == 0 {
+			// interest on cash balance, use the currency as the item
+			tr.Item = string(tr.Currency)
+		}
+	default:
+		return nil, e("unknown cash transaction type %s: %s", it.Type, it.Description)
+	}
+
+	return tr, nil
+}
+
+// convertCorporateAction converts splits, other corporate actions are skipped (nil returned)
+func (imp *IBKRFlexImporter) convertCorporateAction(it *ibkrCorporateAction) (*Transaction, error) {
+	switch strings.TrimSpace(it.Type) {
+	case "FS", "RS": // forward split, reverse split
+		arr := reIBKRSplit.FindStringSubmatch(it.Description)
+		if len(arr) != 3 {
+			return nil, e("unable to parse split ratio from %s", it.Description)
+		}
+		newShares, err := strconv.ParseFloat(arr[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		oldShares, err := strconv.ParseFloat(arr[2], 64)
+		if err != nil || oldShares == 0 {
+			return nil, e("bad split ratio in %s", it.Description)
+		}
+
+		tr := &Transaction{
+			Type:        TTSplitMultiplier,
+			Item:        strings.TrimSpace(it.Symbol),
+			ISIN:        strings.TrimSpace(it.ISIN),
+			Quantity:    newShares / oldShares,
+			Currency:    currency.FromString(it.Currency),
+			FeeCurrency: currency.Invalid,
+			Reference:   strings.TrimSpace(it.Description),
+		}
+		if tr.Time, err = imp.parseTime(it.DateTime); err != nil {
+			return nil, err
+		}
+		return tr, nil
+	}
+
+	// mergers, spinoffs etc. have to be entered manually
+	log.Warnf("ibkr: skipping unsupported corporate action %s: %s", it.Type, it.Description)
+	return nil, nil
+}
+
+// Import parses data from the reader and returns transactions
+func (imp *IBKRFlexImporter) Import(reader io.Reader) ([]*Transaction, error) {
+	dec := xml.NewDecoder(reader)
+
+	var outArr []*Transaction
+	rootFound := false
+	splits := make(map[string]bool)
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, e("problem decoding flex query xml: %v", err)
+		}
+
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var tr *Transaction
+		switch se.Name.Local {
+		case "FlexQueryResponse":
+			rootFound = true
+		case "Trade":
+			var it ibkrTrade
+			if err := dec.DecodeElement(&it, &se); err != nil {
+				return nil, err
+			}
+			if isIBKRSummary(it.LevelOfDetail) {
+				continue
+			}
+			tr, err = imp.convertTrade(&it)
+		case "CashTransaction":
+			var it ibkrCashTransaction
+			if err := dec.DecodeElement(&it, &se); err != nil {
+				return nil, err
+			}
+			if isIBKRSummary(it.LevelOfDetail) {
+				continue
+			}
+			tr, err = imp.convertCashTransaction(&it)
+		case "CorporateAction":
+			var it ibkrCorporateAction
+			if err := dec.DecodeElement(&it, &se); err != nil {
+				return nil, err
+			}
+			if isIBKRSummary(it.LevelOfDetail) {
+				continue
+			}
+			tr, err = imp.convertCorporateAction(&it)
+			if err == nil && tr != nil {
+				// a split is often reported as several rows (removal and addition)
+				key := tr.Item + tr.Time.Format("20060102")
+				if splits[key] {
+					continue
+				}
+				splits[key] = true
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		if tr != nil {
+			outArr = append(outArr, tr)
+		}
+	}
+
+	if !rootFound {
+		return nil, ErrBadFormat
+	}
+
+	return outArr, nil
+}
+
+func init() {
+	RegisterImporter(NewIBKRFlexImporter())
+}
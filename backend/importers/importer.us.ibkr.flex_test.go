@@ -0,0 +1,76 @@
+package importers
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIBKRFlex(t *testing.T) {
+	file, err := os.Open("importer.us.ibkr.flex_test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	imp := NewIBKRFlexImporter()
+
+	trs, err := imp.Import(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNum := 12
+	if len(trs) != wantNum {
+		t.Fatalf("wrong number of parsed transactions (%d parsed != %d)", len(trs), wantNum)
+	}
+
+	fx := trs[0]
+	if fx.Type != TTSell || fx.Item != "EUR" || fx.Currency != "USD" || fx.ISIN != "" {
+		t.Fatalf("bad currency conversion parsed %v", fx)
+	}
+
+	buy := trs[1]
+	if buy.Type != TTBuy || buy.Item != "AAPL" || buy.Quantity != 10 || buy.NetTotal != -1162.5 || buy.Fee != 1 ||
+		buy.ISIN != "US0378331005" {
+		t.Fatalf("bad buy parsed %v", buy)
+	}
+	if buy.Time.Day() != 5 || buy.Time.Hour() != 10 || buy.Time.Minute() != 15 {
+		t.Fatal("bad time parsed")
+	}
+
+	sell := trs[3]
+	if sell.Type != TTSell || sell.Quantity != 20 || sell.NetTotal != 2168.98 {
+		t.Fatalf("bad sell parsed %v", sell)
+	}
+
+	noTime := trs[4]
+	if noTime.Type != TTSell || noTime.Item != "T" || noTime.Time.Day() != 5 || noTime.Time.Hour() != 0 {
+		t.Fatalf("bad trade without time parsed %v", noTime)
+	}
+
+	for _, it := range trs {
+		if it.Type == TTInterest && it.Item != "USD" {
+			t.Fatalf("bad interest item %v", it)
+		}
+	}
+
+	split := trs[len(trs)-1]
+	if split.Type != TTSplitMultiplier || split.Quantity != 4 || split.ISIN != "US0378331005" {
+		t.Fatalf("bad split parsed %v", split)
+	}
+
+	// ensure some basic rules
+	verifyImporter(trs, t)
+
+	for _, it := range trs {
+		t.Logf("%v", *it)
+	}
+}
+
+func TestIBKRFlexBadFormat(t *testing.T) {
+	_, err := NewIBKRFlexImporter().Import(strings.NewReader(`<html><body>not a flex query</body></html>`))
+	if err != ErrBadFormat {
+		t.Fatalf("expected ErrBadFormat, got %v", err)
+	}
+}
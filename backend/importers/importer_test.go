@@ -0,0 +1,129 @@
+package importers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	files := map[string]string{
+		"importer.cz.fio.ebroker_test.csv":         "fio.cz",
+		"importer.us.ibkr.flex_test.xml":           "interactivebrokers.com",
+		"importer.nl.degiro_transactions_test.csv": "degiro.com",
+		"importer.nl.degiro_account_test.csv":      "degiro.com",
+	}
+
+	for filePath, wantName := range files {
+		file, err := os.Open(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		imp, rd, err := Detect(file)
+		if err != nil {
+			t.Fatalf("unable to detect format of %s: %v", filePath, err)
+		}
+		if imp.Name() != wantName {
+			t.Fatalf("wrong importer %s detected for %s", imp.Name(), filePath)
+		}
+		if FromName(wantName) != imp {
+			t.Fatalf("importer %s not found by name", wantName)
+		}
+
+		// the returned reader must still provide the complete data
+		trs, err := imp.Import(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(trs) == 0 {
+			t.Fatalf("no transactions imported from %s", filePath)
+		}
+	}
+
+	_, _, err := Detect(strings.NewReader("unknown;file;format;\n1;2;3;\n"))
+	if err != ErrUnknownFormat {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestImportConcurrent(t *testing.T) {
+	// registered importers are shared, e.g. by concurrent API uploads
+	files := []string{
+		"importer.cz.fio.ebroker_test.csv",
+		"importer.us.ibkr.flex_test.xml",
+		"importer.nl.degiro_transactions_test.csv",
+		"importer.nl.degiro_account_test.csv",
+	}
+
+	for _, filePath := range files {
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		counts := make([]int, 8)
+		errs := make([]error, len(counts))
+		for i := range counts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				imp, rd, err := Detect(bytes.NewReader(data))
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				trs, err := imp.Import(rd)
+				counts[i], errs[i] = len(trs), err
+			}(i)
+		}
+		wg.Wait()
+
+		for i := range counts {
+			if errs[i] != nil {
+				t.Fatalf("unable to import %s: %v", filePath, errs[i])
+			}
+			if counts[i] != counts[0] {
+				t.Fatalf("concurrent imports of %s differ (%d != %d)", filePath, counts[i], counts[0])
+			}
+		}
+	}
+}
+
+func TestModelRoundTrip(t *testing.T) {
+	file, err := os.Open("importer.nl.degiro_transactions_test.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	trs, err := NewDegiroImporter().Import(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tr := range trs {
+		mt := tr.Model(3)
+		if mt.PortfolioID != 3 || mt.Hash != tr.Hash() {
+			t.Fatalf("bad model created %#v", mt)
+		}
+
+		back := TransactionFromModel(mt)
+		if back.Hash() != tr.Hash() || back.Type != tr.Type || back.Fee != tr.Fee ||
+			back.FeeCurrency != tr.FeeCurrency || back.Market != tr.Market || back.ISIN != tr.ISIN {
+			t.Fatalf("transaction changed after conversion %v != %v", back, tr)
+		}
+	}
+
+	// the stored (occurrence) hash is kept
+	mt := trs[0].Model(3)
+	mt.Hash = "occurrence"
+	if back := TransactionFromModel(mt); back.Hash() != "occurrence" {
+		t.Fatalf("stored hash not kept %s", back.Hash())
+	}
+}
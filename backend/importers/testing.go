@@ -17,8 +17,12 @@ import (
 - TTWithdrawal and TTDeposit must have quantity, price and item(ticker) empty or zero
 - TTDividend and TTInterest must have non-empty item (ticker)
 - TTSplitMultiplier must have multiplier in the quantity
+- TTCashInLieu must have non-empty item, fractional quantity and NetTotal positive or zero
 */
 
+// testRates caches rates shared by all importer tests
+var testRates = currency.NewCachingConverter(nil, currency.DefaultCacheSize)
+
 var epsilon = math.Nextafter(1.0, 2.0) - 1.0
 
 func verifyImporter(trs []*Transaction, t *testing.T) {
@@ -47,7 +51,7 @@ func verifyImporter(trs []*Transaction, t *testing.T) {
 			t.Fatalf("TTSell must have negative or zero NetTotal %v", *it)
 		}
 
-		fee, _ := currency.Convert(it.Fee, it.FeeCurrency, it.Currency, it.Time)
+		fee, _ := testRates.Convert(it.Fee, it.FeeCurrency, it.Currency, it.Time)
 		if it.Type == TTDeposit {
 			if !(it.NetTotal+epsilon >= -fee) {
 				t.Fatalf("TTDeposit : NetTotal >= -Fee %v", *it)
@@ -90,5 +94,17 @@ func verifyImporter(trs []*Transaction, t *testing.T) {
 			}
 		}
 
+		if it.Type == TTCashInLieu {
+			if len(it.Item) == 0 {
+				t.Fatalf("TTCashInLieu must have non-empty Item (ticker) %v", *it)
+			}
+			if it.Quantity <= 0 || it.Quantity >= 1 {
+				t.Fatalf("TTCashInLieu must have fractional Quantity %v", *it)
+			}
+			if it.NetTotal < 0 {
+				t.Fatalf("TTCashInLieu must have positive or zero NetTotal %v", *it)
+			}
+		}
+
 	}
 }
@@ -1,24 +1,27 @@
 package main
 
 import (
-	"time"
+	"log"
 
+	"github.com/alexflint/go-arg"
+	"github.com/k3a/in2tracker/backend/api"
 	"github.com/k3a/in2tracker/backend/store"
-	//"ndemiccreations.com/rest"
-	_ "github.com/mattn/go-sqlite3" //sqlite driver
 )
 
-type User struct {
-	ID           uint
-	Name         string `gorm:"type:varchar(60)"`
-	EMail        string `gorm:"not null;varchar(128);unique"`
-	Password     string `gorm:"type:varchar(60)"`
-	Created      time.Time
-	LastLoggedIn time.Time
-}
-
 func main() {
-	/*stor :=*/ store.New("sqlite3", "/tmp/qtest.db")
+	var args struct {
+		Listen            string `arg:"-l,help:address to listen on"`
+		DSN               string `arg:"help:sqlite3 database file"`
+		AllowRegistration bool   `arg:"help:allow creating new user accounts"`
+	}
+	args.Listen = ":3434"
+	args.DSN = "database.db"
+	arg.MustParse(&args)
+
+	// only sqlite3 migrations are provided
+	stor := store.New("sqlite3", args.DSN)
 
-	//rest.ListenAndServe(":3434", nil)
+	srv := api.New(stor)
+	srv.AllowRegistration = args.AllowRegistration
+	log.Fatal(srv.ListenAndServe(args.Listen))
 }
@@ -1,36 +1,19 @@
 package marketdata
 
 import (
-	"strings"
+	"context"
 	"time"
 )
 
-var pairToProvider = make(map[string]Provider)
-
 func mipair(market *Market, item string) string {
 	return market.String() + ":" + item
 }
 
-// GetItemMarketData returns item price on the market at the specific time
+// GetItemMarketData returns item price on the market at the specific time.
+// Item can be a comma-separated list of alternative item identifiers.
+// Uses the DefaultResolver.
 func GetItemMarketData(market *Market, item string, at time.Time) (*MarketData, error) {
-	for _, item := range strings.Split(item, ",") {
-		pair := mipair(market, item)
-
-		if provider, has := pairToProvider[pair]; has {
-			if md, err := provider.GetMarketData(market, item, at); err == nil {
-				return md, err
-			}
-		}
-
-		for _, provider := range Providers {
-			if md, err := provider.GetMarketData(market, item, at); err == nil {
-				pairToProvider[pair] = provider
-				return md, err
-			}
-		}
-	}
-
-	return nil, ErrNotAvailable
+	return DefaultResolver().GetItemMarketData(market, item, at)
 }
 
 // GetItemMarketDataNow returns item price on the market now
@@ -38,40 +21,32 @@ func GetItemMarketDataNow(market *Market, item string) (*MarketData, error) {
 	return GetItemMarketData(market, item, time.Now())
 }
 
-// GetItemMarketDataForDateRange returns list of item prices between specified tfrom and tto dates
+// GetItemMarketDataForDateRange returns list of item prices between specified tfrom and tto dates.
+// Uses the DefaultResolver.
 func GetItemMarketDataForDateRange(market *Market, item string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error) {
-	pair := mipair(market, item)
-
-	if provider, has := pairToProvider[pair]; has && provider.SupportsDateRange() {
-		if prices, err := provider.GetMarketDataForDateRange(market, item, tfrom, tto); err == nil {
-			return prices, err
-		}
-	}
-
-	for _, provider := range Providers {
-		if !provider.SupportsDateRange() {
-			continue
-		}
-		if prices, err := provider.GetMarketDataForDateRange(market, item, tfrom, tto); err == nil {
-			pairToProvider[pair] = provider
-			return prices, err
-		}
-	}
-
-	return nil, ErrNotAvailable
+	return DefaultResolver().GetItemMarketDataForDateRange(market, item, tfrom, tto)
 }
 
 // GetItemInfo returns item info
-// Parameter market can be empty
+// Parameter market can be empty. Uses the DefaultResolver.
 func GetItemInfo(market *Market, item string) (*ItemInfo, error) {
-	for _, p := range Providers {
-		if !p.Supports(market, item) {
-			continue
-		}
-		if ii, err := p.GetItemInfo(market, item); err == nil {
-			return ii, nil
-		}
-	}
+	return DefaultResolver().GetItemInfo(market, item)
+}
+
+// GetItemMarketDataContext returns item price like GetItemMarketData. Fetching data stops
+// when ctx is canceled or its deadline is exceeded.
+func GetItemMarketDataContext(ctx context.Context, market *Market, item string, at time.Time) (*MarketData, error) {
+	return DefaultResolver().GetItemMarketDataContext(ctx, market, item, at)
+}
+
+// GetItemMarketDataForDateRangeContext returns list of item prices like GetItemMarketDataForDateRange.
+// Fetching data stops when ctx is canceled or its deadline is exceeded.
+func GetItemMarketDataForDateRangeContext(ctx context.Context, market *Market, item string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error) {
+	return DefaultResolver().GetItemMarketDataForDateRangeContext(ctx, market, item, tfrom, tto)
+}
 
-	return nil, ErrNotAvailable
+// GetItemInfoContext returns item info like GetItemInfo. Fetching data stops
+// when ctx is canceled or its deadline is exceeded.
+func GetItemInfoContext(ctx context.Context, market *Market, item string) (*ItemInfo, error) {
+	return DefaultResolver().GetItemInfoContext(ctx, market, item)
 }
@@ -16,6 +16,15 @@ func (mkt *Market) String() string {
 	return strings.Join(mkt.idents, ",")
 }
 
+// Code returns the primary market identifier usable with MarketFromString
+// (empty string for MarketAny or nil)
+func (mkt *Market) Code() string {
+	if mkt == nil || len(mkt.idents) == 0 {
+		return ""
+	}
+	return mkt.idents[0]
+}
+
 // IdentifierForReceiver returns identifier used by the specified receiver
 // or empty string if there is no binding
 func (mkt *Market) IdentifierForReceiver(receiver string) string {
@@ -77,12 +86,12 @@ func registerMarket(idents ...string) *Market {
 // Market identifier
 var (
 	MarketAny                    = registerMarket("")
-	MarketUSANYSE                = registerMarket("NYSE", "XNYS", "NYQ")
+	MarketUSANYSE                = registerMarket("NYSE", "XNYS", "NYQ", "NSY")
 	MarketUSANYSEArca            = registerMarket("NYSEARCA", "ARCX")
-	MarketUSANasdaq              = registerMarket("NASDAQ", "XNGS", "XNAS", "NMS")
-	MarketsEuropeFrankfurtBoerse = registerMarket("FWB", "FRA")
-	MarketsEuropeFrankfurtXETRA  = registerMarket("IBIS", "XETRA")
-	MarketsEuropeLSE             = registerMarket("LSE", "TRQXUK")
+	MarketUSANasdaq              = registerMarket("NASDAQ", "XNGS", "XNAS", "NMS", "NDQ")
+	MarketsEuropeFrankfurtBoerse = registerMarket("FWB", "FRA", "XFRA")
+	MarketsEuropeFrankfurtXETRA  = registerMarket("IBIS", "XETRA", "XETR", "XET")
+	MarketsEuropeLSE             = registerMarket("LSE", "TRQXUK", "XLON")
 )
 
 // MarketFromString returns market identifier from string or MarketAny if not known
@@ -1,6 +1,7 @@
 package marketdata
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"time"
@@ -67,6 +68,41 @@ type Provider interface {
 	GetItemInfo(market *Market, item string) (*ItemInfo, error)
 }
 
+// ContextProvider is a Provider able to stop fetching data when the context
+// is canceled or its deadline is exceeded
+type ContextProvider interface {
+	// GetMarketDataContext gets the market price like GetMarketData
+	GetMarketDataContext(ctx context.Context, market *Market, item string, at time.Time) (*MarketData, error)
+	// GetMarketDataForDateRangeContext returns historical data like GetMarketDataForDateRange
+	GetMarketDataForDateRangeContext(ctx context.Context, market *Market, item string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error)
+	// GetItemInfoContext returns item information like GetItemInfo
+	GetItemInfoContext(ctx context.Context, market *Market, item string) (*ItemInfo, error)
+}
+
+// getMarketData gets the market price from the provider, using the context if supported
+func getMarketData(ctx context.Context, p Provider, market *Market, item string, at time.Time) (*MarketData, error) {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp.GetMarketDataContext(ctx, market, item, at)
+	}
+	return p.GetMarketData(market, item, at)
+}
+
+// getMarketDataForDateRange gets historical data from the provider, using the context if supported
+func getMarketDataForDateRange(ctx context.Context, p Provider, market *Market, item string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error) {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp.GetMarketDataForDateRangeContext(ctx, market, item, tfrom, tto)
+	}
+	return p.GetMarketDataForDateRange(market, item, tfrom, tto)
+}
+
+// getItemInfo gets item information from the provider, using the context if supported
+func getItemInfo(ctx context.Context, p Provider, market *Market, item string) (*ItemInfo, error) {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp.GetItemInfoContext(ctx, market, item)
+	}
+	return p.GetItemInfo(market, item)
+}
+
 // Providers holds all available currency rate providers
 var Providers []Provider
 
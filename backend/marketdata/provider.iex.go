@@ -1,6 +1,7 @@
 package marketdata
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -68,10 +69,20 @@ func (md *IEXProvider) GetMarketDataForDateRange(market *Market, ticker string,
 	return nil, ErrNotAvailable
 }
 
+// GetMarketDataForDateRangeContext returns historical data like GetMarketDataForDateRange
+func (md *IEXProvider) GetMarketDataForDateRangeContext(ctx context.Context, market *Market, ticker string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error) {
+	return md.GetMarketDataForDateRange(market, ticker, tfrom, tto)
+}
+
 // GetMarketData gets the market price at the specific time.
 // market: market identifier (NASDAQ, CURRENCY)
 // ticker: stock ticker (APPLE, USDCZK)
 func (md *IEXProvider) GetMarketData(market *Market, ticker string, at time.Time) (*MarketData, error) {
+	return md.GetMarketDataContext(context.Background(), market, ticker, at)
+}
+
+// GetMarketDataContext gets the market price like GetMarketData, stopping when ctx is done
+func (md *IEXProvider) GetMarketDataContext(ctx context.Context, market *Market, ticker string, at time.Time) (*MarketData, error) {
 	// unfortunatelly it doesn't differentiate between markets, it just uses tickers
 	if !md.Supports(market, ticker) {
 		return nil, ErrNotAvailable
@@ -81,7 +92,12 @@ func (md *IEXProvider) GetMarketData(market *Market, ticker string, at time.Time
 
 	url := fmt.Sprintf("https://api.iextrading.com/1.0/stock/%s/quote", url.PathEscape(strings.ToLower(ticker)))
 
-	resp, err := md.httpClient.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, iexError("http error: %v", err)
+	}
+
+	resp, err := md.httpClient.Do(req)
 	if err != nil {
 		return nil, iexError("http error: %v", err)
 	}
@@ -122,6 +138,11 @@ func (md *IEXProvider) GetItemInfo(market *Market, item string) (*ItemInfo, erro
 	return nil, ErrNotAvailable
 }
 
+// GetItemInfoContext returns item information like GetItemInfo
+func (md *IEXProvider) GetItemInfoContext(ctx context.Context, market *Market, item string) (*ItemInfo, error) {
+	return md.GetItemInfo(market, item)
+}
+
 func init() {
 	RegisterProvider(NewIEXProvider())
 }
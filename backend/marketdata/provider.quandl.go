@@ -1,6 +1,7 @@
 package marketdata
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"time"
@@ -45,12 +46,17 @@ func (p *QuandlProvider) Supports(market *Market, item string) bool {
 // market: market identifier (NASDAQ, CURRENCY)
 // item: stock ticker or item identifier (APPLE, USDCZK)
 func (p *QuandlProvider) GetMarketData(market *Market, item string, at time.Time) (*MarketData, error) {
+	return p.GetMarketDataContext(context.Background(), market, item, at)
+}
+
+// GetMarketDataContext gets the market price like GetMarketData, stopping when ctx is done
+func (p *QuandlProvider) GetMarketDataContext(ctx context.Context, market *Market, item string, at time.Time) (*MarketData, error) {
 	if time.Since(at) < 12 {
 		// we have EOD data only
 		return nil, ErrNotAvailable
 	}
 
-	prices, err := p.GetMarketDataForDateRange(market, item, at, at)
+	prices, err := p.GetMarketDataForDateRangeContext(ctx, market, item, at, at)
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +78,12 @@ func (p *QuandlProvider) SupportsDateRange() bool {
 
 // GetMarketDataForDateRange returns historical data from tfrom to tto dates.
 func (p *QuandlProvider) GetMarketDataForDateRange(market *Market, item string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error) {
+	return p.GetMarketDataForDateRangeContext(context.Background(), market, item, tfrom, tto)
+}
+
+// GetMarketDataForDateRangeContext returns historical data like GetMarketDataForDateRange,
+// stopping when ctx is done
+func (p *QuandlProvider) GetMarketDataForDateRangeContext(ctx context.Context, market *Market, item string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error) {
 
 	fromDateStr := url.QueryEscape(tfrom.Format("20060102"))
 	toDateStr := url.QueryEscape(tto.Format("20060102"))
@@ -81,7 +93,12 @@ func (p *QuandlProvider) GetMarketDataForDateRange(market *Market, item string,
 		"&date.gte=%s&date.lte=%s",
 		url.QueryEscape(item), url.QueryEscape(p.apiKey), fromDateStr, toDateStr)
 
-	resp, err := p.httpCli.Get(u)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpCli.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -135,6 +152,11 @@ func (p *QuandlProvider) GetItemInfo(market *Market, item string) (*ItemInfo, er
 	return nil, ErrNotAvailable
 }
 
+// GetItemInfoContext returns item information like GetItemInfo
+func (p *QuandlProvider) GetItemInfoContext(ctx context.Context, market *Market, item string) (*ItemInfo, error) {
+	return p.GetItemInfo(market, item)
+}
+
 func init() {
 	// getting deprecated https://www.quandl.com/databases/WIKIP
 	RegisterProvider(NewQuandlProvider("xgafvQ_VZLuFbT7yDwxW" /*SECRET: */))
@@ -0,0 +1,174 @@
+package marketdata
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/utils"
+)
+
+// Resolver gets market data selecting providers for market-item pairs. It remembers
+// the provider working for each pair and skips providers failing for the pair until
+// they are re-probed. It is safe for concurrent use.
+type Resolver struct {
+	// Selector tracks selected providers and their health per pair
+	Selector *utils.ProviderSelector
+
+	// providers used (registered Providers if nil)
+	providers []Provider
+}
+
+// suffixes of selector keys for data other than the market price
+const (
+	rangeKeySuffix = "#range"
+	infoKeySuffix  = "#info"
+)
+
+var (
+	defaultResolver   = NewResolver()
+	defaultResolverMu sync.RWMutex
+)
+
+// NewResolver creates a resolver using the providers in the order of preference.
+// The registered Providers are used if none are specified.
+func NewResolver(providers ...Provider) *Resolver {
+	return &Resolver{
+		Selector:  utils.NewProviderSelector(),
+		providers: providers,
+	}
+}
+
+// DefaultResolver returns the resolver used by the package-level functions
+func DefaultResolver() *Resolver {
+	defaultResolverMu.RLock()
+	defer defaultResolverMu.RUnlock()
+	return defaultResolver
+}
+
+// SetDefaultResolver replaces the resolver used by the package-level functions
+func SetDefaultResolver(r *Resolver) {
+	defaultResolverMu.Lock()
+	defer defaultResolverMu.Unlock()
+	defaultResolver = r
+}
+
+// Providers returns the providers used by the resolver
+func (r *Resolver) Providers() []Provider {
+	if r.providers != nil {
+		return r.providers
+	}
+	return Providers
+}
+
+// Health returns the health of the provider for market prices of the item
+func (r *Resolver) Health(market *Market, item string, provider Provider) utils.ProviderHealth {
+	return r.Selector.Health(mipair(market, item), provider)
+}
+
+// each calls fn for the providers in the order given by the selector for the key
+// until it succeeds. Providers failing with an error other than ErrNotAvailable
+// are skipped for the key until re-probed. Stops with the ctx error when ctx is done.
+func (r *Resolver) each(ctx context.Context, key string, fn func(p Provider) error) error {
+	providers := r.Providers()
+	candidates := make([]interface{}, len(providers))
+	for i, p := range providers {
+		candidates[i] = p
+	}
+
+	for _, i := range r.Selector.Order(key, candidates) {
+		provider := providers[i]
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := fn(provider)
+		if err == nil {
+			r.Selector.Succeeded(key, provider)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != ErrNotAvailable && err != errSkip {
+			r.Selector.Failed(key, provider, err)
+		}
+	}
+
+	return ErrNotAvailable
+}
+
+// errSkip is returned to each for providers not supporting the request
+var errSkip = e("provider skipped")
+
+// GetItemMarketData returns item price on the market at the specific time.
+// Item can be a comma-separated list of alternative item identifiers.
+func (r *Resolver) GetItemMarketData(market *Market, item string, at time.Time) (*MarketData, error) {
+	return r.GetItemMarketDataContext(context.Background(), market, item, at)
+}
+
+// GetItemMarketDataContext returns item price like GetItemMarketData, stopping when ctx is done
+func (r *Resolver) GetItemMarketDataContext(ctx context.Context, market *Market, item string, at time.Time) (*MarketData, error) {
+	for _, item := range strings.Split(item, ",") {
+		var md *MarketData
+		err := r.each(ctx, mipair(market, item), func(p Provider) (err error) {
+			md, err = getMarketData(ctx, p, market, item, at)
+			return err
+		})
+		if err == nil {
+			return md, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
+	return nil, ErrNotAvailable
+}
+
+// GetItemMarketDataForDateRange returns list of item prices between specified tfrom and tto dates
+func (r *Resolver) GetItemMarketDataForDateRange(market *Market, item string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error) {
+	return r.GetItemMarketDataForDateRangeContext(context.Background(), market, item, tfrom, tto)
+}
+
+// GetItemMarketDataForDateRangeContext returns list of item prices like GetItemMarketDataForDateRange,
+// stopping when ctx is done
+func (r *Resolver) GetItemMarketDataForDateRangeContext(ctx context.Context, market *Market, item string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error) {
+	var prices []*TimedMarketData
+	err := r.each(ctx, mipair(market, item)+rangeKeySuffix, func(p Provider) (err error) {
+		if !p.SupportsDateRange() {
+			return errSkip
+		}
+		prices, err = getMarketDataForDateRange(ctx, p, market, item, tfrom, tto)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return prices, nil
+}
+
+// GetItemInfo returns item info
+// Parameter market can be empty.
+func (r *Resolver) GetItemInfo(market *Market, item string) (*ItemInfo, error) {
+	return r.GetItemInfoContext(context.Background(), market, item)
+}
+
+// GetItemInfoContext returns item info like GetItemInfo, stopping when ctx is done
+func (r *Resolver) GetItemInfoContext(ctx context.Context, market *Market, item string) (*ItemInfo, error) {
+	var ii *ItemInfo
+	err := r.each(ctx, mipair(market, item)+infoKeySuffix, func(p Provider) (err error) {
+		if !p.Supports(market, item) {
+			return errSkip
+		}
+		ii, err = getItemInfo(ctx, p, market, item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ii, nil
+}
@@ -0,0 +1,162 @@
+package marketdata
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider returns fixed prices of known items and fails with err while it is set
+type fakeProvider struct {
+	name   string
+	prices map[string]float64
+
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Supports(market *Market, item string) bool {
+	_, has := p.prices[item]
+	return has
+}
+
+func (p *fakeProvider) GetMarketData(market *Market, item string, at time.Time) (*MarketData, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	price, has := p.prices[item]
+	if !has {
+		return nil, ErrNotAvailable
+	}
+	return &MarketData{Time: at, LastTrade: price, Currency: currency.USD}, nil
+}
+
+func (p *fakeProvider) SupportsDateRange() bool { return false }
+
+func (p *fakeProvider) GetMarketDataForDateRange(market *Market, item string, tfrom time.Time, tto time.Time) ([]*TimedMarketData, error) {
+	return nil, ErrNotAvailable
+}
+
+func (p *fakeProvider) SupportsItemInfo() bool { return true }
+
+func (p *fakeProvider) GetItemInfo(market *Market, item string) (*ItemInfo, error) {
+	return &ItemInfo{Name: p.name + " " + item}, nil
+}
+
+func (p *fakeProvider) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func (p *fakeProvider) numCalls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func TestResolver(t *testing.T) {
+	now := time.Date(2020, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	primary := &fakeProvider{name: "primary", prices: map[string]float64{"AAPL": 100}}
+	backup := &fakeProvider{name: "backup", prices: map[string]float64{"AAPL": 101, "IBM": 50}}
+
+	r := NewResolver(primary, backup)
+	r.Selector.Now = func() time.Time { return now }
+
+	// alternative identifiers
+	md, err := r.GetItemMarketData(MarketAny, "XXX,IBM", now)
+	require.Nil(t, err)
+	require.Equal(t, 50.0, md.LastTrade)
+	require.True(t, r.Health(MarketAny, "XXX", primary).Healthy())
+
+	md, err = r.GetItemMarketData(MarketAny, "AAPL", now)
+	require.Nil(t, err)
+	require.Equal(t, 100.0, md.LastTrade)
+
+	// failing provider is skipped until re-probed
+	primary.setErr(errors.New("connection refused"))
+	md, err = r.GetItemMarketData(MarketAny, "AAPL", now)
+	require.Nil(t, err)
+	require.Equal(t, 101.0, md.LastTrade)
+	require.Equal(t, 1, r.Health(MarketAny, "AAPL", primary).Failures)
+
+	primary.setErr(nil)
+	calls := primary.numCalls()
+	_, err = r.GetItemMarketData(MarketAny, "AAPL", now)
+	require.Nil(t, err)
+	require.Equal(t, calls, primary.numCalls())
+
+	now = now.Add(r.Selector.RetryAfter + r.Selector.TTL)
+	md, err = r.GetItemMarketData(MarketAny, "AAPL", now)
+	require.Nil(t, err)
+	require.Equal(t, 100.0, md.LastTrade)
+	require.True(t, r.Health(MarketAny, "AAPL", primary).Healthy())
+
+	ii, err := r.GetItemInfo(MarketAny, "IBM")
+	require.Nil(t, err)
+	require.Equal(t, "backup IBM", ii.Name)
+
+	_, err = r.GetItemMarketDataForDateRange(MarketAny, "AAPL", now.AddDate(0, 0, -7), now)
+	require.Equal(t, ErrNotAvailable, err)
+}
+
+func TestResolverConcurrent(t *testing.T) {
+	flaky := &fakeProvider{name: "flaky", prices: map[string]float64{"AAPL": 100, "IBM": 50}}
+	stable := &fakeProvider{name: "stable", prices: map[string]float64{"AAPL": 100, "IBM": 50}}
+	r := NewResolver(flaky, stable)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if j%10 == 0 {
+					if i%2 == 0 {
+						flaky.setErr(errors.New("timeout"))
+					} else {
+						flaky.setErr(nil)
+					}
+				}
+
+				md, err := r.GetItemMarketData(MarketAny, "AAPL", time.Now())
+				require.Nil(t, err)
+				require.Equal(t, 100.0, md.LastTrade)
+
+				_, err = r.GetItemInfo(MarketAny, "IBM")
+				require.Nil(t, err)
+				r.Health(MarketAny, "AAPL", flaky)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestResolverContext(t *testing.T) {
+	prov := &fakeProvider{name: "fake", prices: map[string]float64{"AAPL": 100}}
+	r := NewResolver(prov)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := r.GetItemMarketDataContext(ctx, MarketAny, "XXX,AAPL", time.Now())
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, 0, prov.numCalls())
+	require.True(t, r.Health(MarketAny, "AAPL", prov).Healthy())
+
+	_, err = r.GetItemInfoContext(ctx, MarketAny, "AAPL")
+	require.Equal(t, context.Canceled, err)
+}
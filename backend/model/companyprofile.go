@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// CompanyOfficer holds a company executive
+type CompanyOfficer struct {
+	Name       string
+	Title      string
+	Age        int
+	FiscalYear int
+	// TotalPay is the yearly pay in the company currency
+	TotalPay int64
+}
+
+// CompanyProfile holds complete company information fetched from company data providers
+type CompanyProfile struct {
+	ID              int64            `meddler:"id,pk"`
+	Code            string           `meddler:"code"`
+	Name            string           `meddler:"name"`
+	Sector          string           `meddler:"sector"`
+	Industry        string           `meddler:"industry"`
+	BusinessSummary string           `meddler:"business_summary"`
+	Address         string           `meddler:"address"`
+	City            string           `meddler:"city"`
+	State           string           `meddler:"state"`
+	Zip             string           `meddler:"zip"`
+	Country         string           `meddler:"country"`
+	Website         string           `meddler:"website"`
+	Employees       int              `meddler:"employees"`
+	Officers        []CompanyOfficer `meddler:"officers,json"`
+	// Sources maps fields to the names of the providers which supplied them
+	Sources map[string]string `meddler:"sources,json"`
+	// Fetched is the time the profile has been downloaded
+	Fetched time.Time `meddler:"fetched,localtime"`
+}
+
+// GetAddress returns the structured company address
+func (cp *CompanyProfile) GetAddress() *Address {
+	return &Address{
+		Address: cp.Address,
+		City:    cp.City,
+		State:   cp.State,
+		Zip:     cp.Zip,
+		Country: cp.Country,
+	}
+}
@@ -13,4 +13,6 @@ type CurrencyPair struct {
 	SrcCurrencyID int64     `meddler:"src_currency_id"`
 	DstCurrencyID int64     `meddler:"dst_currency_id"`
 	Multiplier    float64   `meddler:"multiplier"`
+	// RateDate is the date the rate has been published for (zero if unknown)
+	RateDate time.Time `meddler:"rate_date,localtimez"`
 }
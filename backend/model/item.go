@@ -9,4 +9,45 @@ type Item struct {
 	Code       string `meddler:"code"`
 	Name       string `meddler:"name"`
 	Address    string `meddler:"address"`
+	ISIN       string `meddler:"isin"`
+	CUSIP      string `meddler:"cusip"`
+	FIGI       string `meddler:"figi"`
+}
+
+// ItemListing holds a ticker of the item on a market
+type ItemListing struct {
+	ID     int64 `meddler:"id,pk"`
+	ItemID int64 `meddler:"item_id"`
+	// Market is the market code (empty if not known)
+	Market   string `meddler:"market"`
+	Ticker   string `meddler:"ticker"`
+	Currency string `meddler:"currency"`
+}
+
+// ItemIdentifiers holds all known identifiers of an item. Empty ones are not known.
+type ItemIdentifiers struct {
+	Ticker string
+	// Market is the market code of the ticker (empty if not known)
+	Market   string
+	Currency string
+	ISIN     string
+	CUSIP    string
+	FIGI     string
+}
+
+// HasTicker returns true if the ticker is known
+// (brokers not exporting tickers use other identifiers instead)
+func (ids *ItemIdentifiers) HasTicker() bool {
+	return len(ids.Ticker) > 0 && ids.Ticker != ids.ISIN &&
+		ids.Ticker != ids.CUSIP && ids.Ticker != ids.FIGI
+}
+
+// Code returns the code for a new item: the ticker or the first known identifier
+func (ids *ItemIdentifiers) Code() string {
+	for _, code := range []string{ids.Ticker, ids.ISIN, ids.CUSIP, ids.FIGI} {
+		if len(code) > 0 {
+			return code
+		}
+	}
+	return ""
 }
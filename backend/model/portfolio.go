@@ -0,0 +1,23 @@
+package model
+
+// Portfolio holds a named group of items owned by a user (e.g. a brokerage account)
+type Portfolio struct {
+	ID      int64  `meddler:"id,pk"`
+	OwnerID int64  `meddler:"owner_id"`
+	Name    string `meddler:"name"`
+}
+
+// PortfolioItem holds an item of the portfolio.
+// The underscored fields are denormalized from the buy (adds) and sell (removes)
+// transactions of the item and are maintained by the store.
+type PortfolioItem struct {
+	ID          int64 `meddler:"id,pk"`
+	PortfolioID int64 `meddler:"portfolio_id"`
+	ItemID      int64 `meddler:"item_id"`
+	// number of items currently held
+	AmountSum float64 `meddler:"_amount_sum,zeroisnull"`
+	// average price of all the purchases (in transaction currency)
+	BuyPriceAvg float64 `meddler:"_buy_price_avg,zeroisnull"`
+	// sum of the purchase and sale fees paid in the transaction currency (in transaction currency)
+	FeeSum float64 `meddler:"_fee_sum,zeroisnull"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// Transaction holds an imported transaction belonging to a portfolio
+type Transaction struct {
+	ID          int64     `meddler:"id,pk"`
+	PortfolioID int64     `meddler:"portfolio_id"`
+	Hash        string    `meddler:"hash"`
+	Time        time.Time `meddler:"time,localtime"`
+	Type        string    `meddler:"type"`
+	Item        string    `meddler:"item"`
+	Market      string    `meddler:"market"`
+	Quantity    float64   `meddler:"quantity"`
+	Price       float64   `meddler:"price"`
+	NetTotal    float64   `meddler:"net_total"`
+	Currency    string    `meddler:"currency"`
+	Fee         float64   `meddler:"fee"`
+	FeeCurrency string    `meddler:"fee_currency"`
+	Reference   string    `meddler:"reference"`
+	ISIN        string    `meddler:"isin"`
+}
+
+// Identifiers returns identifiers of the traded item
+func (t *Transaction) Identifiers() ItemIdentifiers {
+	return ItemIdentifiers{
+		Ticker:   t.Item,
+		Market:   t.Market,
+		Currency: t.Currency,
+		ISIN:     t.ISIN,
+	}
+}
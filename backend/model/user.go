@@ -0,0 +1,69 @@
+package model
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"time"
+)
+
+// PBKDF2-SHA256 parameters used for new passwords
+const (
+	PasswordIterations = 600000
+	passwordSaltSize   = 16
+	passwordHashSize   = 32
+)
+
+// User holds a user account. Password is stored as a PBKDF2-SHA256 hash.
+type User struct {
+	ID           int64     `meddler:"id,pk"`
+	Name         string    `meddler:"name"`
+	EMail        string    `meddler:"email"`
+	Hash         []byte    `meddler:"hash"`
+	Salt         []byte    `meddler:"salt"`
+	Iterations   int       `meddler:"iterations"`
+	Created      time.Time `meddler:"created,localtime"`
+	LastLoggedIn time.Time `meddler:"last_logged_in,localtimez"`
+}
+
+// SetPassword hashes the password with a new random salt
+func (u *User) SetPassword(password string) error {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	hash, err := pbkdf2.Key(sha256.New, password, salt, PasswordIterations, passwordHashSize)
+	if err != nil {
+		return err
+	}
+
+	u.Hash = hash
+	u.Salt = salt
+	u.Iterations = PasswordIterations
+	return nil
+}
+
+// CheckPassword returns true if the password matches the stored hash
+func (u *User) CheckPassword(password string) bool {
+	if len(u.Hash) == 0 || u.Iterations <= 0 {
+		return false
+	}
+
+	hash, err := pbkdf2.Key(sha256.New, password, u.Salt, u.Iterations, len(u.Hash))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hash, u.Hash) == 1
+}
+
+// Session holds an authenticated session of a user.
+// Only a SHA-256 hash of the session token is stored.
+type Session struct {
+	ID        int64     `meddler:"id,pk"`
+	UserID    int64     `meddler:"user_id"`
+	TokenHash string    `meddler:"token_hash"`
+	Created   time.Time `meddler:"created,localtime"`
+	Expires   time.Time `meddler:"expires,localtime"`
+}
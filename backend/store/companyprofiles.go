@@ -0,0 +1,42 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/k3a/in2tracker/backend/companydata"
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/russross/meddler"
+)
+
+const companyProfilesTable = "company_profiles"
+
+var _ companydata.ProfileStore = (*Store)(nil)
+
+// GetCompanyProfile returns the stored profile of the company by its code (ticker)
+func (s *Store) GetCompanyProfile(code string) (*model.CompanyProfile, error) {
+	profile := new(model.CompanyProfile)
+	err := meddler.QueryRow(s.db, profile, `SELECT * FROM `+companyProfilesTable+
+		` WHERE code = ?`, code)
+	return profile, err
+}
+
+// GetCompanyProfiles returns all stored company profiles ordered by code
+func (s *Store) GetCompanyProfiles() ([]*model.CompanyProfile, error) {
+	var profiles []*model.CompanyProfile
+	err := meddler.QueryAll(s.db, &profiles, `SELECT * FROM `+companyProfilesTable+
+		` ORDER BY code`)
+	return profiles, err
+}
+
+// StoreCompanyProfile creates or replaces the profile of the company with the same code
+func (s *Store) StoreCompanyProfile(profile *model.CompanyProfile) error {
+	stored, err := s.GetCompanyProfile(profile.Code)
+	if err == nil {
+		profile.ID = stored.ID
+	} else if err == sql.ErrNoRows {
+		profile.ID = 0
+	} else {
+		return err
+	}
+	return meddler.Save(s.db, companyProfilesTable, profile)
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompanyProfiles(t *testing.T) {
+	s := NewTest()
+
+	_, err := s.GetCompanyProfile("AAPL")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	fetched := time.Date(2020, 3, 5, 12, 0, 0, 0, time.Local)
+	profile := &model.CompanyProfile{
+		Code:     "AAPL",
+		Name:     "Apple Inc.",
+		Sector:   "Technology",
+		Industry: "Consumer Electronics",
+		City:     "Cupertino",
+		Country:  "United States",
+		Website:  "https://www.apple.com",
+		Officers: []model.CompanyOfficer{{Name: "Mr. Timothy D. Cook", Title: "CEO", Age: 58}},
+		Sources:  map[string]string{"Country": "Yahoo"},
+		Fetched:  fetched,
+	}
+	require.Nil(t, s.StoreCompanyProfile(profile))
+
+	stored, err := s.GetCompanyProfile("AAPL")
+	require.Nil(t, err)
+	require.Equal(t, "Technology", stored.Sector)
+	require.Equal(t, profile.Officers, stored.Officers)
+	require.Equal(t, "Yahoo", stored.Sources["Country"])
+	require.True(t, fetched.Equal(stored.Fetched))
+
+	// storing again replaces the profile
+	refreshed := *profile
+	refreshed.ID = 0
+	refreshed.Sector = "Information Technology"
+	require.Nil(t, s.StoreCompanyProfile(&refreshed))
+	require.Equal(t, profile.ID, refreshed.ID)
+
+	require.Nil(t, s.StoreCompanyProfile(&model.CompanyProfile{Code: "ABBV", Fetched: fetched}))
+
+	profiles, err := s.GetCompanyProfiles()
+	require.Nil(t, err)
+	require.Len(t, profiles, 2)
+	require.Equal(t, "Information Technology", profiles[0].Sector)
+	require.Equal(t, "ABBV", profiles[1].Code)
+}
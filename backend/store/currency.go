@@ -11,6 +11,9 @@ import (
 const currenciesTable = "currencies"
 const currencyPairsTable = "currency_pairs"
 
+// Store is usable as a persistent rate cache
+var _ currency.DatedRateCache = (*Store)(nil)
+
 // GetCurrency returns currency detail for specified currency code
 func (s *Store) GetCurrency(code currency.Currency) (*model.Currency, error) {
 	var c model.Currency
@@ -60,6 +63,55 @@ func (s *Store) GetCurrencyMultiplier(date time.Time, from currency.Currency, to
 	return cp.Multiplier, nil
 }
 
+// GetCurrencyRate finds multiplier for converting "from" currency to "to" currency
+// and the date the rate has been published for (zero if unknown).
+// It does not check reverse record.
+func (s *Store) GetCurrencyRate(date time.Time, from currency.Currency, to currency.Currency) (float64, time.Time, error) {
+	src, err := s.GetCurrency(from)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	dst, err := s.GetCurrency(to)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var cp model.CurrencyPair
+	err = meddler.QueryRow(s.db, &cp, `SELECT * FROM `+currencyPairsTable+`
+		WHERE src_currency_id = $1 AND dst_currency_id = $2 AND date = $3`,
+		src.ID, dst.ID, date.UTC())
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return cp.Multiplier, cp.RateDate, nil
+}
+
+// StoreCurrencyRate stores multiplier for the specified date together with the date
+// the rate has been published for, replacing the already stored multiplier
+func (s *Store) StoreCurrencyRate(date time.Time, from currency.Currency, to currency.Currency, mult float64, rateDate time.Time) error {
+	src, err := s.GetOrCreateCurrency(from)
+	if err != nil {
+		return err
+	}
+
+	dst, err := s.GetOrCreateCurrency(to)
+	if err != nil {
+		return err
+	}
+
+	var rateDateValue interface{}
+	if !rateDate.IsZero() {
+		rateDateValue = rateDate.UTC()
+	}
+
+	_, err = s.db.Exec(`REPLACE INTO `+currencyPairsTable+
+		` (date, src_currency_id, dst_currency_id, multiplier, rate_date) VALUES (?, ?, ?, ?, ?)`,
+		date.UTC(), src.ID, dst.ID, mult, rateDateValue)
+	return err
+}
+
 // StoreCurrencyMultiplier stores multiplier for the specified date
 func (s *Store) StoreCurrencyMultiplier(date time.Time, from currency.Currency, to currency.Currency, mult float64) error {
 	src, err := s.GetOrCreateCurrency(from)
@@ -79,3 +131,42 @@ func (s *Store) StoreCurrencyMultiplier(date time.Time, from currency.Currency,
 		Multiplier:    mult,
 	})
 }
+
+// StoreCurrencyMultipliers stores multipliers in a single transaction, replacing
+// already stored ones for the same date and pair. Used for bulk loading rate history.
+func (s *Store) StoreCurrencyMultipliers(rates []currency.HistoricalRate) error {
+	ids := make(map[currency.Currency]int64)
+	for _, r := range rates {
+		for _, code := range []currency.Currency{r.From, r.To} {
+			if _, has := ids[code]; has {
+				continue
+			}
+			cur, err := s.GetOrCreateCurrency(code)
+			if err != nil {
+				return err
+			}
+			ids[code] = cur.ID
+		}
+	}
+
+	return s.inTx(func(ts *Store) error {
+		stmt, err := ts.db.Prepare(`REPLACE INTO ` + currencyPairsTable +
+			` (date, src_currency_id, dst_currency_id, multiplier, rate_date) VALUES (?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, r := range rates {
+			// time is always stored in UTC in the DB
+			rateDate := r.RateDate
+			if rateDate.IsZero() {
+				rateDate = r.Date // published for the date
+			}
+			if _, err = stmt.Exec(r.Date.UTC(), ids[r.From], ids[r.To], r.Rate, rateDate.UTC()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -38,3 +38,47 @@ func TestCurrency(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, 3256.812, readMult)
 }
+
+func TestCurrencyMultipliersBulk(t *testing.T) {
+	s := NewTest()
+
+	day := time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC)
+	rates := []currency.HistoricalRate{
+		{Date: day, From: currency.EUR, To: currency.USD, Rate: 1.1229},
+		{Date: day, From: currency.EUR, To: currency.CZK, Rate: 25.405},
+		{Date: day.AddDate(0, 0, 1), From: currency.EUR, To: currency.CZK, Rate: 25.567},
+	}
+	require.Nil(t, s.StoreCurrencyMultipliers(rates))
+
+	mult, err := s.GetCurrencyMultiplier(day, currency.EUR, currency.CZK)
+	require.Nil(t, err)
+	require.Equal(t, 25.405, mult)
+
+	// loading again replaces known rates
+	rates[1].Rate = 25.4
+	require.Nil(t, s.StoreCurrencyMultipliers(rates))
+
+	mult, err = s.GetCurrencyMultiplier(day, currency.EUR, currency.CZK)
+	require.Nil(t, err)
+	require.Equal(t, 25.4, mult)
+}
+
+func TestCurrencyRateDate(t *testing.T) {
+	s := NewTest()
+
+	saturday := time.Date(2020, 3, 7, 0, 0, 0, 0, time.UTC)
+	friday := saturday.AddDate(0, 0, -1)
+
+	require.Nil(t, s.StoreCurrencyMultiplier(saturday, currency.USD, currency.CZK, 23))
+	mult, rateDate, err := s.GetCurrencyRate(saturday, currency.USD, currency.CZK)
+	require.Nil(t, err)
+	require.Equal(t, 23.0, mult)
+	require.True(t, rateDate.IsZero())
+
+	// replaced with the known rate date
+	require.Nil(t, s.StoreCurrencyRate(saturday, currency.USD, currency.CZK, 22.5, friday))
+	mult, rateDate, err = s.GetCurrencyRate(saturday, currency.USD, currency.CZK)
+	require.Nil(t, err)
+	require.Equal(t, 22.5, mult)
+	require.True(t, friday.Equal(rateDate))
+}
@@ -0,0 +1,32 @@
+-- +migrate Up
+
+-- -----------------------------------------------------
+-- Table `transactions`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `transactions` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `portfolio_id` INT NOT NULL,
+  `hash` CHAR(40) NOT NULL,
+  `time` DATETIME NOT NULL,
+  `type` VARCHAR(32) NOT NULL,
+  `item` VARCHAR(32) NOT NULL,
+  `market` VARCHAR(32) NOT NULL,
+  `quantity` DOUBLE NOT NULL,
+  `price` DOUBLE NOT NULL,
+  `net_total` DOUBLE NOT NULL,
+  `currency` VARCHAR(6) NOT NULL,
+  `fee` DOUBLE NOT NULL,
+  `fee_currency` VARCHAR(6) NOT NULL,
+  `reference` VARCHAR(256) NULL,
+  UNIQUE (`portfolio_id`, `hash`),
+  CONSTRAINT `fk_transactions_1`
+    FOREIGN KEY (`portfolio_id`)
+    REFERENCES `portfolios` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+CREATE INDEX IF NOT EXISTS `transactions_time_idx` ON `transactions` (`portfolio_id`, `time`);
+CREATE INDEX IF NOT EXISTS `transactions_item_idx` ON `transactions` (`portfolio_id`, `item`);
+
+-- +migrate Down
+DROP TABLE IF EXISTS `transactions` ;
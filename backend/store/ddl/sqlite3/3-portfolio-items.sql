@@ -0,0 +1,89 @@
+-- +migrate Up
+
+-- portfolio item adds, removes and splits link buy, sell and split transactions
+-- to the portfolio item they change
+
+DROP TABLE IF EXISTS `portfolio_item_adds` ;
+DROP TABLE IF EXISTS `portfolio_item_removes` ;
+
+-- -----------------------------------------------------
+-- Table `portfolio_item_adds`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `portfolio_item_adds` (
+  `portfolio_item_id` INT NOT NULL,
+  `transaction_id` INT NOT NULL,
+  PRIMARY KEY (`portfolio_item_id`, `transaction_id`),
+  CONSTRAINT `fk_portfolio_item_adds_1`
+    FOREIGN KEY (`portfolio_item_id`)
+    REFERENCES `portfolio_items` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_portfolio_item_adds_2`
+    FOREIGN KEY (`transaction_id`)
+    REFERENCES `transactions` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+
+-- -----------------------------------------------------
+-- Table `portfolio_item_removes`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `portfolio_item_removes` (
+  `portfolio_item_id` INT NOT NULL,
+  `transaction_id` INT NOT NULL,
+  PRIMARY KEY (`portfolio_item_id`, `transaction_id`),
+  CONSTRAINT `fk_portfolio_item_removes_1`
+    FOREIGN KEY (`portfolio_item_id`)
+    REFERENCES `portfolio_items` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_portfolio_item_removes_2`
+    FOREIGN KEY (`transaction_id`)
+    REFERENCES `transactions` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+
+-- -----------------------------------------------------
+-- Table `portfolio_item_splits`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `portfolio_item_splits` (
+  `portfolio_item_id` INT NOT NULL,
+  `transaction_id` INT NOT NULL,
+  PRIMARY KEY (`portfolio_item_id`, `transaction_id`),
+  CONSTRAINT `fk_portfolio_item_splits_1`
+    FOREIGN KEY (`portfolio_item_id`)
+    REFERENCES `portfolio_items` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_portfolio_item_splits_2`
+    FOREIGN KEY (`transaction_id`)
+    REFERENCES `transactions` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+CREATE UNIQUE INDEX IF NOT EXISTS `portfolio_items_item_idx` ON `portfolio_items` (`portfolio_id`, `item_id`);
+
+-- +migrate Down
+DROP INDEX IF EXISTS `portfolio_items_item_idx` ;
+DROP TABLE IF EXISTS `portfolio_item_splits` ;
+DROP TABLE IF EXISTS `portfolio_item_adds` ;
+DROP TABLE IF EXISTS `portfolio_item_removes` ;
+
+CREATE TABLE IF NOT EXISTS `portfolio_item_adds` (
+  `portfolio_item_id` INT NOT NULL,
+  PRIMARY KEY (`portfolio_item_id`),
+  CONSTRAINT `fk_portfolio_item_adds_1`
+    FOREIGN KEY (`portfolio_item_id`)
+    REFERENCES `portfolio_items` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+CREATE TABLE IF NOT EXISTS `portfolio_item_removes` (
+  `portfolio_item_id` INT NOT NULL,
+  PRIMARY KEY (`portfolio_item_id`),
+  CONSTRAINT `fk_portfolio_item_removes_1`
+    FOREIGN KEY (`portfolio_item_id`)
+    REFERENCES `portfolio_items` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
@@ -0,0 +1,47 @@
+-- +migrate Up
+
+-- users are recreated to hold PBKDF2 password hashes
+-- (the original table has never been used)
+
+DROP TABLE IF EXISTS `users` ;
+
+-- -----------------------------------------------------
+-- Table `users`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `users` (
+  `id`  INTEGER PRIMARY KEY AUTOINCREMENT,
+  `name` VARCHAR(60) NOT NULL,
+  `email` VARCHAR(128) NOT NULL UNIQUE,
+  `hash` BINARY(32) NOT NULL,
+  `salt` BINARY(16) NOT NULL,
+  `iterations` INT NOT NULL,
+  `created` DATETIME NOT NULL,
+  `last_logged_in` DATETIME NULL);
+
+-- -----------------------------------------------------
+-- Table `sessions`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `sessions` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `user_id` INT NOT NULL,
+  `token_hash` CHAR(64) NOT NULL UNIQUE,
+  `created` DATETIME NOT NULL,
+  `expires` DATETIME NOT NULL,
+  CONSTRAINT `fk_sessions_1`
+    FOREIGN KEY (`user_id`)
+    REFERENCES `users` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+CREATE INDEX IF NOT EXISTS `sessions_user_idx` ON `sessions` (`user_id`);
+
+-- +migrate Down
+DROP TABLE IF EXISTS `sessions` ;
+DROP TABLE IF EXISTS `users` ;
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `id`  INTEGER PRIMARY KEY AUTOINCREMENT,
+  `name` VARCHAR(60) NOT NULL,
+  `email` VARCHAR(60) NOT NULL UNIQUE,
+  `hash` BINARY(20) NOT NULL,
+  `salt` CHAR(8) NOT NULL);
@@ -0,0 +1,24 @@
+-- +migrate Up
+
+-- effective date of the rate (the day the rate has been published for),
+-- differs from `date` for weekends and holidays
+ALTER TABLE `currency_pairs` ADD COLUMN `rate_date` DATETIME NULL;
+
+-- +migrate Down
+CREATE TABLE IF NOT EXISTS `currency_pairs_old` (
+  `date` DATETIME NOT NULL,
+  `src_currency_id` INT NOT NULL,
+  `dst_currency_id` INT NOT NULL,
+  `multiplier` DOUBLE NOT NULL,
+  PRIMARY KEY (`date`, `src_currency_id`, `dst_currency_id`),
+  CONSTRAINT `fk_currency_pairs_1`
+    FOREIGN KEY (`src_currency_id` , `dst_currency_id`)
+    REFERENCES `currencies` (`id` , `id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+INSERT INTO `currency_pairs_old` (`date`, `src_currency_id`, `dst_currency_id`, `multiplier`)
+  SELECT `date`, `src_currency_id`, `dst_currency_id`, `multiplier` FROM `currency_pairs`;
+
+DROP TABLE `currency_pairs` ;
+ALTER TABLE `currency_pairs_old` RENAME TO `currency_pairs`;
@@ -0,0 +1,25 @@
+-- +migrate Up
+
+-- -----------------------------------------------------
+-- Table `company_profiles`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `company_profiles` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `code` VARCHAR(45) NOT NULL UNIQUE,
+  `name` VARCHAR(255) NOT NULL,
+  `sector` VARCHAR(100) NOT NULL,
+  `industry` VARCHAR(100) NOT NULL,
+  `business_summary` TEXT NOT NULL,
+  `address` VARCHAR(255) NOT NULL,
+  `city` VARCHAR(100) NOT NULL,
+  `state` VARCHAR(100) NOT NULL,
+  `zip` VARCHAR(20) NOT NULL,
+  `country` VARCHAR(45) NOT NULL,
+  `website` VARCHAR(255) NOT NULL,
+  `employees` INT NOT NULL,
+  `officers` TEXT NOT NULL,
+  `sources` TEXT NOT NULL,
+  `fetched` DATETIME NOT NULL);
+
+-- +migrate Down
+DROP TABLE IF EXISTS `company_profiles` ;
@@ -0,0 +1,110 @@
+-- +migrate Up
+
+-- securities identifiers of items independent of the market
+ALTER TABLE `items` ADD COLUMN `isin` CHAR(12) NOT NULL DEFAULT '';
+ALTER TABLE `items` ADD COLUMN `cusip` CHAR(9) NOT NULL DEFAULT '';
+ALTER TABLE `items` ADD COLUMN `figi` CHAR(12) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS `items_isin_idx` ON `items` (`isin`);
+CREATE INDEX IF NOT EXISTS `items_cusip_idx` ON `items` (`cusip`);
+CREATE INDEX IF NOT EXISTS `items_figi_idx` ON `items` (`figi`);
+
+-- ISIN of the traded item if provided by the broker
+ALTER TABLE `transactions` ADD COLUMN `isin` CHAR(12) NOT NULL DEFAULT '';
+
+-- -----------------------------------------------------
+-- Table `item_listings`
+-- -----------------------------------------------------
+CREATE TABLE IF NOT EXISTS `item_listings` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `item_id` INT NOT NULL,
+  `market` VARCHAR(32) NOT NULL,
+  `ticker` VARCHAR(32) NOT NULL,
+  `currency` VARCHAR(6) NOT NULL,
+  UNIQUE (`market`, `ticker`),
+  CONSTRAINT `fk_item_listings_1`
+    FOREIGN KEY (`item_id`)
+    REFERENCES `items` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+CREATE INDEX IF NOT EXISTS `item_listings_item_idx` ON `item_listings` (`item_id`);
+CREATE INDEX IF NOT EXISTS `item_listings_ticker_idx` ON `item_listings` (`ticker`);
+
+-- items imported from brokers not exporting tickers have ISIN as the code
+UPDATE `items` SET `isin` = `code` WHERE `code` GLOB
+  '[A-Z][A-Z][A-Z0-9][A-Z0-9][A-Z0-9][A-Z0-9][A-Z0-9][A-Z0-9][A-Z0-9][A-Z0-9][A-Z0-9][0-9]';
+
+-- codes of other existing items are tickers on an unknown market
+INSERT OR IGNORE INTO `item_listings` (`item_id`, `market`, `ticker`, `currency`)
+  SELECT `id`, '', `code`, '' FROM `items` WHERE `isin` = '';
+
+-- +migrate Down
+DROP TABLE IF EXISTS `item_listings` ;
+
+DROP INDEX IF EXISTS `items_isin_idx` ;
+DROP INDEX IF EXISTS `items_cusip_idx` ;
+DROP INDEX IF EXISTS `items_figi_idx` ;
+
+CREATE TABLE IF NOT EXISTS `items_old` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `market_id` INT NOT NULL,
+  `currency_id` INT NULL,
+  `country_id` INT NULL,
+  `code` VARCHAR(32) NOT NULL,
+  `name` VARCHAR(256) NULL,
+  `address` VARCHAR(256) NULL,
+  CONSTRAINT `fk_items_1`
+    FOREIGN KEY (`market_id`)
+    REFERENCES `markets` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_items_2`
+    FOREIGN KEY (`currency_id`)
+    REFERENCES `currencies` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION,
+  CONSTRAINT `fk_items_3`
+    FOREIGN KEY (`country_id`)
+    REFERENCES `countries` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+INSERT INTO `items_old` (`id`, `market_id`, `currency_id`, `country_id`, `code`, `name`, `address`)
+  SELECT `id`, `market_id`, `currency_id`, `country_id`, `code`, `name`, `address` FROM `items`;
+
+DROP TABLE `items` ;
+ALTER TABLE `items_old` RENAME TO `items`;
+
+CREATE TABLE IF NOT EXISTS `transactions_old` (
+  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `portfolio_id` INT NOT NULL,
+  `hash` CHAR(40) NOT NULL,
+  `time` DATETIME NOT NULL,
+  `type` VARCHAR(32) NOT NULL,
+  `item` VARCHAR(32) NOT NULL,
+  `market` VARCHAR(32) NOT NULL,
+  `quantity` DOUBLE NOT NULL,
+  `price` DOUBLE NOT NULL,
+  `net_total` DOUBLE NOT NULL,
+  `currency` VARCHAR(6) NOT NULL,
+  `fee` DOUBLE NOT NULL,
+  `fee_currency` VARCHAR(6) NOT NULL,
+  `reference` VARCHAR(256) NULL,
+  UNIQUE (`portfolio_id`, `hash`),
+  CONSTRAINT `fk_transactions_1`
+    FOREIGN KEY (`portfolio_id`)
+    REFERENCES `portfolios` (`id`)
+    ON DELETE NO ACTION
+    ON UPDATE NO ACTION);
+
+INSERT INTO `transactions_old` (`id`, `portfolio_id`, `hash`, `time`, `type`, `item`, `market`,
+  `quantity`, `price`, `net_total`, `currency`, `fee`, `fee_currency`, `reference`)
+  SELECT `id`, `portfolio_id`, `hash`, `time`, `type`, `item`, `market`,
+  `quantity`, `price`, `net_total`, `currency`, `fee`, `fee_currency`, `reference` FROM `transactions`;
+
+DROP TABLE `transactions` ;
+ALTER TABLE `transactions_old` RENAME TO `transactions`;
+
+CREATE INDEX IF NOT EXISTS `transactions_time_idx` ON `transactions` (`portfolio_id`, `time`);
+CREATE INDEX IF NOT EXISTS `transactions_item_idx` ON `transactions` (`portfolio_id`, `item`);
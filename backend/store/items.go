@@ -1,11 +1,18 @@
 package store
 
 import (
+	"database/sql"
+
 	"github.com/russross/meddler"
 	"github.com/k3a/in2tracker/backend/model"
 )
 
 const itemsTable = "items"
+const itemListingsTable = "item_listings"
+const itemPricesTable = "item_prices"
+
+// ErrListingConflict is returned when the ticker is already listed on the market by another item
+var ErrListingConflict = e("ticker is already listed on the market by another item")
 
 // GetItem returns item (company) by ID
 func (s *Store) GetItem(id int64) (*model.Item, error) {
@@ -21,6 +28,331 @@ func (s *Store) GetItemByCode(code string) (*model.Item, error) {
 	return item, err
 }
 
+// GetItemByIdentifier returns item by its code, ISIN, CUSIP, FIGI or a listed ticker
+func (s *Store) GetItemByIdentifier(ident string) (*model.Item, error) {
+	item := new(model.Item)
+	if len(ident) == 0 {
+		return item, sql.ErrNoRows
+	}
+	err := meddler.QueryRow(s.db, item, `SELECT * FROM `+itemsTable+
+		` WHERE code = ? OR isin = ? OR cusip = ? OR figi = ? OR id IN
+		(SELECT item_id FROM `+itemListingsTable+` WHERE ticker = ?)
+		ORDER BY code != ?, id LIMIT 1`, ident, ident, ident, ident, ident, ident)
+	return item, err
+}
+
+// GetItemByListing returns item listed under the ticker on the market.
+// Listings on an unknown (empty) market match any market and the empty market
+// matches listings on any market, preferring the exact market match.
+func (s *Store) GetItemByListing(market, ticker string) (*model.Item, error) {
+	item := new(model.Item)
+	err := meddler.QueryRow(s.db, item, `SELECT i.* FROM `+itemsTable+` i
+		JOIN `+itemListingsTable+` l ON l.item_id = i.id
+		WHERE l.ticker = ? AND (? = '' OR l.market IN (?, ''))
+		ORDER BY l.market = ? DESC, l.id LIMIT 1`, ticker, market, market, market)
+	return item, err
+}
+
+// GetItemListings returns all the listings of the item
+func (s *Store) GetItemListings(itemID int64) ([]*model.ItemListing, error) {
+	var listings []*model.ItemListing
+	err := meddler.QueryAll(s.db, &listings, `SELECT * FROM `+itemListingsTable+
+		` WHERE item_id = ? ORDER BY id`, itemID)
+	return listings, err
+}
+
+// AddItemListing stores the listing unless the item already has the ticker listed on the market.
+// The listing ID is set to the stored one in both cases. Returns ErrListingConflict
+// if another item is listed under the ticker on the market.
+func (s *Store) AddItemListing(listing *model.ItemListing) error {
+	existing := new(model.ItemListing)
+	err := meddler.QueryRow(s.db, existing, `SELECT * FROM `+itemListingsTable+
+		` WHERE market = ? AND ticker = ?`, listing.Market, listing.Ticker)
+	if err == sql.ErrNoRows {
+		return meddler.Insert(s.db, itemListingsTable, listing)
+	} else if err != nil {
+		return err
+	}
+	if existing.ItemID != listing.ItemID {
+		return ErrListingConflict
+	}
+	listing.ID = existing.ID
+	return nil
+}
+
+// GetOrCreateItemByCode returns item by code or creates a new one having just the code
+func (s *Store) GetOrCreateItemByCode(code string) (*model.Item, error) {
+	item, err := s.GetItemByCode(code)
+	if err == sql.ErrNoRows {
+		item = &model.Item{
+			Code: code,
+			Name: code,
+		}
+		err = s.CreateItem(item)
+	}
+	return item, err
+}
+
+// getItemBy returns the first item having the identifier column equal to the value
+func (s *Store) getItemBy(column, value string) (*model.Item, error) {
+	item := new(model.Item)
+	err := meddler.QueryRow(s.db, item, `SELECT * FROM `+itemsTable+
+		` WHERE `+column+` = ? ORDER BY id LIMIT 1`, value)
+	return item, err
+}
+
+// findItemBySecurityID returns item by ISIN, CUSIP or FIGI (in this order)
+func (s *Store) findItemBySecurityID(ids model.ItemIdentifiers) (*model.Item, error) {
+	for _, id := range []struct{ column, value string }{
+		{"isin", ids.ISIN},
+		{"cusip", ids.CUSIP},
+		{"figi", ids.FIGI},
+	} {
+		if len(id.value) == 0 {
+			continue
+		}
+		item, err := s.getItemBy(id.column, id.value)
+		if err != sql.ErrNoRows {
+			return item, err
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// findItemByTicker returns item by the ticker listing or by the code of an item
+// not listed anywhere (created before its listings were known)
+func (s *Store) findItemByTicker(ids model.ItemIdentifiers) (*model.Item, error) {
+	item, err := s.GetItemByListing(ids.Market, ids.Ticker)
+	if err == sql.ErrNoRows {
+		err = meddler.QueryRow(s.db, item, `SELECT * FROM `+itemsTable+
+			` WHERE code = ? AND id NOT IN (SELECT item_id FROM `+itemListingsTable+`)
+			ORDER BY id LIMIT 1`, ids.Ticker)
+	}
+	return item, err
+}
+
+// FindItem returns item matching any of the identifiers, returns sql.ErrNoRows if not found
+func (s *Store) FindItem(ids model.ItemIdentifiers) (*model.Item, error) {
+	item, err := s.findItemBySecurityID(ids)
+	if err == sql.ErrNoRows && ids.HasTicker() {
+		item, err = s.findItemByTicker(ids)
+	}
+	if err == sql.ErrNoRows && !ids.HasTicker() && len(ids.Ticker) > 0 {
+		// item created from a transaction having just the ISIN as the item code
+		item, err = s.GetItemByCode(ids.Ticker)
+	}
+	return item, err
+}
+
+// ResolveItem returns item matching any of the identifiers, creating it if not found.
+// Identifiers and the ticker listing not known yet are added to the item.
+// An item known just by the ticker is merged into the item found by ISIN, CUSIP or FIGI,
+// so the same security traded under its ticker and its ISIN ends up as one item.
+// Identifiers are not looked up anywhere, so an item known just by the ticker (e.g. from
+// Fio) and one known just by the ISIN (e.g. from Degiro) are merged only once resolved
+// with both identifiers (a transaction having both or ResolveItem called explicitly).
+// The item is resolved in a single transaction.
+func (s *Store) ResolveItem(ids model.ItemIdentifiers) (*model.Item, error) {
+	var item *model.Item
+	err := s.inTx(func(ts *Store) error {
+		var err error
+		item, err = ts.resolveItem(ids)
+		return err
+	})
+	return item, err
+}
+
+// resolveItem resolves the item like ResolveItem (must be called in a transaction)
+func (s *Store) resolveItem(ids model.ItemIdentifiers) (*model.Item, error) {
+	code := ids.Code()
+	if len(code) == 0 {
+		return nil, e("no identifier of the item")
+	}
+
+	item, err := s.findItemBySecurityID(ids)
+	if err == sql.ErrNoRows {
+		item = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if ids.HasTicker() {
+		listed, err := s.findItemByTicker(ids)
+		if err == nil {
+			if item == nil {
+				if sameSecurity(listed, &model.Item{ISIN: ids.ISIN, CUSIP: ids.CUSIP, FIGI: ids.FIGI}) {
+					item = listed
+				}
+			} else if listed.ID != item.ID && sameSecurity(listed, item) {
+				if err := s.mergeItems(item, listed); err != nil {
+					return nil, err
+				}
+			}
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+	} else if item == nil {
+		item, err = s.GetItemByCode(code)
+		if err == sql.ErrNoRows {
+			item = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if item == nil {
+		item = &model.Item{
+			Code:  code,
+			Name:  code,
+			ISIN:  ids.ISIN,
+			CUSIP: ids.CUSIP,
+			FIGI:  ids.FIGI,
+		}
+		if err := s.CreateItem(item); err != nil {
+			return nil, err
+		}
+	} else if completeItemIdentifiers(item, ids) {
+		if err := s.UpdateItem(item); err != nil {
+			return nil, err
+		}
+	}
+
+	if ids.HasTicker() {
+		err = s.AddItemListing(&model.ItemListing{
+			ItemID:   item.ID,
+			Market:   ids.Market,
+			Ticker:   ids.Ticker,
+			Currency: ids.Currency,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return item, nil
+}
+
+// sameSecurity returns true if the items don't have conflicting ISIN, CUSIP or FIGI
+func sameSecurity(a, b *model.Item) bool {
+	differ := func(x, y string) bool {
+		return len(x) > 0 && len(y) > 0 && x != y
+	}
+	return !differ(a.ISIN, b.ISIN) && !differ(a.CUSIP, b.CUSIP) && !differ(a.FIGI, b.FIGI)
+}
+
+// hasIdentifierCode returns true if the item code is its ISIN, CUSIP or FIGI
+// (the item has been created from a transaction without a ticker)
+func hasIdentifierCode(item *model.Item) bool {
+	return item.Code == item.ISIN || item.Code == item.CUSIP || item.Code == item.FIGI
+}
+
+// completeItemIdentifiers sets identifiers not known by the item, returns true if changed
+func completeItemIdentifiers(item *model.Item, ids model.ItemIdentifiers) bool {
+	changed := false
+	for _, id := range []struct {
+		field *string
+		value string
+	}{
+		{&item.ISIN, ids.ISIN},
+		{&item.CUSIP, ids.CUSIP},
+		{&item.FIGI, ids.FIGI},
+	} {
+		if len(*id.field) == 0 && len(id.value) > 0 {
+			*id.field = id.value
+			changed = true
+		}
+	}
+	if ids.HasTicker() && hasIdentifierCode(item) {
+		// prefer the ticker as the item code
+		if item.Name == item.Code {
+			item.Name = ids.Ticker
+		}
+		item.Code = ids.Ticker
+		changed = true
+	}
+	return changed
+}
+
+// mergeItems moves portfolio items, listings and prices of the item from to the item into,
+// completes details of into by the ones known by from and deletes from (in a single transaction)
+func (s *Store) mergeItems(into, from *model.Item) error {
+	return s.inTx(func(ts *Store) error {
+		return ts.mergeItemsTx(into, from)
+	})
+}
+
+// mergeItemsTx merges the items like mergeItems (must be called in a transaction)
+func (s *Store) mergeItemsTx(into, from *model.Item) error {
+	var pis []*model.PortfolioItem
+	err := meddler.QueryAll(s.db, &pis, `SELECT * FROM `+portfolioItemsTable+
+		` WHERE item_id = ? ORDER BY id`, from.ID)
+	if err != nil {
+		return err
+	}
+	for _, pi := range pis {
+		target, err := s.getOrCreatePortfolioItem(pi.PortfolioID, into.ID)
+		if err != nil {
+			return err
+		}
+		for _, linkTable := range []string{portfolioItemAddsTable, portfolioItemRemovesTable,
+			portfolioItemSplitsTable} {
+			_, err = s.db.Exec(`UPDATE `+linkTable+` SET portfolio_item_id = ?
+				WHERE portfolio_item_id = ?`, target.ID, pi.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err = s.db.Exec(`DELETE FROM `+portfolioItemsTable+` WHERE id = ?`, pi.ID); err != nil {
+			return err
+		}
+		if err = s.updatePortfolioItemSums(target); err != nil {
+			return err
+		}
+	}
+
+	for _, query := range []string{
+		`UPDATE ` + itemListingsTable + ` SET item_id = ? WHERE item_id = ?`,
+		// prices already known for the date are kept
+		`UPDATE OR IGNORE ` + itemPricesTable + ` SET item_id = ? WHERE item_id = ?`,
+	} {
+		if _, err = s.db.Exec(query, into.ID, from.ID); err != nil {
+			return err
+		}
+	}
+	if _, err = s.db.Exec(`DELETE FROM `+itemPricesTable+` WHERE item_id = ?`, from.ID); err != nil {
+		return err
+	}
+
+	if hasIdentifierCode(into) && !hasIdentifierCode(from) {
+		into.Code = from.Code
+		if into.Name == into.ISIN || into.Name == into.CUSIP || into.Name == into.FIGI {
+			into.Name = from.Name
+		}
+	}
+	if into.MarketID == 0 {
+		into.MarketID = from.MarketID
+	}
+	if into.CountryID == 0 {
+		into.CountryID = from.CountryID
+	}
+	if into.CurrencyID == 0 {
+		into.CurrencyID = from.CurrencyID
+	}
+	if len(into.Address) == 0 {
+		into.Address = from.Address
+	}
+	completeItemIdentifiers(into, model.ItemIdentifiers{
+		ISIN:  from.ISIN,
+		CUSIP: from.CUSIP,
+		FIGI:  from.FIGI,
+	})
+
+	if _, err = s.db.Exec(`DELETE FROM `+itemsTable+` WHERE id = ?`, from.ID); err != nil {
+		return err
+	}
+	return s.UpdateItem(into)
+}
+
 func (s *Store) CreateItem(item *model.Item) error {
 	return meddler.Insert(s.db, itemsTable, item)
 }
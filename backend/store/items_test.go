@@ -0,0 +1,158 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItemListings(t *testing.T) {
+	db := openTest()
+	defer db.Close()
+
+	s := From(db)
+
+	// the same ticker on different markets is a different security
+	xetra, err := s.ResolveItem(model.ItemIdentifiers{Ticker: "SAP", Market: "XETRA", Currency: "EUR",
+		ISIN: "DE0007164600"})
+	require.Nil(t, err)
+	nyse, err := s.ResolveItem(model.ItemIdentifiers{Ticker: "SAP", Market: "NYSE", Currency: "USD",
+		ISIN: "US8030542042"})
+	require.Nil(t, err)
+	require.NotEqual(t, xetra.ID, nyse.ID)
+
+	item, err := s.GetItemByListing("NYSE", "SAP")
+	require.Nil(t, err)
+	require.Equal(t, nyse.ID, item.ID)
+
+	item, err = s.GetItemByListing("XETRA", "SAP")
+	require.Nil(t, err)
+	require.Equal(t, xetra.ID, item.ID)
+
+	item, err = s.GetItemByListing("", "SAP")
+	require.Nil(t, err)
+	require.Equal(t, xetra.ID, item.ID)
+
+	_, err = s.GetItemByListing("LSE", "SAP")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	// identifiers
+	item, err = s.GetItemByIdentifier("US8030542042")
+	require.Nil(t, err)
+	require.Equal(t, nyse.ID, item.ID)
+
+	item, err = s.FindItem(model.ItemIdentifiers{Ticker: "SAP", Market: "NYSE"})
+	require.Nil(t, err)
+	require.Equal(t, nyse.ID, item.ID)
+
+	_, err = s.FindItem(model.ItemIdentifiers{ISIN: "US0378331005"})
+	require.Equal(t, sql.ErrNoRows, err)
+
+	// resolving again adds the listing just once
+	again, err := s.ResolveItem(model.ItemIdentifiers{Ticker: "SAP", Market: "XETRA", ISIN: "DE0007164600"})
+	require.Nil(t, err)
+	require.Equal(t, xetra.ID, again.ID)
+
+	listings, err := s.GetItemListings(xetra.ID)
+	require.Nil(t, err)
+	require.Len(t, listings, 1)
+	require.Equal(t, "EUR", listings[0].Currency)
+
+	// the ticker listed by another item
+	listing := &model.ItemListing{ItemID: nyse.ID, Market: "XETRA", Ticker: "SAP"}
+	require.Equal(t, ErrListingConflict, s.AddItemListing(listing))
+	_, err = s.ResolveItem(model.ItemIdentifiers{Ticker: "SAP", Market: "XETRA", ISIN: "US8030542042"})
+	require.Equal(t, ErrListingConflict, err)
+}
+
+func TestResolveItemTickerAndISIN(t *testing.T) {
+	db := openTest()
+	defer db.Close()
+
+	s := From(db)
+
+	fio, err := s.GetOrCreatePortfolio(1, "fio")
+	require.Nil(t, err)
+	degiro, err := s.GetOrCreatePortfolio(1, "degiro")
+	require.Nil(t, err)
+
+	// fio exports just the ticker, degiro just the ISIN
+	day := time.Date(2017, 1, 12, 15, 56, 0, 0, time.UTC)
+	_, err = s.SaveTransactions([]*model.Transaction{
+		{PortfolioID: fio.ID, Hash: "a", Time: day, Type: "TTBuy", Item: "AAPL", Quantity: 10, Price: 100,
+			NetTotal: -1000, Currency: "USD", FeeCurrency: "USD"},
+		{PortfolioID: degiro.ID, Hash: "b", Time: day, Type: "TTBuy", Item: "US0378331005",
+			ISIN: "US0378331005", Market: "NASDAQ", Quantity: 5, Price: 110, NetTotal: -550, Currency: "USD",
+			FeeCurrency: "EUR"},
+	})
+	require.Nil(t, err)
+
+	byTicker, err := s.FindItem(model.ItemIdentifiers{Ticker: "AAPL"})
+	require.Nil(t, err)
+	byISIN, err := s.FindItem(model.ItemIdentifiers{Ticker: "US0378331005", ISIN: "US0378331005"})
+	require.Nil(t, err)
+	require.NotEqual(t, byTicker.ID, byISIN.ID)
+	require.Equal(t, "US0378331005", byISIN.Code)
+
+	// a transaction having both links them
+	_, err = s.SaveTransactions([]*model.Transaction{
+		{PortfolioID: fio.ID, Hash: "c", Time: day.AddDate(0, 1, 0), Type: "TTSell", Item: "AAPL",
+			ISIN: "US0378331005", Quantity: 4, Price: 120, NetTotal: 480, Currency: "USD", FeeCurrency: "USD"},
+	})
+	require.Nil(t, err)
+
+	for _, ident := range []string{"AAPL", "US0378331005"} {
+		item, err := s.GetItemByIdentifier(ident)
+		require.Nil(t, err)
+		require.Equal(t, byISIN.ID, item.ID)
+		require.Equal(t, "AAPL", item.Code)
+		require.Equal(t, "US0378331005", item.ISIN)
+	}
+
+	_, err = s.GetItem(byTicker.ID)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	listings, err := s.GetItemListings(byISIN.ID)
+	require.Nil(t, err)
+	require.Len(t, listings, 1)
+	require.Equal(t, "AAPL", listings[0].Ticker)
+
+	// portfolio items of the merged item are moved
+	pis, err := s.GetPortfolioItems(fio.ID)
+	require.Nil(t, err)
+	require.Len(t, pis, 1)
+	require.Equal(t, byISIN.ID, pis[0].ItemID)
+	require.Equal(t, 6.0, pis[0].AmountSum)
+
+	pis, err = s.GetPortfolioItems(degiro.ID)
+	require.Nil(t, err)
+	require.Len(t, pis, 1)
+	require.Equal(t, byISIN.ID, pis[0].ItemID)
+	require.Equal(t, 5.0, pis[0].AmountSum)
+}
+
+func TestResolveItemExplicitLink(t *testing.T) {
+	db := openTest()
+	defer db.Close()
+
+	s := From(db)
+
+	byTicker, err := s.ResolveItem(model.ItemIdentifiers{Ticker: "AAPL"})
+	require.Nil(t, err)
+	byISIN, err := s.ResolveItem(model.ItemIdentifiers{Ticker: "US0378331005", ISIN: "US0378331005"})
+	require.Nil(t, err)
+	require.NotEqual(t, byTicker.ID, byISIN.ID)
+
+	// resolving both identifiers links the items
+	item, err := s.ResolveItem(model.ItemIdentifiers{Ticker: "AAPL", ISIN: "US0378331005"})
+	require.Nil(t, err)
+	require.Equal(t, byISIN.ID, item.ID)
+	require.Equal(t, "AAPL", item.Code)
+
+	found, err := s.FindItem(model.ItemIdentifiers{Ticker: "AAPL"})
+	require.Nil(t, err)
+	require.Equal(t, byISIN.ID, found.ID)
+}
@@ -0,0 +1,270 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/russross/meddler"
+)
+
+const portfoliosTable = "portfolios"
+const portfolioItemsTable = "portfolio_items"
+const portfolioItemAddsTable = "portfolio_item_adds"
+const portfolioItemRemovesTable = "portfolio_item_removes"
+const portfolioItemSplitsTable = "portfolio_item_splits"
+
+// transaction types changing the amount of portfolio items
+const (
+	transactionTypeBuy        = "TTBuy"
+	transactionTypeSell       = "TTSell"
+	transactionTypeSplit      = "TTSplitMultiplier"
+	transactionTypeCashInLieu = "TTCashInLieu"
+)
+
+// GetPortfolio returns portfolio of the owner by ID
+func (s *Store) GetPortfolio(ownerID, id int64) (*model.Portfolio, error) {
+	p := new(model.Portfolio)
+	err := meddler.QueryRow(s.db, p, `SELECT * FROM `+portfoliosTable+
+		` WHERE owner_id = ? AND id = ?`, ownerID, id)
+	return p, err
+}
+
+// GetPortfolioByName returns the named portfolio of the owner
+func (s *Store) GetPortfolioByName(ownerID int64, name string) (*model.Portfolio, error) {
+	p := new(model.Portfolio)
+	err := meddler.QueryRow(s.db, p, `SELECT * FROM `+portfoliosTable+
+		` WHERE owner_id = ? AND name = ?`, ownerID, name)
+	return p, err
+}
+
+// GetOrCreatePortfolio returns the named portfolio of the owner, creating it if it doesn't exist
+func (s *Store) GetOrCreatePortfolio(ownerID int64, name string) (*model.Portfolio, error) {
+	p, err := s.GetPortfolioByName(ownerID, name)
+	if err == sql.ErrNoRows {
+		p = &model.Portfolio{
+			OwnerID: ownerID,
+			Name:    name,
+		}
+		err = s.CreatePortfolio(p)
+	}
+	return p, err
+}
+
+// GetPortfolios returns all portfolios of the owner
+func (s *Store) GetPortfolios(ownerID int64) ([]*model.Portfolio, error) {
+	var ps []*model.Portfolio
+	err := meddler.QueryAll(s.db, &ps, `SELECT * FROM `+portfoliosTable+
+		` WHERE owner_id = ? ORDER BY id`, ownerID)
+	return ps, err
+}
+
+// CreatePortfolio creates a new portfolio
+func (s *Store) CreatePortfolio(p *model.Portfolio) error {
+	return meddler.Insert(s.db, portfoliosTable, p)
+}
+
+// UpdatePortfolio updates name of the portfolio.
+// Returns sql.ErrNoRows if the portfolio doesn't belong to its owner.
+func (s *Store) UpdatePortfolio(p *model.Portfolio) error {
+	res, err := s.db.Exec(`UPDATE `+portfoliosTable+` SET name = ? WHERE id = ? AND owner_id = ?`,
+		p.Name, p.ID, p.OwnerID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeletePortfolio removes the portfolio of the owner including its items and transactions.
+// Returns sql.ErrNoRows if the portfolio doesn't belong to the owner.
+func (s *Store) DeletePortfolio(ownerID, id int64) error {
+	if _, err := s.GetPortfolio(ownerID, id); err != nil {
+		return err
+	}
+
+	queries := []string{
+		`DELETE FROM ` + portfolioItemAddsTable + ` WHERE portfolio_item_id IN
+			(SELECT id FROM ` + portfolioItemsTable + ` WHERE portfolio_id = ?)`,
+		`DELETE FROM ` + portfolioItemRemovesTable + ` WHERE portfolio_item_id IN
+			(SELECT id FROM ` + portfolioItemsTable + ` WHERE portfolio_id = ?)`,
+		`DELETE FROM ` + portfolioItemSplitsTable + ` WHERE portfolio_item_id IN
+			(SELECT id FROM ` + portfolioItemsTable + ` WHERE portfolio_id = ?)`,
+		`DELETE FROM ` + portfolioItemsTable + ` WHERE portfolio_id = ?`,
+		`DELETE FROM ` + transactionsTable + ` WHERE portfolio_id = ?`,
+		`DELETE FROM ` + portfoliosTable + ` WHERE id = ?`,
+	}
+	return s.inTx(func(ts *Store) error {
+		for _, q := range queries {
+			if _, err := ts.db.Exec(q, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetPortfolioItem returns portfolio item by ID
+func (s *Store) GetPortfolioItem(id int64) (*model.PortfolioItem, error) {
+	pi := new(model.PortfolioItem)
+	err := meddler.Load(s.db, portfolioItemsTable, pi, id)
+	return pi, err
+}
+
+// GetPortfolioItems returns all items of the portfolio
+func (s *Store) GetPortfolioItems(portfolioID int64) ([]*model.PortfolioItem, error) {
+	var pis []*model.PortfolioItem
+	err := meddler.QueryAll(s.db, &pis, `SELECT * FROM `+portfolioItemsTable+
+		` WHERE portfolio_id = ? ORDER BY id`, portfolioID)
+	return pis, err
+}
+
+// getOrCreatePortfolioItem returns the portfolio item for the item, creating it if necessary
+func (s *Store) getOrCreatePortfolioItem(portfolioID, itemID int64) (*model.PortfolioItem, error) {
+	pi := new(model.PortfolioItem)
+	err := meddler.QueryRow(s.db, pi, `SELECT * FROM `+portfolioItemsTable+
+		` WHERE portfolio_id = ? AND item_id = ?`, portfolioID, itemID)
+	if err == sql.ErrNoRows {
+		pi = &model.PortfolioItem{
+			PortfolioID: portfolioID,
+			ItemID:      itemID,
+		}
+		err = meddler.Insert(s.db, portfolioItemsTable, pi)
+	}
+	return pi, err
+}
+
+// portfolioLinkTable returns the link table for the transaction type
+// or empty string if the transaction doesn't change the amount of items.
+// Purchases and sales of currencies (conversions) don't change any item.
+func portfolioLinkTable(tr *model.Transaction) string {
+	if len(tr.Item) == 0 || currency.FromString(tr.Item).Known() {
+		return ""
+	}
+	switch tr.Type {
+	case transactionTypeBuy:
+		return portfolioItemAddsTable
+	case transactionTypeSell, transactionTypeCashInLieu:
+		return portfolioItemRemovesTable
+	case transactionTypeSplit:
+		return portfolioItemSplitsTable
+	}
+	return ""
+}
+
+// addPortfolioTransaction links the stored buy, sell or split transaction
+// to the portfolio item and updates its sums
+func (s *Store) addPortfolioTransaction(tr *model.Transaction) error {
+	linkTable := portfolioLinkTable(tr)
+	if len(linkTable) == 0 {
+		return nil
+	}
+
+	item, err := s.ResolveItem(tr.Identifiers())
+	if err != nil {
+		return err
+	}
+
+	pi, err := s.getOrCreatePortfolioItem(tr.PortfolioID, item.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO `+linkTable+` (portfolio_item_id, transaction_id)
+		VALUES (?, ?)`, pi.ID, tr.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.updatePortfolioItemSums(pi)
+}
+
+// removePortfolioTransaction unlinks the transaction from the portfolio item and updates its sums
+func (s *Store) removePortfolioTransaction(tr *model.Transaction) error {
+	linkTable := portfolioLinkTable(tr)
+	if len(linkTable) == 0 {
+		return nil
+	}
+
+	var pis []*model.PortfolioItem
+	err := meddler.QueryAll(s.db, &pis, `SELECT pi.* FROM `+portfolioItemsTable+` pi
+		JOIN `+linkTable+` l ON l.portfolio_item_id = pi.id WHERE l.transaction_id = ?`, tr.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM `+linkTable+` WHERE transaction_id = ?`, tr.ID); err != nil {
+		return err
+	}
+
+	for _, pi := range pis {
+		if err := s.updatePortfolioItemSums(pi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updatePortfolioItemSums recomputes denormalized sums of the portfolio item
+// from its linked transactions, applying splits to the amounts held before them.
+// Only fees paid in the transaction currency are summed, the store can't convert the others.
+func (s *Store) updatePortfolioItemSums(pi *model.PortfolioItem) error {
+	const (
+		linkAdd = iota
+		linkRemove
+		linkSplit
+	)
+
+	rows, err := s.db.Query(`SELECT l.link, t.quantity, t.price,
+		CASE WHEN t.fee_currency = t.currency THEN t.fee ELSE 0 END
+		FROM `+transactionsTable+` t JOIN (
+			SELECT transaction_id, ? AS link FROM `+portfolioItemAddsTable+` WHERE portfolio_item_id = ?
+			UNION ALL
+			SELECT transaction_id, ? FROM `+portfolioItemRemovesTable+` WHERE portfolio_item_id = ?
+			UNION ALL
+			SELECT transaction_id, ? FROM `+portfolioItemSplitsTable+` WHERE portfolio_item_id = ?
+		) l ON l.transaction_id = t.id ORDER BY t.time, t.id`,
+		linkAdd, pi.ID, linkRemove, pi.ID, linkSplit, pi.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// quantity of all the purchases adjusted by the later splits
+	var amount, addQuantity, addVolume, fee float64
+	for rows.Next() {
+		var link int
+		var quantity, price, trFee float64
+		if err := rows.Scan(&link, &quantity, &price, &trFee); err != nil {
+			return err
+		}
+		switch link {
+		case linkAdd:
+			amount += quantity
+			addQuantity += quantity
+			addVolume += quantity * price
+			fee += trFee
+		case linkRemove:
+			amount -= quantity
+			fee += trFee
+		case linkSplit:
+			amount *= quantity
+			addQuantity *= quantity
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	pi.AmountSum = amount
+	pi.BuyPriceAvg = 0
+	if addQuantity > 0 {
+		pi.BuyPriceAvg = addVolume / addQuantity
+	}
+	pi.FeeSum = fee
+
+	return meddler.Update(s.db, portfolioItemsTable, pi)
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortfolios(t *testing.T) {
+	db := openTest()
+	defer db.Close()
+
+	s := From(db)
+
+	// create
+	fio, err := s.GetOrCreatePortfolio(1, "fio")
+	require.Nil(t, err)
+	require.NotZero(t, fio.ID)
+
+	pension, err := s.GetOrCreatePortfolio(1, "pension")
+	require.Nil(t, err)
+	require.NotEqual(t, fio.ID, pension.ID)
+
+	again, err := s.GetOrCreatePortfolio(1, "fio")
+	require.Nil(t, err)
+	require.Equal(t, fio.ID, again.ID)
+
+	ps, err := s.GetPortfolios(1)
+	require.Nil(t, err)
+	require.Len(t, ps, 2)
+
+	ps, err = s.GetPortfolios(2)
+	require.Nil(t, err)
+	require.Len(t, ps, 0)
+
+	// update
+	pension.Name = "pension fund"
+	require.Nil(t, s.UpdatePortfolio(pension))
+	loaded, err := s.GetPortfolio(1, pension.ID)
+	require.Nil(t, err)
+	require.Equal(t, "pension fund", loaded.Name)
+
+	// transactions maintain item sums
+	day := time.Date(2017, 1, 12, 15, 56, 0, 0, time.UTC)
+	trs := []*model.Transaction{
+		{PortfolioID: fio.ID, Hash: "a", Time: day, Type: "TTBuy", Item: "SWKS", Quantity: 10, Price: 70,
+			NetTotal: -705, Currency: "USD", Fee: 5, FeeCurrency: "USD"},
+		{PortfolioID: fio.ID, Hash: "b", Time: day.AddDate(0, 1, 0), Type: "TTBuy", Item: "SWKS", Quantity: 10,
+			Price: 80, NetTotal: -805, Currency: "USD", Fee: 5, FeeCurrency: "USD"},
+		{PortfolioID: fio.ID, Hash: "c", Time: day.AddDate(0, 2, 0), Type: "TTSell", Item: "SWKS", Quantity: 5,
+			Price: 90, NetTotal: 445, Currency: "USD", Fee: 5, FeeCurrency: "USD"},
+		{PortfolioID: fio.ID, Hash: "d", Time: day.AddDate(0, 2, 0), Type: "TTDividend", Item: "SWKS",
+			NetTotal: 3, Currency: "USD"},
+		{PortfolioID: pension.ID, Hash: "a", Time: day, Type: "TTBuy", Item: "SWKS", Quantity: 1, Price: 70,
+			NetTotal: -70, Currency: "USD", Fee: 2, FeeCurrency: "EUR"},
+	}
+	_, err = s.SaveTransactions(trs)
+	require.Nil(t, err)
+
+	pis, err := s.GetPortfolioItems(fio.ID)
+	require.Nil(t, err)
+	require.Len(t, pis, 1)
+	require.Equal(t, 15.0, pis[0].AmountSum)
+	require.Equal(t, 75.0, pis[0].BuyPriceAvg)
+	require.Equal(t, 15.0, pis[0].FeeSum)
+
+	// fees in other currencies than the transaction one are not summed
+	pis, err = s.GetPortfolioItems(pension.ID)
+	require.Nil(t, err)
+	require.Len(t, pis, 1)
+	require.Equal(t, 1.0, pis[0].AmountSum)
+	require.Zero(t, pis[0].FeeSum)
+
+	pis, err = s.GetPortfolioItems(fio.ID)
+	require.Nil(t, err)
+
+	item, err := s.GetItem(pis[0].ItemID)
+	require.Nil(t, err)
+	require.Equal(t, "SWKS", item.Code)
+
+	// removing the sell returns the items back
+	require.Nil(t, s.DeleteTransaction(trs[2].ID))
+	pi, err := s.GetPortfolioItem(pis[0].ID)
+	require.Nil(t, err)
+	require.Equal(t, 20.0, pi.AmountSum)
+	require.Equal(t, 10.0, pi.FeeSum)
+
+	pis, err = s.GetPortfolioItems(pension.ID)
+	require.Nil(t, err)
+	require.Len(t, pis, 1)
+	require.Equal(t, 1.0, pis[0].AmountSum)
+
+	// delete
+	// other owners can't see, change or remove the portfolio
+	_, err = s.GetPortfolio(2, fio.ID)
+	require.Equal(t, sql.ErrNoRows, err)
+	require.Equal(t, sql.ErrNoRows, s.UpdatePortfolio(&model.Portfolio{ID: fio.ID, OwnerID: 2, Name: "x"}))
+	require.Equal(t, sql.ErrNoRows, s.DeletePortfolio(2, fio.ID))
+
+	require.Nil(t, s.DeletePortfolio(1, fio.ID))
+	_, err = s.GetPortfolio(1, fio.ID)
+	require.Error(t, err)
+	found, err := s.FindTransactions(&TransactionFilter{PortfolioID: fio.ID})
+	require.Nil(t, err)
+	require.Len(t, found, 0)
+	pis, err = s.GetPortfolioItems(fio.ID)
+	require.Nil(t, err)
+	require.Len(t, pis, 0)
+}
+
+func TestPortfolioItemSplits(t *testing.T) {
+	db := openTest()
+	defer db.Close()
+
+	s := From(db)
+
+	p, err := s.GetOrCreatePortfolio(1, "ibkr")
+	require.Nil(t, err)
+
+	day := time.Date(2020, 1, 10, 10, 0, 0, 0, time.UTC)
+	trs := []*model.Transaction{
+		// currency conversion doesn't create an item
+		{PortfolioID: p.ID, Hash: "a", Time: day, Type: "TTBuy", Item: "USD", Quantity: 1000, Price: 23,
+			NetTotal: -23000, Currency: "CZK"},
+		{PortfolioID: p.ID, Hash: "b", Time: day, Type: "TTBuy", Item: "AAPL", Quantity: 10, Price: 100,
+			NetTotal: -1000, Currency: "USD"},
+		{PortfolioID: p.ID, Hash: "c", Time: day.AddDate(0, 6, 0), Type: "TTSplitMultiplier", Item: "AAPL",
+			Quantity: 4, Currency: "USD"},
+		{PortfolioID: p.ID, Hash: "d", Time: day.AddDate(0, 7, 0), Type: "TTSell", Item: "AAPL", Quantity: 8,
+			Price: 30, NetTotal: 240, Currency: "USD"},
+	}
+	_, err = s.SaveTransactions(trs)
+	require.Nil(t, err)
+
+	_, err = s.GetItemByCode("USD")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	pis, err := s.GetPortfolioItems(p.ID)
+	require.Nil(t, err)
+	require.Len(t, pis, 1)
+	require.Equal(t, 32.0, pis[0].AmountSum)
+	require.Equal(t, 25.0, pis[0].BuyPriceAvg)
+
+	// removing the split
+	require.Nil(t, s.DeleteTransaction(trs[2].ID))
+	pi, err := s.GetPortfolioItem(pis[0].ID)
+	require.Nil(t, err)
+	require.Equal(t, 2.0, pi.AmountSum)
+	require.Equal(t, 100.0, pi.BuyPriceAvg)
+}
+
+func TestSaveTransactionsRollback(t *testing.T) {
+	db := openTest()
+	defer db.Close()
+
+	s := From(db)
+
+	p, err := s.GetOrCreatePortfolio(1, "fio")
+	require.Nil(t, err)
+
+	day := time.Date(2020, 1, 10, 10, 0, 0, 0, time.UTC)
+	trs := []*model.Transaction{
+		{PortfolioID: p.ID, Hash: "a", Time: day, Type: "TTBuy", Item: "AAPL", Quantity: 10, Price: 100,
+			NetTotal: -1000, Currency: "USD"},
+		{PortfolioID: p.ID, Hash: "b", Time: day.AddDate(0, 6, 0), Type: "TTSplitMultiplier", Item: "AAPL",
+			Quantity: 4, Currency: "USD"},
+	}
+
+	// linking the split fails after the buy has been stored and linked
+	_, err = db.Exec(`ALTER TABLE ` + portfolioItemSplitsTable + ` RENAME TO splits_moved`)
+	require.Nil(t, err)
+	_, err = s.SaveTransactions(trs)
+	require.Error(t, err)
+
+	found, err := s.FindTransactions(&TransactionFilter{PortfolioID: p.ID})
+	require.Nil(t, err)
+	require.Len(t, found, 0)
+	pis, err := s.GetPortfolioItems(p.ID)
+	require.Nil(t, err)
+	require.Len(t, pis, 0)
+
+	// nothing is skipped as a duplicate when saved again
+	_, err = db.Exec(`ALTER TABLE splits_moved RENAME TO ` + portfolioItemSplitsTable)
+	require.Nil(t, err)
+	added, err := s.SaveTransactions(trs)
+	require.Nil(t, err)
+	require.Equal(t, 2, added)
+
+	pis, err = s.GetPortfolioItems(p.ID)
+	require.Nil(t, err)
+	require.Len(t, pis, 1)
+	require.Equal(t, 40.0, pis[0].AmountSum)
+}
@@ -21,14 +21,41 @@ func e(format string, args ...interface{}) error {
 	return fmt.Errorf("store: "+format, args...)
 }
 
+// dbConn is implemented by both *sql.DB and *sql.Tx
+type dbConn interface {
+	meddler.DB
+	Prepare(query string) (*sql.Stmt, error)
+}
+
 // Store implements the persistent storage
 type Store struct {
-	db *sql.DB
+	// db is the connection or the transaction the store is bound to
+	db dbConn
+	// conn starts transactions (nil if the store is bound to a transaction)
+	conn *sql.DB
 }
 
 // From creates the store from an existing db connection
 func From(db *sql.DB) *Store {
-	return &Store{db}
+	return &Store{db, db}
+}
+
+// inTx runs fn with the store bound to a new transaction which is committed if fn succeeds
+// and rolled back otherwise. If the store is already bound to a transaction, fn runs within it.
+func (s *Store) inTx(fn func(ts *Store) error) error {
+	if s.conn == nil {
+		return fn(s)
+	}
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&Store{db: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 // New creates the store using the specified driver and db connection config
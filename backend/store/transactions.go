@@ -0,0 +1,155 @@
+package store
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/russross/meddler"
+)
+
+const transactionsTable = "transactions"
+
+// TransactionFilter specifies which transactions to find.
+// Zero values mean no filtering by the field.
+type TransactionFilter struct {
+	PortfolioID int64
+	Item        string
+	Types       []string
+	// From is the earliest time (inclusive)
+	From time.Time
+	// To is the latest time (exclusive)
+	To time.Time
+}
+
+// GetTransaction returns transaction by ID
+func (s *Store) GetTransaction(id int64) (*model.Transaction, error) {
+	tr := new(model.Transaction)
+	err := meddler.Load(s.db, transactionsTable, tr, id)
+	return tr, err
+}
+
+// HasTransaction returns true if the transaction with the hash is already stored for the portfolio
+func (s *Store) HasTransaction(portfolioID int64, hash string) (bool, error) {
+	var id int64
+	err := s.db.QueryRow(`SELECT id FROM `+transactionsTable+
+		` WHERE portfolio_id = ? AND hash = ?`, portfolioID, hash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// occurrenceHash returns the hash of the n-th (from zero) occurrence of the same transaction
+// in the saved statement. Brokers report identical fills (e.g. the same quantity and price
+// in the same minute) which are distinct transactions.
+func occurrenceHash(hash string, n int) string {
+	if n == 0 {
+		return hash
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s#%d", hash, n)))
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveTransactions stores transactions of one imported statement which are not stored yet
+// (deduplicated by Hash for each portfolio) and updates affected portfolio items in a single
+// transaction. Repeated hashes within the statement are replaced by occurrence hashes, so
+// identical transactions are all stored and saving the same or an overlapping statement
+// again stores nothing new. Each statement must be saved by a separate call, otherwise
+// a transaction reported in two statements would be counted as two occurrences.
+// Returns number of newly stored transactions.
+func (s *Store) SaveTransactions(trs []*model.Transaction) (int, error) {
+	added := 0
+	err := s.inTx(func(ts *Store) error {
+		occurrences := make(map[string]int)
+		for _, tr := range trs {
+			key := fmt.Sprintf("%d:%s", tr.PortfolioID, tr.Hash)
+			tr.Hash = occurrenceHash(tr.Hash, occurrences[key])
+			occurrences[key]++
+
+			var id int64
+			err := ts.db.QueryRow(`SELECT id FROM `+transactionsTable+
+				` WHERE portfolio_id = ? AND hash = ?`, tr.PortfolioID, tr.Hash).Scan(&id)
+			if err == nil {
+				tr.ID = id // duplicate
+				continue
+			} else if err != sql.ErrNoRows {
+				return err
+			}
+
+			tr.ID = 0
+			if err = meddler.Insert(ts.db, transactionsTable, tr); err != nil {
+				return err
+			}
+			if err = ts.addPortfolioTransaction(tr); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// DeleteTransaction removes the transaction and updates the affected portfolio item
+func (s *Store) DeleteTransaction(id int64) error {
+	return s.inTx(func(ts *Store) error {
+		tr, err := ts.GetTransaction(id)
+		if err != nil {
+			return err
+		}
+
+		if err := ts.removePortfolioTransaction(tr); err != nil {
+			return err
+		}
+
+		_, err = ts.db.Exec(`DELETE FROM `+transactionsTable+` WHERE id = ?`, id)
+		return err
+	})
+}
+
+// FindTransactions returns transactions matching the filter, sorted from the oldest
+func (s *Store) FindTransactions(filter *TransactionFilter) ([]*model.Transaction, error) {
+	var conds []string
+	var args []interface{}
+
+	if filter.PortfolioID != 0 {
+		conds = append(conds, "portfolio_id = ?")
+		args = append(args, filter.PortfolioID)
+	}
+	if len(filter.Item) > 0 {
+		conds = append(conds, "item = ?")
+		args = append(args, filter.Item)
+	}
+	if len(filter.Types) > 0 {
+		conds = append(conds, "type IN (?"+strings.Repeat(", ?", len(filter.Types)-1)+")")
+		for _, t := range filter.Types {
+			args = append(args, t)
+		}
+	}
+	if !filter.From.IsZero() {
+		conds = append(conds, "time >= ?")
+		args = append(args, filter.From.UTC()) // time is always stored in UTC in the DB
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, "time < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	query := `SELECT * FROM ` + transactionsTable
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	query += ` ORDER BY time, id`
+
+	var trs []*model.Transaction
+	err := meddler.QueryAll(s.db, &trs, query, args...)
+	return trs, err
+}
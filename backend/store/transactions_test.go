@@ -0,0 +1,103 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactions(t *testing.T) {
+	db := openTest()
+	defer db.Close()
+
+	s := From(db)
+
+	day := time.Date(2017, 1, 12, 15, 56, 0, 0, time.UTC)
+	trs := []*model.Transaction{
+		{PortfolioID: 1, Hash: "a", Time: day, Type: "TTBuy", Item: "SWKS", Quantity: 7, Price: 75.3,
+			NetTotal: -535.05, Currency: "USD", Fee: 7.95, FeeCurrency: "USD"},
+		{PortfolioID: 1, Hash: "b", Time: day.AddDate(0, 1, 0), Type: "TTSell", Item: "SWKS", Quantity: 7,
+			Price: 80, NetTotal: 552.05, Currency: "USD", Fee: 7.95, FeeCurrency: "USD"},
+		{PortfolioID: 1, Hash: "c", Time: day.AddDate(0, 2, 0), Type: "TTDividend", Item: "TM",
+			NetTotal: 10.63, Currency: "USD"},
+		{PortfolioID: 2, Hash: "a", Time: day, Type: "TTBuy", Item: "SWKS", Quantity: 7, Price: 75.3,
+			NetTotal: -535.05, Currency: "USD", Fee: 7.95, FeeCurrency: "USD"},
+	}
+
+	added, err := s.SaveTransactions(trs)
+	require.Nil(t, err)
+	require.Equal(t, 4, added)
+
+	// the same transactions must not be stored twice
+	added, err = s.SaveTransactions(trs[:2])
+	require.Nil(t, err)
+	require.Equal(t, 0, added)
+
+	has, err := s.HasTransaction(1, "c")
+	require.Nil(t, err)
+	require.True(t, has)
+
+	// by portfolio
+	found, err := s.FindTransactions(&TransactionFilter{PortfolioID: 1})
+	require.Nil(t, err)
+	require.Len(t, found, 3)
+	require.True(t, found[0].Time.Equal(day))
+	require.Equal(t, -535.05, found[0].NetTotal)
+
+	// by item and type
+	found, err = s.FindTransactions(&TransactionFilter{PortfolioID: 1, Item: "SWKS", Types: []string{"TTSell"}})
+	require.Nil(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "b", found[0].Hash)
+
+	// by time range
+	found, err = s.FindTransactions(&TransactionFilter{From: day.AddDate(0, 0, 1), To: day.AddDate(1, 0, 0)})
+	require.Nil(t, err)
+	require.Len(t, found, 2)
+
+	// delete
+	require.Nil(t, s.DeleteTransaction(found[0].ID))
+	has, err = s.HasTransaction(1, "b")
+	require.Nil(t, err)
+	require.False(t, has)
+}
+
+func TestSaveIdenticalTransactions(t *testing.T) {
+	db := openTest()
+	defer db.Close()
+
+	s := From(db)
+
+	// two fills of the same order in the same minute
+	day := time.Date(2017, 1, 12, 15, 56, 0, 0, time.UTC)
+	fills := func() []*model.Transaction {
+		var trs []*model.Transaction
+		for i := 0; i < 2; i++ {
+			trs = append(trs, &model.Transaction{PortfolioID: 1, Hash: "a", Time: day, Type: "TTBuy",
+				Item: "SWKS", Quantity: 7, Price: 75.3, NetTotal: -527.1, Currency: "USD", FeeCurrency: "USD"})
+		}
+		return trs
+	}
+
+	trs := fills()
+	added, err := s.SaveTransactions(trs)
+	require.Nil(t, err)
+	require.Equal(t, 2, added)
+	require.NotEqual(t, trs[0].Hash, trs[1].Hash)
+
+	// importing the same data again stores nothing
+	added, err = s.SaveTransactions(fills())
+	require.Nil(t, err)
+	require.Equal(t, 0, added)
+
+	// neither does an overlapping statement with one of the fills
+	added, err = s.SaveTransactions(fills()[:1])
+	require.Nil(t, err)
+	require.Equal(t, 0, added)
+
+	found, err := s.FindTransactions(&TransactionFilter{PortfolioID: 1})
+	require.Nil(t, err)
+	require.Len(t, found, 2)
+}
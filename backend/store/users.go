@@ -0,0 +1,67 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/russross/meddler"
+)
+
+const usersTable = "users"
+const sessionsTable = "sessions"
+
+// GetUser returns user by ID
+func (s *Store) GetUser(id int64) (*model.User, error) {
+	u := new(model.User)
+	err := meddler.Load(s.db, usersTable, u, id)
+	return u, err
+}
+
+// GetUserByEMail returns user by e-mail address (case-insensitive)
+func (s *Store) GetUserByEMail(email string) (*model.User, error) {
+	u := new(model.User)
+	err := meddler.QueryRow(s.db, u, `SELECT * FROM `+usersTable+` WHERE email = ?`,
+		strings.ToLower(strings.TrimSpace(email)))
+	return u, err
+}
+
+// CreateUser creates a new user. E-mail is stored in lower case.
+func (s *Store) CreateUser(u *model.User) error {
+	u.EMail = strings.ToLower(strings.TrimSpace(u.EMail))
+	if u.Created.IsZero() {
+		u.Created = time.Now()
+	}
+	return meddler.Insert(s.db, usersTable, u)
+}
+
+// UpdateUser updates the user
+func (s *Store) UpdateUser(u *model.User) error {
+	u.EMail = strings.ToLower(strings.TrimSpace(u.EMail))
+	return meddler.Update(s.db, usersTable, u)
+}
+
+// CreateSession stores a new session
+func (s *Store) CreateSession(sess *model.Session) error {
+	return meddler.Insert(s.db, sessionsTable, sess)
+}
+
+// GetSessionByTokenHash returns a session by the token hash if it has not expired yet
+func (s *Store) GetSessionByTokenHash(tokenHash string) (*model.Session, error) {
+	sess := new(model.Session)
+	err := meddler.QueryRow(s.db, sess, `SELECT * FROM `+sessionsTable+
+		` WHERE token_hash = ? AND expires > ?`, tokenHash, time.Now().UTC())
+	return sess, err
+}
+
+// DeleteSession removes the session
+func (s *Store) DeleteSession(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM `+sessionsTable+` WHERE id = ?`, id)
+	return err
+}
+
+// DeleteExpiredSessions removes all sessions expired before the time
+func (s *Store) DeleteExpiredSessions(before time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM `+sessionsTable+` WHERE expires <= ?`, before.UTC())
+	return err
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsers(t *testing.T) {
+	db := openTest()
+	defer db.Close()
+
+	s := From(db)
+
+	u := &model.User{Name: "Jane", EMail: " Jane@Example.com"}
+	require.Nil(t, u.SetPassword("secret"))
+	require.Nil(t, s.CreateUser(u))
+	require.NotZero(t, u.ID)
+
+	// duplicate e-mail
+	require.Error(t, s.CreateUser(&model.User{Name: "Other", EMail: "jane@example.com",
+		Hash: u.Hash, Salt: u.Salt, Iterations: 1}))
+
+	loaded, err := s.GetUserByEMail("JANE@example.com")
+	require.Nil(t, err)
+	require.Equal(t, u.ID, loaded.ID)
+	require.Equal(t, "jane@example.com", loaded.EMail)
+	require.True(t, loaded.CheckPassword("secret"))
+	require.False(t, loaded.CheckPassword("Secret"))
+	require.True(t, loaded.LastLoggedIn.IsZero())
+
+	loaded.LastLoggedIn = time.Now()
+	require.Nil(t, s.UpdateUser(loaded))
+	loaded, err = s.GetUser(u.ID)
+	require.Nil(t, err)
+	require.False(t, loaded.LastLoggedIn.IsZero())
+
+	// sessions
+	now := time.Now()
+	valid := &model.Session{UserID: u.ID, TokenHash: "valid", Created: now, Expires: now.Add(time.Hour)}
+	expired := &model.Session{UserID: u.ID, TokenHash: "expired", Created: now, Expires: now.Add(-time.Hour)}
+	require.Nil(t, s.CreateSession(valid))
+	require.Nil(t, s.CreateSession(expired))
+
+	sess, err := s.GetSessionByTokenHash("valid")
+	require.Nil(t, err)
+	require.Equal(t, u.ID, sess.UserID)
+
+	_, err = s.GetSessionByTokenHash("expired")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	require.Nil(t, s.DeleteExpiredSessions(now))
+	require.Nil(t, s.DeleteSession(valid.ID))
+	_, err = s.GetSessionByTokenHash("valid")
+	require.Equal(t, sql.ErrNoRows, err)
+}
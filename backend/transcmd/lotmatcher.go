@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// LotMatcher selects which buy lots are used by a sell (cost-basis method)
+type LotMatcher interface {
+	// Name returns short identifier of the method
+	Name() string
+	// MatchLots returns the lots with amounts used by the sell of neededAmount items.
+	// Available buys of the item bought before the sell are passed from the oldest
+	// and have RemainingBuys > 0. Returned amounts must not exceed RemainingBuys.
+	MatchLots(sell *processorTransaction, available []*processorTransaction, neededAmount float64) []*transactionWithAmount
+}
+
+// takeInOrder takes items from buys in the specified order until neededAmount is reached
+func takeInOrder(buys []*processorTransaction, neededAmount float64) (trs []*transactionWithAmount) {
+	for _, t := range buys {
+		if neededAmount <= 0 {
+			break // done
+		}
+
+		takenBuys := math.Min(t.RemainingBuys, neededAmount)
+		neededAmount -= takenBuys
+
+		trs = append(trs, &transactionWithAmount{
+			Transaction: t,
+			Amount:      takenBuys,
+		})
+	}
+	return trs
+}
+
+// FIFOLotMatcher uses the oldest buys first
+type FIFOLotMatcher struct{}
+
+// Name returns short identifier of the method
+func (m *FIFOLotMatcher) Name() string {
+	return "fifo"
+}
+
+// MatchLots returns the oldest lots
+func (m *FIFOLotMatcher) MatchLots(sell *processorTransaction, available []*processorTransaction, neededAmount float64) []*transactionWithAmount {
+	return takeInOrder(available, neededAmount)
+}
+
+// LIFOLotMatcher uses the most recent buys first
+type LIFOLotMatcher struct{}
+
+// Name returns short identifier of the method
+func (m *LIFOLotMatcher) Name() string {
+	return "lifo"
+}
+
+// MatchLots returns the most recent lots
+func (m *LIFOLotMatcher) MatchLots(sell *processorTransaction, available []*processorTransaction, neededAmount float64) []*transactionWithAmount {
+	reversed := make([]*processorTransaction, 0, len(available))
+	for it := len(available) - 1; it >= 0; it-- {
+		reversed = append(reversed, available[it])
+	}
+	return takeInOrder(reversed, neededAmount)
+}
+
+// HIFOLotMatcher uses the buys with the highest price per item first
+// (useful for tax-loss harvesting)
+type HIFOLotMatcher struct{}
+
+// Name returns short identifier of the method
+func (m *HIFOLotMatcher) Name() string {
+	return "hifo"
+}
+
+// MatchLots returns the most expensive lots
+func (m *HIFOLotMatcher) MatchLots(sell *processorTransaction, available []*processorTransaction, neededAmount float64) []*transactionWithAmount {
+	sorted := make([]*processorTransaction, len(available))
+	copy(sorted, available)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].adjustedPrice() > sorted[j].adjustedPrice()
+	})
+	return takeInOrder(sorted, neededAmount)
+}
+
+// AverageLotMatcher uses all the available buys proportionally,
+// so the sell cost is the weighted average cost of the held items
+type AverageLotMatcher struct{}
+
+// Name returns short identifier of the method
+func (m *AverageLotMatcher) Name() string {
+	return "average"
+}
+
+// MatchLots returns all the lots, each with the proportional amount
+func (m *AverageLotMatcher) MatchLots(sell *processorTransaction, available []*processorTransaction, neededAmount float64) (trs []*transactionWithAmount) {
+	totalRemaining := 0.0
+	for _, t := range available {
+		totalRemaining += t.RemainingBuys
+	}
+	if totalRemaining <= 0 {
+		return nil
+	}
+
+	ratio := math.Min(1, neededAmount/totalRemaining)
+	for _, t := range available {
+		trs = append(trs, &transactionWithAmount{
+			Transaction: t,
+			Amount:      t.RemainingBuys * ratio,
+		})
+	}
+	return trs
+}
+
+// LotSpecification assigns specific buys to a sell.
+// Transactions are identified by (a prefix of) their hash.
+type LotSpecification struct {
+	Sell string
+	Buys []struct {
+		Buy    string
+		Amount float64
+	}
+}
+
+// SpecificLotMatcher uses lots specified for each sell explicitly.
+// Sells without specification (or the unspecified rest of them) are matched by the fallback matcher.
+type SpecificLotMatcher struct {
+	Specs    []*LotSpecification
+	Fallback LotMatcher
+}
+
+// LoadLotSpecifications loads JSON array of lot specifications
+func LoadLotSpecifications(reader io.Reader) ([]*LotSpecification, error) {
+	var specs []*LotSpecification
+	if err := json.NewDecoder(reader).Decode(&specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// Name returns short identifier of the method
+func (m *SpecificLotMatcher) Name() string {
+	return "specific+" + m.Fallback.Name()
+}
+
+// hashMatches returns true if the hash matches the specified hash prefix
+func hashMatches(hash, prefix string) bool {
+	return len(prefix) > 0 && strings.HasPrefix(hash, strings.ToLower(prefix))
+}
+
+// MatchLots returns the specified lots followed by lots of the fallback matcher
+func (m *SpecificLotMatcher) MatchLots(sell *processorTransaction, available []*processorTransaction, neededAmount float64) []*transactionWithAmount {
+	var trs []*transactionWithAmount
+	used := make(map[*processorTransaction]float64)
+
+	sellHash := sell.Transaction.Hash()
+	for _, spec := range m.Specs {
+		if !hashMatches(sellHash, spec.Sell) {
+			continue
+		}
+
+		for _, specBuy := range spec.Buys {
+			for _, t := range available {
+				if neededAmount <= 0 || !hashMatches(t.Transaction.Hash(), specBuy.Buy) {
+					continue
+				}
+
+				taken := math.Min(math.Min(specBuy.Amount, t.RemainingBuys-used[t]), neededAmount)
+				if taken <= 0 {
+					continue
+				}
+				used[t] += taken
+				neededAmount -= taken
+
+				trs = append(trs, &transactionWithAmount{
+					Transaction: t,
+					Amount:      taken,
+				})
+			}
+		}
+	}
+
+	if neededAmount <= 0 {
+		return trs
+	}
+
+	// the rest by fallback, without the already used items
+	var rest []*processorTransaction
+	restOrig := make(map[*processorTransaction]*processorTransaction)
+	for _, t := range available {
+		remaining := t.RemainingBuys - used[t]
+		if remaining <= 0 {
+			continue
+		}
+		restT := &processorTransaction{Transaction: t.Transaction, RemainingBuys: remaining,
+			SplitMultiplier: t.SplitMultiplier}
+		restOrig[restT] = t
+		rest = append(rest, restT)
+	}
+	for _, twa := range m.Fallback.MatchLots(sell, rest, neededAmount) {
+		twa.Transaction = restOrig[twa.Transaction]
+		trs = append(trs, twa)
+	}
+
+	return trs
+}
+
+// LotMatcherFromName returns the lot matcher by name or nil if unknown
+func LotMatcherFromName(name string) LotMatcher {
+	switch strings.ToLower(name) {
+	case "fifo":
+		return &FIFOLotMatcher{}
+	case "lifo":
+		return &LIFOLotMatcher{}
+	case "hifo":
+		return &HIFOLotMatcher{}
+	case "average", "avg":
+		return &AverageLotMatcher{}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/importers"
+	"github.com/k3a/in2tracker/backend/store"
+	"github.com/stretchr/testify/require"
+)
+
+func lotMatcherTransactions() []*importers.Transaction {
+	return []*importers.Transaction{
+		testTransaction(importers.TTBuy, "2019-01-10", 10, 100),
+		testTransaction(importers.TTBuy, "2019-02-10", 10, 300),
+		testTransaction(importers.TTBuy, "2019-03-10", 10, 200),
+		testTransaction(importers.TTSell, "2020-03-01", 15, 250),
+	}
+}
+
+func processWithMatcher(t *testing.T, matcher LotMatcher) *ProcessSell {
+	proc := NewTransactionProcessor(lotMatcherTransactions(), store.NewTest(), currency.CZK, 2020, &NoTaxRules{})
+	proc.LotMatcher = matcher
+
+	res, err := proc.Process()
+	require.Nil(t, err)
+	require.Equal(t, matcher.Name(), res.LotMatcher)
+	require.Len(t, res.Sells, 1)
+	require.Zero(t, res.Sells[0].MissingQuantity)
+	return res.Sells[0]
+}
+
+func TestLotMatchers(t *testing.T) {
+	sell := processWithMatcher(t, &FIFOLotMatcher{})
+	require.Len(t, sell.Lots, 2)
+	require.Equal(t, 100.0, sell.Lots[0].BuyPrice)
+	require.Equal(t, 300.0, sell.Lots[1].BuyPrice)
+	require.Equal(t, 5.0, sell.Lots[1].Quantity)
+	require.InDelta(t, 2500, sell.Cost, 0.001)
+
+	sell = processWithMatcher(t, &LIFOLotMatcher{})
+	require.Len(t, sell.Lots, 2)
+	require.Equal(t, 200.0, sell.Lots[0].BuyPrice)
+	require.Equal(t, 300.0, sell.Lots[1].BuyPrice)
+	require.InDelta(t, 3500, sell.Cost, 0.001)
+
+	sell = processWithMatcher(t, &HIFOLotMatcher{})
+	require.Len(t, sell.Lots, 2)
+	require.Equal(t, 300.0, sell.Lots[0].BuyPrice)
+	require.Equal(t, 200.0, sell.Lots[1].BuyPrice)
+	require.InDelta(t, 4000, sell.Cost, 0.001)
+
+	sell = processWithMatcher(t, &AverageLotMatcher{})
+	require.Len(t, sell.Lots, 3)
+	require.InDelta(t, 5, sell.Lots[0].Quantity, 0.001)
+	require.InDelta(t, 3000, sell.Cost, 0.001)
+	require.InDelta(t, 750, sell.GainLoss, 0.001)
+}
+
+func TestSpecificLotMatcher(t *testing.T) {
+	trs := lotMatcherTransactions()
+
+	specJSON := `[{"Sell": "` + trs[3].Hash()[:10] + `",
+		"Buys": [{"Buy": "` + strings.ToUpper(trs[2].Hash()[:10]) + `", "Amount": 4}]}]`
+	specs, err := LoadLotSpecifications(strings.NewReader(specJSON))
+	require.Nil(t, err)
+
+	// 4 from the third buy, the rest from the oldest
+	sell := processWithMatcher(t, &SpecificLotMatcher{specs, &FIFOLotMatcher{}})
+	require.Len(t, sell.Lots, 3)
+	require.Equal(t, 200.0, sell.Lots[0].BuyPrice)
+	require.Equal(t, 4.0, sell.Lots[0].Quantity)
+	require.Equal(t, 100.0, sell.Lots[1].BuyPrice)
+	require.Equal(t, 10.0, sell.Lots[1].Quantity)
+	require.Equal(t, 300.0, sell.Lots[2].BuyPrice)
+	require.Equal(t, 1.0, sell.Lots[2].Quantity)
+}
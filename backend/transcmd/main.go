@@ -1,26 +1,286 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/alexflint/go-arg"
+	"github.com/k3a/in2tracker/backend/companydata"
 	"github.com/k3a/in2tracker/backend/currency"
 	"github.com/k3a/in2tracker/backend/importers"
+	"github.com/k3a/in2tracker/backend/model"
 	"github.com/k3a/in2tracker/backend/store"
 )
 
+// loadMappingImporter creates a declarative CSV importer from the mapping file
+func loadMappingImporter(mappingPath string) (importers.Importer, error) {
+	file, err := os.Open(mappingPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mapping, err := importers.LoadCSVMapping(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return importers.NewCSVMappingImporter(mapping)
+}
+
+// loadLotMatcher creates the lot matcher by name, optionally with specific lots from the file
+func loadLotMatcher(name, lotsPath string) (LotMatcher, error) {
+	matcher := LotMatcherFromName(name)
+	if matcher == nil {
+		return nil, fmt.Errorf("unknown lot matching %s", name)
+	}
+	if len(lotsPath) == 0 {
+		return matcher, nil
+	}
+
+	file, err := os.Open(lotsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	specs, err := LoadLotSpecifications(file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading lots %s: %s", lotsPath, err)
+	}
+
+	return &SpecificLotMatcher{specs, matcher}, nil
+}
+
+type rateConverter struct {
+	mode      string
+	converter Converter
+}
+
+// rateConverters returns converters for the rate mode (daily, uniform or both)
+func rateConverters(mode, uniformRatesPath string, rates *currency.CachingConverter) ([]*rateConverter, error) {
+	uniform := currency.NewUniformRates(rates.Convert)
+	if len(uniformRatesPath) > 0 {
+		file, err := os.Open(uniformRatesPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		published, err := currency.LoadUniformRates(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, rate := range published {
+			uniform.Set(rate)
+		}
+	}
+
+	daily := &rateConverter{"daily", rates}
+	uniformConv := &rateConverter{"uniform", uniform}
+
+	switch strings.ToLower(mode) {
+	case "daily":
+		return []*rateConverter{daily}, nil
+	case "uniform":
+		return []*rateConverter{uniformConv}, nil
+	case "both":
+		return []*rateConverter{daily, uniformConv}, nil
+	}
+	return nil, fmt.Errorf("unknown rates %s", mode)
+}
+
+// printRateComparison prints tax bases computed using different rates
+func printRateComparison(w io.Writer, results []*ProcessResult) {
+	fmt.Fprintf(w, "\nRATES COMPARISON (in %s):\n", results[0].PrimaryCurrency)
+	for _, res := range results {
+		dividendTax := 0.0
+		for _, pc := range res.Countries {
+			dividendTax += pc.TotalDividendTaxPaidInPrimaryCurrency
+		}
+		fmt.Fprintf(w, "  * %-8s taxable sells %.2f, dividends %.2f, dividend tax paid %.2f\n", res.RateMode,
+			res.TaxableRevenuesInPrimaryCurrency-res.TaxableExpensesInPrimaryCurrency,
+			res.TotalDividendIncomeInPrimaryCurrency(), dividendTax)
+	}
+}
+
+// setupRateProviders registers the local rate files as the first provider.
+// In offline mode, online providers are removed.
+func setupRateProviders(rateFiles []string, offline bool) error {
+	var providers []currency.Provider
+	if len(rateFiles) > 0 {
+		fileProvider, err := currency.NewFileProvider(rateFiles...)
+		if err != nil {
+			return err
+		}
+		providers = append(providers, fileProvider)
+	}
+
+	if !offline {
+		providers = append(providers, currency.Providers...)
+	}
+	currency.Providers = providers
+	return nil
+}
+
+// storeTransactions stores transactions imported from each statement to the portfolio
+// (skipping already stored ones) and returns all the transactions of the portfolio
+func storeTransactions(storePtr *store.Store, portfolioID int64, statements [][]*importers.Transaction) ([]*importers.Transaction, error) {
+	added, imported := 0, 0
+	for _, trs := range statements {
+		var models []*model.Transaction
+		for _, t := range trs {
+			models = append(models, t.Model(portfolioID))
+		}
+
+		// identical transactions are told apart within a statement, so statements are saved one by one
+		num, err := storePtr.SaveTransactions(models)
+		if err != nil {
+			return nil, err
+		}
+		added += num
+		imported += len(trs)
+	}
+	fmt.Fprintf(os.Stderr, "Stored %d new transactions (%d already known)\n", added, imported-added)
+
+	models, err := storePtr.FindTransactions(&store.TransactionFilter{PortfolioID: portfolioID})
+	if err != nil {
+		return nil, err
+	}
+
+	var allTrs []*importers.Transaction
+	for _, mt := range models {
+		allTrs = append(allTrs, importers.TransactionFromModel(mt))
+	}
+	return allTrs, nil
+}
+
+// linkItemISINs links the items known just by the ticker and just by the ISIN
+// given as TICKER=ISIN (brokers exporting just one of them can't be linked otherwise)
+func linkItemISINs(storePtr *store.Store, links []string) error {
+	for _, link := range links {
+		parts := strings.SplitN(link, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return fmt.Errorf("wrong ISIN link %s (TICKER=ISIN expected)", link)
+		}
+		_, err := storePtr.ResolveItem(model.ItemIdentifiers{Ticker: parts[0], ISIN: parts[1]})
+		if err != nil {
+			return fmt.Errorf("unable to link %s to %s: %s", parts[0], parts[1], err)
+		}
+	}
+	return nil
+}
+
+// resolveItems replaces items of the transactions by codes of the stored items, so the same
+// item traded under its ticker at one broker and under its ISIN at another is processed as one
+func resolveItems(storePtr *store.Store, trs []*importers.Transaction) error {
+	for _, tr := range trs {
+		if len(tr.Item) == 0 {
+			continue
+		}
+		item, err := storePtr.FindItem(tr.Identifiers())
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		tr.Item = item.Code
+		if len(tr.ISIN) == 0 {
+			tr.ISIN = item.ISIN
+		}
+	}
+	return nil
+}
+
 func main() {
 	var args struct {
 		TransactionsOnly bool     `arg:"-t,help:only print transactions"`
-		Files            []string `arg:"positional,required,help:CSV files to import"`
+		Format           string   `arg:"-f,help:format of all the files (autodetected by default)"`
+		Mappings         []string `arg:"-m,separate,help:JSON CSV mapping file describing additional format"`
+		Database         string   `arg:"-d,help:sqlite database file storing transactions and rates"`
+		Portfolio        string   `arg:"-p,help:name of the portfolio to import transactions to and process"`
+		Year             int      `arg:"-y,help:tax year to process (previous year by default)"`
+		Rules            string   `arg:"-r,help:tax rules to apply (cz or none)"`
+		Matching         string   `arg:"help:cost-basis lot matching (fifo, lifo, hifo or average)"`
+		Lots             string   `arg:"help:JSON file assigning specific buys to sells (others are matched by --matching)"`
+		Rates            string   `arg:"help:currency rates for conversion to CZK (daily, uniform or both, both needs text or dap-summary output)"`
+		UniformRates     string   `arg:"help:JSON file with published uniform rates (computed from month-end rates otherwise)"`
+		Fallback         string   `arg:"help:rate used for weekends and holidays (previous or next business day, or strict)"`
+		Output           string   `arg:"-o,help:output format of the results (text, json, csv, dap or dap-summary)"`
+		LoadECBHistory   bool     `arg:"--load-ecb-history,help:download the complete ECB rate history to the database first"`
+		RateFiles        []string `arg:"--rate-files,separate,help:local rate file or directory (CNB daily/yearly files, CSV or JSON) used before online providers"`
+		Offline          bool     `arg:"help:use only stored and local rates and company data (no network access)"`
+		ProfileMaxAge    int      `arg:"--profile-max-age,help:days after which stored company profiles are refreshed (0 = never)"`
+		ISINs            []string `arg:"--isin,separate,help:ISIN of a ticker (TICKER=ISIN) linking items traded under just one of them (company data of items known just by ISIN are fetched by the linked ticker)"`
+		Files            []string `arg:"positional,help:files to import (stored transactions are processed if none)"`
 	}
+	args.Database = "database.db"
+	args.Portfolio = "default"
+	args.Year = time.Now().Year() - 1
+	args.Rules = "cz"
+	args.Matching = "fifo"
+	args.Output = "text"
+	args.Rates = "daily"
+	args.Fallback = string(currency.FallbackPrevious)
+	args.ProfileMaxAge = int(companydata.DefaultProfileMaxAge / (24 * time.Hour))
 	arg.MustParse(&args)
 
-	var trs []*importers.Transaction
+	fallback, err := currency.FallbackPolicyFromName(args.Fallback)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	currency.Fallback = fallback
+
+	if err := setupRateProviders(args.RateFiles, args.Offline); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if args.Offline && args.LoadECBHistory {
+		fmt.Fprintf(os.Stderr, "ECB rate history cannot be loaded offline\n")
+		os.Exit(1)
+	}
+
+	taxRules := TaxRulesFromName(args.Rules)
+	if taxRules == nil {
+		fmt.Fprintf(os.Stderr, "Unknown tax rules %s\n", args.Rules)
+		os.Exit(1)
+	}
+
+	lotMatcher, err := loadLotMatcher(args.Matching, args.Lots)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	var statements [][]*importers.Transaction
+
+	for _, mappingPath := range args.Mappings {
+		imp, err := loadMappingImporter(mappingPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading mapping %s: %s\n", mappingPath, err)
+			os.Exit(1)
+		}
+		importers.RegisterImporter(imp)
+	}
 
-	imp := importers.NewCZFioImporter()
+	var forcedImp importers.Importer
+	if len(args.Format) > 0 {
+		forcedImp = importers.FromName(args.Format)
+		if forcedImp == nil {
+			var names []string
+			for _, imp := range importers.Importers {
+				names = append(names, imp.Name())
+			}
+			fmt.Fprintf(os.Stderr, "Unknown format %s (known formats: %s)\n",
+				args.Format, strings.Join(names, ", "))
+			os.Exit(1)
+		}
+	}
 
 	for _, filePath := range args.Files {
 		file, err := os.Open(filePath)
@@ -30,73 +290,108 @@ func main() {
 		}
 		defer file.Close()
 
-		curTrs, err := imp.Import(file)
+		imp := forcedImp
+		var rd io.Reader = file
+		if imp == nil {
+			imp, rd, err = importers.Detect(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to detect format of %s (use --format): %s\n", filePath, err)
+				os.Exit(1)
+			}
+		}
+
+		curTrs, err := imp.Import(rd)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error importing file %s: %s\n", filePath, err)
 			os.Exit(1)
 		}
 
-		trs = append(trs, curTrs...)
+		statements = append(statements, curTrs)
 	}
 
 	// open store
-	storePtr := store.New("sqlite3", "database.db")
+	storePtr := store.New("sqlite3", args.Database)
+
+	if args.LoadECBHistory {
+		num, err := currency.NewEUECB(currency.ECBBaseURL).LoadHistory(storePtr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading ECB rate history: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Loaded %d ECB rates\n", num)
+	}
+
+	// portfolio (owner 0 is the local command-line user)
+	portfolio, err := storePtr.GetOrCreatePortfolio(0, args.Portfolio)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening portfolio %s: %s\n", args.Portfolio, err)
+		os.Exit(1)
+	}
+
+	// store newly imported transactions and load the complete history
+	trs, err := storeTransactions(storePtr, portfolio.ID, statements)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error storing transactions: %s\n", err)
+		os.Exit(1)
+	}
+	if err = linkItemISINs(storePtr, args.ISINs); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if err = resolveItems(storePtr, trs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving items: %s\n", err)
+		os.Exit(1)
+	}
+
+	rates := currency.NewCachingConverter(storePtr, currency.DefaultCacheSize)
+	renderer := OutputRendererFromName(args.Output, rates)
+	if renderer == nil {
+		fmt.Fprintf(os.Stderr, "Unknown output format %s\n", args.Output)
+		os.Exit(1)
+	}
+
+	converters, err := rateConverters(args.Rates, args.UniformRates, rates)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if len(converters) > 1 && singleDocumentOutput(args.Output) {
+		fmt.Fprintf(os.Stderr, "Rates %s can't be used with the %s output, choose daily or uniform\n",
+			args.Rates, args.Output)
+		os.Exit(1)
+	}
 
 	// do the job
-	proc := NewTransactionProcessor(trs, storePtr, currency.CZK)
+	proc := NewTransactionProcessor(trs, storePtr, currency.CZK, args.Year, taxRules)
+	proc.LotMatcher = lotMatcher
+	proc.Offline = args.Offline
+	proc.Profiles.MaxAge = time.Duration(args.ProfileMaxAge) * 24 * time.Hour
 
 	if args.TransactionsOnly {
 		if err := proc.PrintTransactions(); err != nil {
 			panic(err)
 		}
 	} else {
-		// process
-		res, err := proc.Process()
-		if err != nil {
-			panic(err)
-		}
+		// process using each of the rate modes
+		var results []*ProcessResult
+		for _, rc := range converters {
+			proc.Converter = rc.converter
+			proc.RateMode = rc.mode
 
-		// for each country..
-		for countryName, pc := range res.Countries {
-			fmt.Printf("\nCOUNTRY %s\n", countryName)
-			// for each company from the country ...
-			for _, it := range pc.Items {
-				fmt.Printf("  * COMPANY %s - %s - %s\n", it.Item.Code, it.Item.Name, it.Item.Address)
-				fmt.Printf("    * Dividend Income: %.2f %s\n", it.DividendIncomeInPrimaryCurrency, proc.PrimaryCurrency)
-				fmt.Printf("    * Dividend Tax Paid (local currency): %.2f %s\n", it.DividendTaxPaid, it.Currency)
-				fmt.Printf("    * Dividend Tax Paid (in primary): %.2f %s\n", it.DividendTaxPaidInPrimaryCurrency, proc.PrimaryCurrency)
+			res, err := proc.Process()
+			if err != nil {
+				panic(err)
 			}
-			fmt.Printf("  * Total Dividend Tax Paid in %s: %.2f %s\n",
-				countryName, pc.TotalDividendTaxPaidInPrimaryCurrency, proc.PrimaryCurrency)
-			fmt.Printf("  * Total Dividend Revenues in %s: %.2f %s\n",
-				countryName, pc.TotalDividendIncomeInPrimaryCurrency, proc.PrimaryCurrency)
-		}
+			results = append(results, res)
 
-		// print exp/rev in primary currency
-		fmt.Printf("\nTOTAL IN %s (excl. dividends):\n", proc.PrimaryCurrency)
-		fmt.Printf("  * Expenses: %.2f %s\n", res.TotalExpensesInPrimaryCurrency, proc.PrimaryCurrency)
-		fmt.Printf("  * Revenues: %.2f %s\n", res.TotalRevenuesInPrimaryCurrency, proc.PrimaryCurrency)
-
-		totalDividendIncomePrimary := 0.0
-		for _, pc := range res.Countries {
-			totalDividendIncomePrimary += pc.TotalDividendIncomeInPrimaryCurrency
+			if err := renderer.Render(os.Stdout, res); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %s\n", err)
+				os.Exit(1)
+			}
 		}
-		fmt.Printf("\nTOTAL DIVIDEND INCOME IN %s: %.2f\n", proc.PrimaryCurrency, totalDividendIncomePrimary)
 
-		// print net total gain/loss in individual currencies
-		currencyCache := NewCurrencyCache(storePtr)
-		totalGainLossPrimary := 0.0
-		fmt.Printf("\nTOTAL NET GAIN/LOSS IN ORIGINAL CURRENCIES (excl. dividends):\n")
-		for currency, total := range res.TotalGainLossByCurrency {
-			totalInPrimary, err := currencyCache.Convert(total, currency, proc.PrimaryCurrency, time.Now())
-			if err != nil {
-				fmt.Printf("  * %.2f %s\n", total, currency)
-			} else {
-				totalGainLossPrimary += totalInPrimary
-				fmt.Printf("  * %.2f %s (= %.2f %s today)\n",
-					total, currency, totalInPrimary, proc.PrimaryCurrency)
-			}
+		if len(results) > 1 {
+			printRateComparison(os.Stderr, results)
 		}
-		fmt.Printf("  => SUM IN %s TODAY: %.2f\n", proc.PrimaryCurrency, totalGainLossPrimary)
 	}
 }
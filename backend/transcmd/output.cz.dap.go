@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/importers"
+)
+
+// ISO 3166 codes of countries as named by company data providers
+var dapCountryCodes = map[string]string{
+	"czech republic": "CZ", "czechia": "CZ",
+	"united states": "US", "usa": "US",
+	"united kingdom": "GB",
+	"germany":        "DE",
+	"netherlands":    "NL",
+	"ireland":        "IE",
+	"france":         "FR",
+	"switzerland":    "CH",
+	"canada":         "CA",
+	"austria":        "AT",
+	"belgium":        "BE",
+	"denmark":        "DK",
+	"finland":        "FI",
+	"italy":          "IT",
+	"spain":          "ES",
+	"sweden":         "SE",
+	"norway":         "NO",
+	"poland":         "PL",
+	"luxembourg":     "LU",
+	"japan":          "JP",
+	"china":          "CN",
+	"hong kong":      "HK",
+	"taiwan":         "TW",
+	"australia":      "AU",
+	"bermuda":        "BM",
+}
+
+// DAPCountry holds foreign income of a single country (Příloha 3)
+type DAPCountry struct {
+	Name string
+	Code string
+	// income from sources in the country (row 321)
+	Income float64
+	// tax paid in the country (row 323)
+	TaxPaid float64
+}
+
+// DAP holds amounts of the Czech personal income tax return (daňové přiznání FO) in CZK
+type DAP struct {
+	Year int
+	// §8 capital income - foreign dividends and interest (row 38)
+	CapitalIncome float64
+	// §10 sales of securities after the time-test exemption (Příloha 2)
+	SecuritiesRevenues float64
+	SecuritiesExpenses float64
+	// §10 partial tax base (row 40), losses can't be claimed
+	OtherIncomeBase float64
+	// foreign income by country (Příloha 3)
+	Countries []*DAPCountry
+	// problems which need manual attention
+	Warnings []string
+}
+
+// NewDAP maps the process result onto the tax return lines
+func NewDAP(res *ProcessResult) (*DAP, error) {
+	if res.PrimaryCurrency != currency.CZK {
+		return nil, fmt.Errorf("tax return requires results in CZK, not %s", res.PrimaryCurrency)
+	}
+
+	dap := &DAP{
+		Year:               res.TaxYear,
+		SecuritiesRevenues: res.TaxableRevenuesInPrimaryCurrency,
+		SecuritiesExpenses: res.TaxableExpensesInPrimaryCurrency,
+	}
+	dap.OtherIncomeBase = math.Max(0, dap.SecuritiesRevenues-dap.SecuritiesExpenses)
+
+	// foreign dividends (Czech ones are taxed by the withholding tax)
+	for _, name := range res.CountryNames() {
+		pc := res.Countries[name]
+
+		code, known := dapCountryCodes[strings.ToLower(name)]
+		if !known {
+			// kod_stat must be an ISO code, the income can't be reported without it
+			return nil, fmt.Errorf("unknown ISO code of country %s", name)
+		}
+		if code == "CZ" {
+			continue
+		}
+
+		dap.CapitalIncome += pc.TotalDividendIncomeInPrimaryCurrency
+		dap.Countries = append(dap.Countries, &DAPCountry{
+			Name:    name,
+			Code:    code,
+			Income:  pc.TotalDividendIncomeInPrimaryCurrency,
+			TaxPaid: pc.TotalDividendTaxPaidInPrimaryCurrency,
+		})
+	}
+
+	// interest from brokers is paid by the broker, not by an issuer, so the source country
+	// is not known from the transactions and the Příloha 3 row has to be added manually
+	interest := 0.0
+	for _, cash := range res.Cash {
+		if cash.Type == importers.TTInterest.String() {
+			interest += cash.RevenuesInPrimaryCurrency
+		}
+	}
+	if interest > 0 {
+		dap.CapitalIncome += interest
+		dap.Warnings = append(dap.Warnings, fmt.Sprintf("interest of %d CZK is included in §8 "+
+			"but not in Příloha 3, add it to the row of the broker's country", dapRound(interest)))
+	}
+
+	for _, sell := range res.Sells {
+		if sell.MissingQuantity > 0 {
+			dap.Warnings = append(dap.Warnings, fmt.Sprintf("purchase of %.2f items of %s not found, "+
+				"their expenses are missing", sell.MissingQuantity, sell.Item))
+		}
+	}
+
+	return dap, nil
+}
+
+// whole CZK as used by the tax return forms
+func dapRound(amount float64) int64 {
+	return int64(math.Round(amount))
+}
+
+// EPO XML structure of the DPFDP5 form
+
+type dapXMLVetaD struct {
+	Dokument string `xml:"dokument,attr"`
+	KUladis  string `xml:"k_uladis,attr"`
+	Rok      int    `xml:"rok,attr"`
+	DapTyp   string `xml:"dap_typ,attr"`
+	KcZd8    int64  `xml:"kc_zd8,attr"`
+	KcZd10   int64  `xml:"kc_zd10,attr"`
+}
+
+type dapXMLVetaJ struct {
+	KodDrPrij10 string `xml:"kod_dr_prij10,attr"`
+	DruhPrij10  string `xml:"druh_prij10,attr"`
+	Prijmy10    int64  `xml:"prijmy10,attr"`
+	Vydaje10    int64  `xml:"vydaje10,attr"`
+	Rozdil10    int64  `xml:"rozdil10,attr"`
+}
+
+type dapXMLVetaL struct {
+	KodStat   string `xml:"kod_stat,attr"`
+	PrijZahr  int64  `xml:"prij_zahr,attr"`
+	VydajZahr int64  `xml:"vyd_zahr,attr"`
+	KcDanZah  int64  `xml:"kc_dan_zah,attr"`
+}
+
+type dapXMLForm struct {
+	VerzePis string         `xml:"verzePis,attr"`
+	VetaD    dapXMLVetaD    `xml:"VetaD"`
+	VetaJ    []*dapXMLVetaJ `xml:"VetaJ"`
+	VetaL    []*dapXMLVetaL `xml:"VetaL"`
+}
+
+type dapXMLPisemnost struct {
+	XMLName xml.Name   `xml:"Pisemnost"`
+	NazevSW string     `xml:"nazevSW,attr"`
+	VerzeSW string     `xml:"verzeSW,attr"`
+	DPFDP5  dapXMLForm `xml:"DPFDP5"`
+}
+
+// DAPXMLRenderer writes the tax return in the EPO XML format which can be loaded
+// to the tax portal (personal data of the taxpayer are to be filled in there)
+type DAPXMLRenderer struct{}
+
+// Render writes the result
+func (r *DAPXMLRenderer) Render(w io.Writer, res *ProcessResult) error {
+	dap, err := NewDAP(res)
+	if err != nil {
+		return err
+	}
+
+	doc := &dapXMLPisemnost{
+		NazevSW: "in2tracker",
+		VerzeSW: "1.0",
+		DPFDP5: dapXMLForm{
+			VerzePis: "01.01",
+			VetaD: dapXMLVetaD{
+				Dokument: "DP5",
+				KUladis:  "DPF",
+				Rok:      dap.Year,
+				DapTyp:   "B",
+				KcZd8:    dapRound(dap.CapitalIncome),
+				KcZd10:   dapRound(dap.OtherIncomeBase),
+			},
+		},
+	}
+
+	if dap.SecuritiesRevenues > 0 {
+		doc.DPFDP5.VetaJ = append(doc.DPFDP5.VetaJ, &dapXMLVetaJ{
+			KodDrPrij10: "D",
+			DruhPrij10:  "Prodej cenných papírů",
+			Prijmy10:    dapRound(dap.SecuritiesRevenues),
+			Vydaje10:    dapRound(dap.SecuritiesExpenses),
+			Rozdil10:    dapRound(dap.SecuritiesRevenues) - dapRound(dap.SecuritiesExpenses),
+		})
+	}
+
+	for _, c := range dap.Countries {
+		doc.DPFDP5.VetaL = append(doc.DPFDP5.VetaL, &dapXMLVetaL{
+			KodStat:  c.Code,
+			PrijZahr: dapRound(c.Income),
+			KcDanZah: dapRound(c.TaxPaid),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// DAPSummaryRenderer writes a human-readable summary of the tax return lines
+type DAPSummaryRenderer struct{}
+
+// Render writes the result
+func (r *DAPSummaryRenderer) Render(w io.Writer, res *ProcessResult) error {
+	dap, err := NewDAP(res)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "DAŇOVÉ PŘIZNÁNÍ FO ZA ROK %d (%s)\n", dap.Year, res.TaxRules)
+
+	fmt.Fprintf(w, "\n§8 PŘÍJMY Z KAPITÁLOVÉHO MAJETKU\n")
+	fmt.Fprintf(w, "  ř. 38 dílčí základ daně: %d Kč\n", dapRound(dap.CapitalIncome))
+
+	fmt.Fprintf(w, "\n§10 OSTATNÍ PŘÍJMY - PRODEJ CENNÝCH PAPÍRŮ (Příloha 2)\n")
+	fmt.Fprintf(w, "  příjmy: %d Kč\n", dapRound(dap.SecuritiesRevenues))
+	fmt.Fprintf(w, "  výdaje: %d Kč\n", dapRound(dap.SecuritiesExpenses))
+	fmt.Fprintf(w, "  osvobozené příjmy (časový test, limit): %d Kč\n", dapRound(res.ExemptRevenuesInPrimaryCurrency))
+	fmt.Fprintf(w, "  ř. 40 dílčí základ daně: %d Kč\n", dapRound(dap.OtherIncomeBase))
+
+	fmt.Fprintf(w, "\nPŘÍJMY ZE ZAHRANIČÍ (Příloha 3)\n")
+	for _, c := range dap.Countries {
+		fmt.Fprintf(w, "  %s (%s)\n", c.Name, c.Code)
+		fmt.Fprintf(w, "    ř. 321 příjmy ze zdrojů v zahraničí: %d Kč\n", dapRound(c.Income))
+		fmt.Fprintf(w, "    ř. 323 daň zaplacená v zahraničí: %d Kč\n", dapRound(c.TaxPaid))
+	}
+
+	for _, warn := range dap.Warnings {
+		fmt.Fprintf(w, "\n!!! WARN: %s", warn)
+	}
+	if len(dap.Warnings) > 0 {
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
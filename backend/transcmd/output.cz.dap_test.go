@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/importers"
+	"github.com/stretchr/testify/require"
+)
+
+func dapTestResult() *ProcessResult {
+	res := NewProcessResult(currency.CZK)
+	res.TaxYear = 2020
+	res.TaxRules = "cz"
+	res.TaxableRevenuesInPrimaryCurrency = 150000.4
+	res.TaxableExpensesInPrimaryCurrency = 100000.2
+	res.ExemptRevenuesInPrimaryCurrency = 50000
+	res.Countries["United States"] = &ProcessCountry{
+		TotalDividendIncomeInPrimaryCurrency:  1000,
+		TotalDividendTaxPaidInPrimaryCurrency: 150,
+	}
+	res.Countries["Czech Republic"] = &ProcessCountry{
+		TotalDividendIncomeInPrimaryCurrency:  500,
+		TotalDividendTaxPaidInPrimaryCurrency: 75,
+	}
+	res.Cash = append(res.Cash, &ProcessCash{Type: importers.TTInterest.String(), RevenuesInPrimaryCurrency: 20})
+	return res
+}
+
+func TestNewDAP(t *testing.T) {
+	dap, err := NewDAP(dapTestResult())
+	require.Nil(t, err)
+	require.Equal(t, 1020.0, dap.CapitalIncome)
+	require.InDelta(t, 50000.2, dap.OtherIncomeBase, 0.001)
+	require.Len(t, dap.Countries, 1)
+	require.Equal(t, "US", dap.Countries[0].Code)
+	require.Len(t, dap.Warnings, 1)
+	require.Contains(t, dap.Warnings[0], "interest of 20 CZK")
+
+	// income from a country without ISO code can't be filed
+	res := dapTestResult()
+	res.Countries["Atlantis"] = &ProcessCountry{TotalDividendIncomeInPrimaryCurrency: 10}
+	_, err = NewDAP(res)
+	require.Error(t, err)
+
+	// losses are not claimed
+	res = dapTestResult()
+	res.TaxableExpensesInPrimaryCurrency = 200000
+	dap, err = NewDAP(res)
+	require.Nil(t, err)
+	require.Zero(t, dap.OtherIncomeBase)
+
+	_, err = NewDAP(NewProcessResult(currency.USD))
+	require.Error(t, err)
+}
+
+func TestDAPXMLRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, (&DAPXMLRenderer{}).Render(&buf, dapTestResult()))
+
+	var doc dapXMLPisemnost
+	require.Nil(t, xml.Unmarshal(buf.Bytes(), &doc))
+	require.Equal(t, 2020, doc.DPFDP5.VetaD.Rok)
+	require.Equal(t, int64(1020), doc.DPFDP5.VetaD.KcZd8)
+	require.Equal(t, int64(50000), doc.DPFDP5.VetaD.KcZd10)
+	require.Len(t, doc.DPFDP5.VetaJ, 1)
+	require.Equal(t, int64(150000), doc.DPFDP5.VetaJ[0].Prijmy10)
+	require.Len(t, doc.DPFDP5.VetaL, 1)
+	require.Equal(t, "US", doc.DPFDP5.VetaL[0].KodStat)
+	require.Equal(t, int64(150), doc.DPFDP5.VetaL[0].KcDanZah)
+}
+
+func TestDAPSummaryRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	require.Nil(t, (&DAPSummaryRenderer{}).Render(&buf, dapTestResult()))
+	require.True(t, strings.Contains(buf.String(), "ř. 40 dílčí základ daně: 50000 Kč"))
+}
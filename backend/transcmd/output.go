@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OutputRenderer writes the process result in a specific format
+type OutputRenderer interface {
+	Render(w io.Writer, res *ProcessResult) error
+}
+
+// OutputRendererFromName returns the renderer by name or nil if unknown.
+// The converter is used by the text renderer to show today's values.
+func OutputRendererFromName(name string, converter Converter) OutputRenderer {
+	switch strings.ToLower(name) {
+	case "text":
+		return &TextRenderer{converter}
+	case "json":
+		return &JSONRenderer{}
+	case "csv":
+		return &CSVRenderer{}
+	case "dap":
+		return &DAPXMLRenderer{}
+	case "dap-summary":
+		return &DAPSummaryRenderer{}
+	}
+	return nil
+}
+
+// singleDocumentOutput returns true if the output format holds just one result
+// (rendering more results would produce an invalid document)
+func singleDocumentOutput(name string) bool {
+	switch strings.ToLower(name) {
+	case "json", "csv", "dap":
+		return true
+	}
+	return false
+}
+
+// JSONRenderer writes the complete result as indented JSON
+type JSONRenderer struct{}
+
+// Render writes the result
+func (r *JSONRenderer) Render(w io.Writer, res *ProcessResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
+
+// CSVRenderer writes the result as a flat table with one record per line
+// suitable for spreadsheets. The first column specifies the record type
+// (sell, lot, dividend, cash, country, rate, total).
+type CSVRenderer struct{}
+
+var csvHeader = []string{"Record", "Item", "Country", "Time", "BuyTime", "Quantity", "Price",
+	"Amount", "Currency", "RevenuesInPrimary", "ExpensesInPrimary", "Exempt", "Note"}
+
+func csvFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Render writes the result
+func (r *CSVRenderer) Render(w io.Writer, res *ProcessResult) error {
+	cw := csv.NewWriter(w)
+	primary := string(res.PrimaryCurrency)
+
+	records := [][]string{csvHeader}
+	for _, sell := range res.Sells {
+		records = append(records, []string{"sell", sell.Item, "", csvTime(sell.Time), "",
+			csvFloat(sell.Quantity), "", csvFloat(sell.NetTotal), string(sell.Currency),
+			csvFloat(sell.RevenueInPrimaryCurrency), csvFloat(sell.ExpensesInPrimaryCurrency), "",
+			fmt.Sprintf("gain/loss %s, missing quantity %s", csvFloat(sell.GainLoss), csvFloat(sell.MissingQuantity))})
+		for _, lot := range sell.Lots {
+			records = append(records, []string{"lot", sell.Item, "", csvTime(sell.Time), csvTime(lot.BuyTime),
+				csvFloat(lot.Quantity), csvFloat(lot.BuyPrice), csvFloat(-lot.Cost), string(sell.Currency),
+				csvFloat(lot.RevenueInPrimaryCurrency), csvFloat(lot.ExpensesInPrimaryCurrency),
+				strconv.FormatBool(lot.HoldingExempt), ""})
+		}
+	}
+	for _, div := range res.Dividends {
+		revenues, expenses := div.NetTotalInPrimaryCurrency, 0.0
+		if revenues < 0 {
+			revenues, expenses = 0, -revenues
+		}
+		records = append(records, []string{"dividend", div.Item, div.Country, csvTime(div.Time), "",
+			"", "", csvFloat(div.NetTotal), string(div.Currency), csvFloat(revenues), csvFloat(expenses), "", ""})
+	}
+	for _, cash := range res.Cash {
+		records = append(records, []string{"cash", cash.Item, "", csvTime(cash.Time), "",
+			"", "", csvFloat(cash.Revenues - cash.Expenses), string(cash.Currency),
+			csvFloat(cash.RevenuesInPrimaryCurrency), csvFloat(cash.ExpensesInPrimaryCurrency), "",
+			cash.Type + " " + cash.Reference})
+	}
+	for _, name := range res.CountryNames() {
+		pc := res.Countries[name]
+		records = append(records, []string{"country", "", name, "", "", "", "", "", primary,
+			csvFloat(pc.TotalDividendIncomeInPrimaryCurrency), csvFloat(pc.TotalDividendTaxPaidInPrimaryCurrency),
+			"", "dividend income and tax paid"})
+	}
+	for _, rate := range res.Rates {
+		note := ""
+		if len(rate.RateDate) > 0 && rate.RateDate != rate.Date {
+			note = "rate of " + rate.RateDate
+		}
+		records = append(records, []string{"rate", string(rate.From), "", rate.Date, "", "", csvFloat(rate.Rate),
+			"", string(rate.To), "", "", "", note})
+	}
+	records = append(records,
+		[]string{"total", "", "", "", "", "", "", "", primary, csvFloat(res.TotalRevenuesInPrimaryCurrency),
+			csvFloat(res.TotalExpensesInPrimaryCurrency), "", fmt.Sprintf("tax year %d, %s rates", res.TaxYear, res.RateMode)},
+		[]string{"total", "", "", "", "", "", "", "", primary, csvFloat(res.ExemptRevenuesInPrimaryCurrency),
+			csvFloat(res.ExemptExpensesInPrimaryCurrency), "true", "sells exempt by " + res.TaxRules + " rules"},
+		[]string{"total", "", "", "", "", "", "", "", primary, csvFloat(res.TaxableRevenuesInPrimaryCurrency),
+			csvFloat(res.TaxableExpensesInPrimaryCurrency), "false", "sells taxable by " + res.TaxRules + " rules"})
+
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// TextRenderer writes a human-readable report
+type TextRenderer struct {
+	converter Converter
+}
+
+// Render writes the result
+func (r *TextRenderer) Render(w io.Writer, res *ProcessResult) error {
+	primary := res.PrimaryCurrency
+
+	// sells with matched lots
+	fmt.Fprintf(w, "SELLS (%s lot matching, %s rates):\n", res.LotMatcher, res.RateMode)
+	for _, sell := range res.Sells {
+		fmt.Fprintf(w, "* %s - SOLD %.2f items and got %.2f net on %s\n",
+			sell.Item, sell.Quantity, sell.NetTotal, sell.Time)
+		if sell.MissingQuantity > 0 {
+			fmt.Fprintf(w, "!!! WARN: Cannot find a purchase of %.2f items of %s sold on %s\n",
+				sell.MissingQuantity, sell.Item, sell.Time)
+		}
+		for _, lot := range sell.Lots {
+			exempt := ""
+			if lot.HoldingExempt {
+				exempt = " (exempt)"
+			}
+			fmt.Fprintf(w, "  bought %.2f items on %s (%s ago) for %.2f net%s\n",
+				lot.Quantity, lot.BuyTime, TimeDifference(lot.BuyTime, sell.Time), lot.Cost, exempt)
+		}
+		fmt.Fprintf(w, "  => gainLoss: %.2f %s \n\n", sell.GainLoss, sell.Currency)
+	}
+
+	// other cash transactions
+	for _, cash := range res.Cash {
+		fmt.Fprintf(w, "* %s - Cash/CapitalReturn/Fee - %s\n", cash.Item, cash.Reference)
+		fmt.Fprintf(w, "  revenues: %.2f %s\n", cash.Revenues, cash.Currency)
+		fmt.Fprintf(w, "  expenses: %.2f %s\n\n", cash.Expenses, cash.Currency)
+	}
+
+	// for each country..
+	for _, countryName := range res.CountryNames() {
+		pc := res.Countries[countryName]
+		fmt.Fprintf(w, "\nCOUNTRY %s\n", countryName)
+		// for each company from the country ...
+		for _, it := range pc.Items {
+			fmt.Fprintf(w, "  * COMPANY %s - %s - %s\n", it.Item.Code, it.Item.Name, it.Item.Address)
+			if len(it.CountrySource) > 0 {
+				fmt.Fprintf(w, "    * Country Source: %s\n", it.CountrySource)
+			}
+			fmt.Fprintf(w, "    * Dividend Income: %.2f %s\n", it.DividendIncomeInPrimaryCurrency, primary)
+			fmt.Fprintf(w, "    * Dividend Tax Paid (local currency): %.2f %s\n", it.DividendTaxPaid, it.Currency)
+			fmt.Fprintf(w, "    * Dividend Tax Paid (in primary): %.2f %s\n", it.DividendTaxPaidInPrimaryCurrency, primary)
+		}
+		fmt.Fprintf(w, "  * Total Dividend Tax Paid in %s: %.2f %s\n",
+			countryName, pc.TotalDividendTaxPaidInPrimaryCurrency, primary)
+		fmt.Fprintf(w, "  * Total Dividend Revenues in %s: %.2f %s\n",
+			countryName, pc.TotalDividendIncomeInPrimaryCurrency, primary)
+	}
+
+	// print exp/rev in primary currency
+	fmt.Fprintf(w, "\nTOTAL IN %s (excl. dividends):\n", primary)
+	fmt.Fprintf(w, "  * Expenses: %.2f %s\n", res.TotalExpensesInPrimaryCurrency, primary)
+	fmt.Fprintf(w, "  * Revenues: %.2f %s\n", res.TotalRevenuesInPrimaryCurrency, primary)
+
+	fmt.Fprintf(w, "\nTOTAL DIVIDEND INCOME IN %s: %.2f\n", primary, res.TotalDividendIncomeInPrimaryCurrency())
+
+	// print net total gain/loss in individual currencies
+	totalGainLossPrimary := 0.0
+	fmt.Fprintf(w, "\nTOTAL NET GAIN/LOSS IN ORIGINAL CURRENCIES (excl. dividends):\n")
+	for currency, total := range res.TotalGainLossByCurrency {
+		totalInPrimary, err := r.converter.Convert(total, currency, primary, time.Now())
+		if err != nil {
+			fmt.Fprintf(w, "  * %.2f %s\n", total, currency)
+		} else {
+			totalGainLossPrimary += totalInPrimary
+			fmt.Fprintf(w, "  * %.2f %s (= %.2f %s today)\n",
+				total, currency, totalInPrimary, primary)
+		}
+	}
+	fmt.Fprintf(w, "  => SUM IN %s TODAY: %.2f\n", primary, totalGainLossPrimary)
+
+	// print sells split to exempt and taxable parts
+	fmt.Fprintf(w, "\nSELLS IN TAX YEAR %d (%s tax rules):\n", res.TaxYear, res.TaxRules)
+	fmt.Fprintf(w, "  * Exempt revenues: %.2f %s\n", res.ExemptRevenuesInPrimaryCurrency, primary)
+	fmt.Fprintf(w, "  * Exempt expenses: %.2f %s\n", res.ExemptExpensesInPrimaryCurrency, primary)
+	fmt.Fprintf(w, "  * Taxable revenues: %.2f %s\n", res.TaxableRevenuesInPrimaryCurrency, primary)
+	fmt.Fprintf(w, "  * Taxable expenses: %.2f %s\n", res.TaxableExpensesInPrimaryCurrency, primary)
+	if res.AnnualLimitExemptionApplied {
+		fmt.Fprintf(w, "  (all sells are exempt as revenues didn't exceed the annual limit)\n")
+	}
+
+	// rates of other days applied for weekends and holidays
+	header := false
+	for _, rate := range res.Rates {
+		if len(rate.RateDate) == 0 || rate.RateDate == rate.Date {
+			continue
+		}
+		if !header {
+			fmt.Fprintf(w, "\nRATES OF OTHER DAYS APPLIED:\n")
+			header = true
+		}
+		fmt.Fprintf(w, "  * %s%s on %s: %.4f (rate of %s)\n", rate.From, rate.To, rate.Date, rate.Rate, rate.RateDate)
+	}
+
+	return nil
+}
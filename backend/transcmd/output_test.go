@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/importers"
+	"github.com/k3a/in2tracker/backend/store"
+	"github.com/stretchr/testify/require"
+)
+
+func processOutputTest(t *testing.T) *ProcessResult {
+	storePtr := store.NewTest()
+
+	sell := testTransaction(importers.TTSell, "2020-03-01", 10, 30)
+	sell.Currency = currency.USD
+	sell.FeeCurrency = currency.USD
+	buy := testTransaction(importers.TTBuy, "2019-06-01", 10, 20)
+	buy.Currency = currency.USD
+	buy.FeeCurrency = currency.USD
+	fee := testTransaction(importers.TTFee, "2020-05-01", 0, 0)
+	fee.NetTotal = -50
+	fee.Reference = "Account fee"
+
+	// cached rates, so no provider is asked (sunday uses the friday rate)
+	require.Nil(t, storePtr.StoreCurrencyRate(currency.RateDay(sell.Time), currency.USD, currency.CZK, 22,
+		time.Date(2020, 2, 28, 0, 0, 0, 0, time.UTC)))
+
+	proc := NewTransactionProcessor([]*importers.Transaction{buy, sell, fee}, storePtr,
+		currency.CZK, 2020, &CZTaxRules{})
+	res, err := proc.Process()
+	require.Nil(t, err)
+	return res
+}
+
+func TestProcessResultEntries(t *testing.T) {
+	res := processOutputTest(t)
+
+	require.Len(t, res.Sells, 1)
+	require.Len(t, res.Cash, 1)
+	require.InDelta(t, 50, res.Cash[0].ExpensesInPrimaryCurrency, 0.001)
+	require.Len(t, res.Rates, 1)
+	require.Equal(t, "2020-03-01", res.Rates[0].Date)
+	require.Equal(t, 22.0, res.Rates[0].Rate)
+	require.Equal(t, "2020-02-28", res.Rates[0].RateDate)
+	require.InDelta(t, 6600, res.Sells[0].RevenueInPrimaryCurrency, 0.001)
+}
+
+func TestJSONRenderer(t *testing.T) {
+	res := processOutputTest(t)
+
+	var buf bytes.Buffer
+	require.Nil(t, (&JSONRenderer{}).Render(&buf, res))
+
+	var decoded ProcessResult
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, 2020, decoded.TaxYear)
+	require.Len(t, decoded.Sells, 1)
+	require.Len(t, decoded.Sells[0].Lots, 1)
+	require.Equal(t, res.Sells[0].GainLoss, decoded.Sells[0].GainLoss)
+	require.Len(t, decoded.Rates, 1)
+}
+
+func TestCSVRenderer(t *testing.T) {
+	res := processOutputTest(t)
+
+	var buf bytes.Buffer
+	require.Nil(t, (&CSVRenderer{}).Render(&buf, res))
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.Nil(t, err)
+	require.Equal(t, csvHeader, records[0])
+
+	kinds := make(map[string]int)
+	for _, rec := range records[1:] {
+		require.Len(t, rec, len(csvHeader))
+		kinds[rec[0]]++
+		if rec[0] == "rate" {
+			require.Equal(t, "rate of 2020-02-28", rec[len(rec)-1])
+		}
+	}
+	require.Equal(t, map[string]int{"sell": 1, "lot": 1, "cash": 1, "rate": 1, "total": 3}, kinds)
+}
+
+func TestSingleDocumentOutput(t *testing.T) {
+	for _, name := range []string{"json", "CSV", "dap"} {
+		require.True(t, singleDocumentOutput(name), name)
+	}
+	for _, name := range []string{"text", "dap-summary"} {
+		require.False(t, singleDocumentOutput(name), name)
+	}
+}
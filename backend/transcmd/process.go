@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"math"
 	"sort"
 	"time"
 
@@ -12,12 +12,24 @@ import (
 	"github.com/k3a/in2tracker/backend/importers"
 	"github.com/k3a/in2tracker/backend/model"
 	"github.com/k3a/in2tracker/backend/store"
+	"github.com/lunny/log"
 )
 
 type processorTransaction struct {
-	Transaction   *importers.Transaction
-	RemainingBuys float64 // buy only: remaining purchased items to be used
-	BuyCost       float64 // sell only: amount it cost buy this sell in transaction currency
+	Transaction     *importers.Transaction
+	RemainingBuys   float64 // buy only: remaining purchased items to be used (adjusted for splits)
+	SplitMultiplier float64 // buy only: product of splits which happened after the buy
+	BuyCost         float64 // sell only: amount it cost buy this sell in transaction currency
+}
+
+// adjustedPrice returns buy price per item adjusted for splits
+func (pt *processorTransaction) adjustedPrice() float64 {
+	return pt.Transaction.Price / pt.SplitMultiplier
+}
+
+// adjustedQuantity returns bought quantity adjusted for splits
+func (pt *processorTransaction) adjustedQuantity() float64 {
+	return pt.Transaction.Quantity * pt.SplitMultiplier
 }
 
 type transactionWithAmount struct {
@@ -28,24 +40,56 @@ type transactionWithAmount struct {
 // TransactionProcessor is used to process transactions to prepare financial results.
 // PrimaryCurrency is the main currency to which we want to convert some
 // types of financtial amounts to (probably taxpayer's national currency).
+// TaxYear is the year results are computed for and TaxRules decide which
+// gains of the year are exempt.
 type TransactionProcessor struct {
-	store           *store.Store
-	currencyCache   *CurrencyCache
+	store *store.Store
+	// Converter converts amounts to the primary currency (daily rates by default)
+	Converter       Converter
 	Transactions    []*processorTransaction
 	PrimaryCurrency currency.Currency
+	TaxYear         int
+	TaxRules        TaxRules
+	// LotMatcher selects buys used by sells (FIFO by default)
+	LotMatcher LotMatcher
+	// RateMode describes the Converter rates (daily or uniform)
+	RateMode string
+	// Offline disables downloading company data (only stored items and profiles are used)
+	Offline bool
+	// Profiles provides company profiles of the items (refreshing stale ones)
+	Profiles *companydata.ProfileCache
+}
+
+// Converter converts amounts between currencies at the specified time
+type Converter interface {
+	Convert(amount float64, from currency.Currency, to currency.Currency, at time.Time) (float64, error)
+}
+
+// prefetcher is a Converter able to download rates of a date range in one shot
+// (e.g. currency.CachingConverter)
+type prefetcher interface {
+	Prefetch(from currency.Currency, to currency.Currency, start time.Time, end time.Time) error
+}
+
+// detailedConverter is a Converter reporting the effective rate dates (e.g. currency.CachingConverter)
+type detailedConverter interface {
+	ConvertDetailed(amount float64, from currency.Currency, to currency.Currency, at time.Time) (*currency.Conversion, error)
 }
 
 // NewTransactionProcessor creates a new transaction processor.
-// trs - transactions to process (can contain duplicates)
+// trs - transactions to process (can contain duplicates; identical transactions loaded
+// from the store have distinct stored hashes and are all kept)
 // storePtr - pointer to store to find/store country and currency data
 // primaryCurrency -the main currency to which we want to convert some
 // types of financtial amounts to (probably taxpayer's national currency).
-func NewTransactionProcessor(trs []*importers.Transaction, storePtr *store.Store, primaryCurrency currency.Currency) *TransactionProcessor {
+// taxYear - year to compute the results for (older transactions are used only to match sells with buys)
+// taxRules - rules deciding which gains are exempt from tax
+func NewTransactionProcessor(trs []*importers.Transaction, storePtr *store.Store,
+	primaryCurrency currency.Currency, taxYear int, taxRules TaxRules) *TransactionProcessor {
 	var trsToProcess []*processorTransaction
 	duplicates := make(map[string]bool)
 
-	now := time.Now()
-	firstDayThisYear := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+	firstDayNextYear := time.Date(taxYear+1, 1, 1, 0, 0, 0, 0, time.Local)
 
 	for _, t := range trs {
 		// prevent duplicates
@@ -54,8 +98,8 @@ func NewTransactionProcessor(trs []*importers.Transaction, storePtr *store.Store
 		}
 		duplicates[t.Hash()] = true
 
-		// only for previous year
-		if t.Time.Before(firstDayThisYear) {
+		// only up to the end of the tax year
+		if t.Time.Before(firstDayNextYear) {
 			trsToProcess = append(trsToProcess, &processorTransaction{Transaction: t})
 		}
 	}
@@ -67,44 +111,35 @@ func NewTransactionProcessor(trs []*importers.Transaction, storePtr *store.Store
 
 	return &TransactionProcessor{
 		storePtr,
-		NewCurrencyCache(storePtr),
+		currency.NewCachingConverter(storePtr, currency.DefaultCacheSize),
 		trsToProcess,
 		primaryCurrency,
+		taxYear,
+		taxRules,
+		&FIFOLotMatcher{},
+		"daily",
+		false,
+		companydata.NewProfileCache(storePtr, companydata.DefaultProfileMaxAge),
 	}
 }
 
-// findOldestAvailableBuys finds oldest buy-type transactions containing needAmount
-// amount of items. Argument notAfter specifies the latest time at which
+// findAvailableBuys finds buy-type transactions of the item with remaining
+// items to be used, from the oldest. Argument notAfter specifies the latest time at which
 // the buy transaction could have happened.
-// Returns list of transactions with amount and remaining quantity which couldn't be found.
-func (tp *TransactionProcessor) findOldestAvailableBuys(item string, neededAmount float64, notAfter time.Time) (trs []*transactionWithAmount, missingQuantity float64) {
-	if len(tp.Transactions) == 0 {
-		return nil, neededAmount
-	}
-
+func (tp *TransactionProcessor) findAvailableBuys(item string, notAfter time.Time) (trs []*processorTransaction) {
 	// from the oldest.. (thus revere)
 	for it := len(tp.Transactions) - 1; it >= 0; it-- {
-		if neededAmount <= 0 {
-			break // done
-		}
 		t := tp.Transactions[it]
 
 		if t.Transaction.Item == item && t.RemainingBuys > 0 {
 			if t.Transaction.Time.After(notAfter) {
 				continue // happened after
 			}
-
-			takenBuys := math.Min(t.RemainingBuys, neededAmount)
-			neededAmount -= takenBuys
-
-			trs = append(trs, &transactionWithAmount{
-				Transaction: t,
-				Amount:      takenBuys,
-			})
+			trs = append(trs, t)
 		}
 	}
 
-	return trs, neededAmount
+	return trs
 }
 
 // findCurrencyForItem finds item currency from historical transactions
@@ -144,22 +179,101 @@ func (tp *TransactionProcessor) fixMissingCurrencies() {
 	}
 }
 
-// processSell processes the sell-type transaction
+// convert converts the amount between currencies and records the rate used to the result
+func (tp *TransactionProcessor) convert(processRes *ProcessResult, amount float64,
+	from currency.Currency, to currency.Currency, at time.Time) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	// record the effective rate date if known
+	if dc, ok := tp.Converter.(detailedConverter); ok {
+		conv, err := dc.ConvertDetailed(1.0, from, to, at)
+		if err != nil {
+			return 0, err
+		}
+		processRes.addRate(from, to, at, conv.Rate, conv.RateDate)
+		return amount * conv.Rate, nil
+	}
+
+	rate, err := tp.Converter.Convert(1.0, from, to, at)
+	if err != nil {
+		return 0, err
+	}
+	processRes.addRate(from, to, at, rate, time.Time{})
+
+	return amount * rate, nil
+}
+
+// isCurrencyConversion returns true for purchases and sales of currencies
+// (e.g. IBKR cash trades and Degiro autoFX), which have no buy lots to match
+func isCurrencyConversion(tr *importers.Transaction) bool {
+	return currency.FromString(tr.Item).Known()
+}
+
+// consumeBuys finds the buys for the sell transaction using the lot matcher
+// and removes the used number of items from them.
+// Returns the buys with amounts and quantity for which no buy has been found.
+func (tp *TransactionProcessor) consumeBuys(sell *processorTransaction) (buys []*transactionWithAmount, missingQuantity float64) {
+	sellTr := sell.Transaction
+	if isCurrencyConversion(sellTr) {
+		return nil, 0
+	}
+
+	available := tp.findAvailableBuys(sellTr.Item, sellTr.Time)
+
+	missingQuantity = sellTr.Quantity
+	for _, buy := range tp.LotMatcher.MatchLots(sell, available, sellTr.Quantity) {
+		if buy.Amount <= 0 {
+			continue
+		}
+		buy.Transaction.RemainingBuys -= buy.Amount
+		missingQuantity -= buy.Amount
+		buys = append(buys, buy)
+	}
+
+	// ignore floating point errors of proportional matching
+	if missingQuantity < 1e-9 {
+		missingQuantity = 0
+	}
+	return buys, missingQuantity
+}
+
+// applySplit multiplies remaining items of the open buys of the split item
+// and keeps their total cost by adjusting the price per item.
+// Reverse splits have multiplier lower than one; fractional items remaining
+// after them are expected to be sold by a TTCashInLieu transaction.
+func (tp *TransactionProcessor) applySplit(splitTr *importers.Transaction) error {
+	if splitTr.Quantity <= 0 {
+		return fmt.Errorf("process: invalid split multiplier %f for %s", splitTr.Quantity, splitTr.Item)
+	}
+
+	for _, buy := range tp.findAvailableBuys(splitTr.Item, splitTr.Time) {
+		buy.RemainingBuys *= splitTr.Quantity
+		buy.SplitMultiplier *= splitTr.Quantity
+	}
+	return nil
+}
+
+// processSell processes the sell-type transaction (incl. cash paid in lieu of fractional items)
 func (tp *TransactionProcessor) processSell(processRes *ProcessResult, ptr *processorTransaction) error {
 	sellTr := ptr.Transaction
+	if isCurrencyConversion(sellTr) {
+		return nil // not a sale of an item
+	}
 
 	// sell gain in primary currency
-	sellFee, err := tp.currencyCache.Convert(
+	sellFee, err := tp.convert(processRes,
 		sellTr.Fee, sellTr.FeeCurrency, sellTr.Currency, sellTr.Time)
 	if err != nil {
 		return err
 	}
-	sellFeePrimary, err := tp.currencyCache.Convert(
+	sellFeePrimary, err := tp.convert(processRes,
 		sellTr.Fee, sellTr.FeeCurrency, processRes.PrimaryCurrency, sellTr.Time)
 	if err != nil {
 		return err
 	}
-	sellRevenueInPrimary, err := tp.currencyCache.Convert(
+	sellRevenueInPrimary, err := tp.convert(processRes,
 		sellTr.NetTotal+sellFee, sellTr.Currency, processRes.PrimaryCurrency, sellTr.Time)
 	if err != nil {
 		return err
@@ -169,58 +283,151 @@ func (tp *TransactionProcessor) processSell(processRes *ProcessResult, ptr *proc
 	processRes.TotalRevenuesInPrimaryCurrency += sellRevenueInPrimary
 	processRes.TotalExpensesInPrimaryCurrency += sellFeePrimary
 
-	// print
-	fmt.Printf("* %s - SOLD %.2f items and got %.2f net on %s\n",
-		sellTr.Item, sellTr.Quantity, sellTr.NetTotal, sellTr.Time)
+	sell := &ProcessSell{
+		Item:                     sellTr.Item,
+		Time:                     sellTr.Time,
+		Quantity:                 sellTr.Quantity,
+		NetTotal:                 sellTr.NetTotal,
+		Currency:                 sellTr.Currency,
+		RevenueInPrimaryCurrency: sellRevenueInPrimary,
+	}
 
 	// find relevant buys
-	buys, remain := tp.findOldestAvailableBuys(sellTr.Item, sellTr.Quantity, sellTr.Time)
-	if remain > 0 {
-		fmt.Printf("!!! WARN: Cannot find a purchase of %.2f items of %s sold on %s\n",
-			remain, ptr.Transaction.Item, ptr.Transaction.Time)
-	}
+	buys, remain := tp.consumeBuys(ptr)
+	sell.MissingQuantity = remain
 
 	// sum buy cost from buys
 	buyExpenses := 0.0
 	for _, buy := range buys {
 		buyTr := buy.Transaction.Transaction
 
-		// item cost
-		buyExpenses += buy.Amount * buyTr.Price
+		// item cost (amount and price are adjusted for splits, so the total cost is kept)
+		lotExpenses := buy.Amount * buy.Transaction.adjustedPrice()
 
 		// cost fee fraction converted to transaction currency
-		fee, err := tp.currencyCache.Convert(buyTr.Fee/buyTr.Quantity*buy.Amount,
+		fee, err := tp.convert(processRes, buyTr.Fee/buy.Transaction.adjustedQuantity()*buy.Amount,
 			buyTr.FeeCurrency, buyTr.Currency, buyTr.Time)
 		if err != nil {
 			return err
 		}
-		buyExpenses += fee
-
-		// remove used number of items bought
-		buy.Transaction.RemainingBuys -= buy.Amount
+		lotExpenses += fee
+		buyExpenses += lotExpenses
 
-		fmt.Printf("  bought %.2f items on %s (%s ago) for %.2f net\n",
-			buy.Amount, buyTr.Time, TimeDifference(buyTr.Time, sellTr.Time), buyExpenses)
+		// lot revenues and expenses (incl. proportional part of the sell fee) in primary
+		lotExpensesInPrimary, err := tp.convert(processRes,
+			lotExpenses, sellTr.Currency, processRes.PrimaryCurrency, sellTr.Time)
+		if err != nil {
+			return err
+		}
+		lotShare := buy.Amount / sellTr.Quantity
+
+		lot := &ProcessLot{
+			BuyTime:                   buyTr.Time,
+			Quantity:                  buy.Amount,
+			BuyPrice:                  buy.Transaction.adjustedPrice(),
+			Cost:                      lotExpenses,
+			RevenueInPrimaryCurrency:  sellRevenueInPrimary * lotShare,
+			ExpensesInPrimaryCurrency: lotExpensesInPrimary + sellFeePrimary*lotShare,
+			HoldingExempt:             tp.TaxRules.IsHoldingExempt(buyTr.Time, sellTr.Time),
+		}
+		sell.Lots = append(sell.Lots, lot)
+		processRes.addSellLot(lot.HoldingExempt, lot.RevenueInPrimaryCurrency, lot.ExpensesInPrimaryCurrency)
 	}
 	ptr.BuyCost = buyExpenses
 
+	// items without a known purchase are taxable with no cost
+	if remain > 0 && sellTr.Quantity > 0 {
+		lotShare := remain / sellTr.Quantity
+		processRes.addSellLot(false, sellRevenueInPrimary*lotShare, sellFeePrimary*lotShare)
+	}
+
 	// buy expenses in primary
-	buyExpensesInPrimary, err := tp.currencyCache.Convert(
+	buyExpensesInPrimary, err := tp.convert(processRes,
 		ptr.BuyCost, sellTr.Currency, processRes.PrimaryCurrency, sellTr.Time)
 	if err != nil {
 		return err
 	}
 	processRes.TotalExpensesInPrimaryCurrency += buyExpensesInPrimary
 
-	thisGainLoss := sellTr.NetTotal - ptr.BuyCost
-	fmt.Printf("  => gainLoss: %.2f %s \n\n", thisGainLoss, sellTr.Currency)
+	sell.Cost = ptr.BuyCost
+	sell.GainLoss = sellTr.NetTotal - ptr.BuyCost
+	sell.ExpensesInPrimaryCurrency = buyExpensesInPrimary + sellFeePrimary
+	processRes.Sells = append(processRes.Sells, sell)
 
 	// add to total net gain/loss for the currency
-	processRes.TotalGainLossByCurrency[sellTr.Currency] += thisGainLoss
+	processRes.TotalGainLossByCurrency[sellTr.Currency] += sell.GainLoss
 
 	return nil
 }
 
+// itemCountrySource is the country source of items having the country stored
+// without the company profile it comes from
+const itemCountrySource = "stored item"
+
+// unknownCountry groups dividends of items known just by ISIN without a stored country
+var unknownCountry = &model.Country{Name: "unknown"}
+
+// isISINOnly returns true for transactions of items known just by ISIN (e.g. from Degiro)
+// which are not linked to a ticker, company data providers can't look them up
+func isISINOnly(tr *importers.Transaction) bool {
+	return len(tr.ISIN) > 0 && tr.Item == tr.ISIN
+}
+
+// profile returns the company profile of the item, fetching missing and stale ones
+// unless offline
+func (tp *TransactionProcessor) profile(code string) (*model.CompanyProfile, error) {
+	if tp.Offline {
+		profile, err := tp.Profiles.Stored(code)
+		if err != nil {
+			return nil, fmt.Errorf("company data for %s not stored and cannot be fetched offline", code)
+		}
+		return profile, nil
+	}
+
+	profile, err := tp.Profiles.Get(context.Background(), nil, code)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get company data for %s: %s", code, err)
+	}
+	return profile, nil
+}
+
+// updateItemProfile creates the item or updates it by the company profile if changed
+func (tp *TransactionProcessor) updateItemProfile(item *model.Item, tr *importers.Transaction,
+	country *model.Country, profile *model.CompanyProfile) (*model.Item, error) {
+	if item == nil {
+		item = &model.Item{
+			MarketID: 0, // TODO: market ID
+			Code:     tr.Item,
+			ISIN:     tr.ISIN,
+		}
+	}
+
+	updated := *item
+	updated.CountryID = country.ID
+	if len(profile.Name) > 0 {
+		updated.Name = profile.Name
+	}
+	updated.Address = profile.GetAddress().String()
+	if updated.CurrencyID == 0 {
+		currency, err := tp.store.GetOrCreateCurrency(tr.Currency)
+		if err != nil {
+			return nil, err
+		}
+		updated.CurrencyID = currency.ID
+	}
+
+	var err error
+	if item.ID == 0 {
+		err = tp.store.CreateItem(&updated)
+	} else if updated != *item {
+		err = tp.store.UpdateItem(&updated)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
 // processDividend processes the dividend-type transaction
 // (transactions with positive net total being income and negative being taxes)
 func (tp *TransactionProcessor) processDividend(processRes *ProcessResult, ptr *processorTransaction) error {
@@ -233,59 +440,75 @@ func (tp *TransactionProcessor) processDividend(processRes *ProcessResult, ptr *
 
 		// item and country info
 		var country *model.Country
-		item, err := tp.store.GetItemByCode(tr.Item)
-		if err == nil {
-			// get country
-			country, err = tp.store.GetCountry(item.CountryID)
+		var countrySource string
+		item, err := tp.store.FindItem(tr.Identifiers())
+		if err == sql.ErrNoRows {
+			item = nil
+		} else if err != nil {
+			return err
+		}
+
+		// the company profile is checked for every item, so stale ones are refreshed
+		var profile *model.CompanyProfile
+		var profileErr error
+		if isISINOnly(tr) {
+			profileErr = fmt.Errorf("company data for %s can't be fetched by ISIN, link it to its ticker by --isin TICKER=ISIN", tr.Item)
+		} else {
+			profile, profileErr = tp.profile(tr.Item)
+		}
+
+		if profileErr == nil && len(profile.Country) > 0 {
+			countrySource = profile.Sources[string(companydata.FieldCountry)]
+			country, err = tp.store.GetOrCreateCountry(profile.Country)
 			if err != nil {
 				return err
 			}
-		} else if err == sql.ErrNoRows {
-			// try fetch company data
-			companyData, err := companydata.GetCompanyData(nil, tr.Item)
-			if err != nil {
-				return fmt.Errorf("unable to get company data for %s: %s", tr.Item, err)
-			}
 
-			// country
-			country, err = tp.store.GetOrCreateCountry(companyData.GetAddress().Country)
+			item, err = tp.updateItemProfile(item, tr, country, profile)
 			if err != nil {
 				return err
 			}
-
-			// currency
-			currency, err := tp.store.GetOrCreateCurrency(tr.Currency)
+		} else if item != nil && item.CountryID != 0 {
+			// the country stored with the item if the profile is not available
+			country, err = tp.store.GetCountry(item.CountryID)
 			if err != nil {
 				return err
 			}
-
-			// create item info
-			item = &model.Item{
-				MarketID:   0, // TODO: market ID
-				CountryID:  country.ID,
-				CurrencyID: currency.ID,
-				Code:       tr.Item,
-				Name:       companyData.GetLongName(),
-				Address:    companyData.GetAddress().String(),
-			}
-			if err := tp.store.CreateItem(item); err != nil {
-				return err
+			countrySource = itemCountrySource
+		} else if isISINOnly(tr) {
+			// reported under the unknown country instead of failing the whole run
+			log.Warnf("transcmd: %s, its dividends are reported under the %s country", profileErr, unknownCountry.Name)
+			country = unknownCountry
+			if item == nil {
+				item = &model.Item{Code: tr.Item, ISIN: tr.ISIN}
 			}
-		} else if err != nil {
-			return err
+		} else if profileErr != nil {
+			return profileErr
+		} else {
+			return fmt.Errorf("country of %s not known by any company data provider", tr.Item)
 		}
 
 		processItem = processRes.AddItem(item, country)
+		processItem.CountrySource = countrySource
 	}
 
 	processItem.Currency = tr.Currency
 
+	dividend := &ProcessDividend{
+		Item:     tr.Item,
+		Country:  processItem.Country.Name,
+		Time:     tr.Time,
+		NetTotal: tr.NetTotal,
+		Currency: tr.Currency,
+	}
+
 	if tr.NetTotal >= 0 {
 		// dividend revenue in primary
-		revenueInPrimary, err := tp.currencyCache.Convert(tr.NetTotal, tr.Currency, tp.PrimaryCurrency, tr.Time)
+		revenueInPrimary, err := tp.convert(processRes, tr.NetTotal, tr.Currency, tp.PrimaryCurrency, tr.Time)
 		if err != nil {
 			return err
 		}
+		dividend.NetTotalInPrimaryCurrency = revenueInPrimary
 
 		// item totals
 		processItem.DividendIncomeInPrimaryCurrency += revenueInPrimary
@@ -297,10 +520,11 @@ func (tp *TransactionProcessor) processDividend(processRes *ProcessResult, ptr *
 		taxPaid := -tr.NetTotal
 
 		// tax paid in primary
-		taxPaidInPrimary, err := tp.currencyCache.Convert(taxPaid, tr.Currency, tp.PrimaryCurrency, tr.Time)
+		taxPaidInPrimary, err := tp.convert(processRes, taxPaid, tr.Currency, tp.PrimaryCurrency, tr.Time)
 		if err != nil {
 			return err
 		}
+		dividend.NetTotalInPrimaryCurrency = -taxPaidInPrimary
 
 		// item totals
 		processItem.DividendTaxPaid += taxPaid
@@ -310,10 +534,12 @@ func (tp *TransactionProcessor) processDividend(processRes *ProcessResult, ptr *
 		processRes.Countries[processItem.Country.Name].TotalDividendTaxPaidInPrimaryCurrency += taxPaidInPrimary
 	}
 
+	processRes.Dividends = append(processRes.Dividends, dividend)
+
 	return nil
 }
 
-// processCashAndCapital processes capital returns, merger cash (positive) and fees (negative)
+// processCashAndCapital processes capital returns, merger cash, interest (positive) and fees (negative)
 func (tp *TransactionProcessor) processCashAndCapital(processRes *ProcessResult, ptr *processorTransaction) error {
 	tr := ptr.Transaction
 
@@ -326,19 +552,27 @@ func (tp *TransactionProcessor) processCashAndCapital(processRes *ProcessResult,
 		expenses += -tr.NetTotal
 	}
 
-	expensesInPrimary, err := tp.currencyCache.Convert(expenses, tr.Currency, tp.PrimaryCurrency, tr.Time)
+	expensesInPrimary, err := tp.convert(processRes, expenses, tr.Currency, tp.PrimaryCurrency, tr.Time)
 	if err != nil {
 		return err
 	}
 
-	revenuesInPrimary, err := tp.currencyCache.Convert(revenues, tr.Currency, tp.PrimaryCurrency, tr.Time)
+	revenuesInPrimary, err := tp.convert(processRes, revenues, tr.Currency, tp.PrimaryCurrency, tr.Time)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("* %s - Cash/CapitalReturn/Fee - %s\n", tr.Item, tr.Reference)
-	fmt.Printf("  revenues: %.2f %s\n", revenues, tr.Currency)
-	fmt.Printf("  expenses: %.2f %s\n\n", expenses, tr.Currency)
+	processRes.Cash = append(processRes.Cash, &ProcessCash{
+		Item:                      tr.Item,
+		Type:                      tr.Type.String(),
+		Time:                      tr.Time,
+		Reference:                 tr.Reference,
+		Revenues:                  revenues,
+		Expenses:                  expenses,
+		Currency:                  tr.Currency,
+		RevenuesInPrimaryCurrency: revenuesInPrimary,
+		ExpensesInPrimaryCurrency: expensesInPrimary,
+	})
 
 	// add to totals
 	processRes.TotalExpensesInPrimaryCurrency += expensesInPrimary
@@ -348,40 +582,90 @@ func (tp *TransactionProcessor) processCashAndCapital(processRes *ProcessResult,
 	return nil
 }
 
+// prefetchRates downloads the rates to the primary currency for every year
+// and currency of the transactions in one shot if the converter supports it.
+// Failures are ignored as the rates are downloaded per day then.
+func (tp *TransactionProcessor) prefetchRates() {
+	pf, ok := tp.Converter.(prefetcher)
+	if !ok {
+		return
+	}
+
+	years := make(map[currency.Currency]map[int]bool)
+	add := func(cur currency.Currency, year int) {
+		if cur == currency.Invalid || cur == tp.PrimaryCurrency {
+			return
+		}
+		if years[cur] == nil {
+			years[cur] = make(map[int]bool)
+		}
+		years[cur][year] = true
+	}
+	for _, ptr := range tp.Transactions {
+		tr := ptr.Transaction
+		add(tr.Currency, tr.Time.Year())
+		add(tr.FeeCurrency, tr.Time.Year())
+	}
+
+	for cur, curYears := range years {
+		for year := range curYears {
+			start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+			pf.Prefetch(cur, tp.PrimaryCurrency, start, start.AddDate(1, 0, -1))
+		}
+	}
+}
+
 // Process processes sells to find gain and loss
 func (tp *TransactionProcessor) Process() (*ProcessResult, error) {
 	tp.fixMissingCurrencies()
+	tp.prefetchRates()
 
 	// set initial numbers
 	for _, ptr := range tp.Transactions {
 		if ptr.Transaction.Type == importers.TTBuy {
 			ptr.RemainingBuys = ptr.Transaction.Quantity
+			ptr.SplitMultiplier = 1
 		}
 	}
 
 	// result obj
 	processRes := NewProcessResult(tp.PrimaryCurrency)
+	processRes.TaxYear = tp.TaxYear
+	processRes.TaxRules = tp.TaxRules.Name()
+	processRes.LotMatcher = tp.LotMatcher.Name()
+	processRes.RateMode = tp.RateMode
 
-	now := time.Now()
-	firstDayOfPreviousYear := time.Date(now.Year()-1, 1, 1, 0, 0, 0, 0, now.Location())
+	firstDayOfTaxYear := time.Date(tp.TaxYear, 1, 1, 0, 0, 0, 0, time.Local)
 
 	// for each sell (from the oldest; thus reverse)
 	for it := len(tp.Transactions) - 1; it >= 0; it-- {
 		ptr := tp.Transactions[it]
 
-		// skip transactions which are too old
-		if ptr.Transaction.Time.Before(firstDayOfPreviousYear) {
+		// splits change the items held regardless of the year
+		if ptr.Transaction.Type == importers.TTSplitMultiplier {
+			if err := tp.applySplit(ptr.Transaction); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// transactions before the tax year are not reported
+		// but their sells must use up the bought items
+		if ptr.Transaction.Time.Before(firstDayOfTaxYear) {
+			if ptr.Transaction.Type == importers.TTSell || ptr.Transaction.Type == importers.TTCashInLieu {
+				tp.consumeBuys(ptr)
+			}
 			continue
 		}
 
 		var err error
 
 		switch ptr.Transaction.Type {
-		case importers.TTSell:
+		case importers.TTSell, importers.TTCashInLieu:
 			err = tp.processSell(processRes, ptr)
 		case importers.TTDividend:
 			err = tp.processDividend(processRes, ptr)
-		case importers.TTMergerCash, importers.TTFee, importers.TTReturnOfCapital:
+		case importers.TTMergerCash, importers.TTFee, importers.TTReturnOfCapital, importers.TTInterest:
 			err = tp.processCashAndCapital(processRes, ptr)
 		case importers.TTBuy, importers.TTDeposit, importers.TTWithdrawal:
 			break // do nothing with these
@@ -395,15 +679,27 @@ func (tp *TransactionProcessor) Process() (*ProcessResult, error) {
 		}
 	}
 
+	// all the sells are exempt if their revenues don't exceed the annual limit
+	limit := tp.TaxRules.AnnualExemptionLimit()
+	if limit > 0 && processRes.TaxableRevenuesInPrimaryCurrency <= limit {
+		processRes.AnnualLimitExemptionApplied = true
+		processRes.ExemptRevenuesInPrimaryCurrency += processRes.TaxableRevenuesInPrimaryCurrency
+		processRes.ExemptExpensesInPrimaryCurrency += processRes.TaxableExpensesInPrimaryCurrency
+		processRes.TaxableRevenuesInPrimaryCurrency = 0
+		processRes.TaxableExpensesInPrimaryCurrency = 0
+	}
+
+	processRes.sortRates()
+
 	return processRes, nil
 }
 
-// PrintTransactions prints all transactions
+// PrintTransactions prints all transactions with their hash prefix usable in lot specifications
 // (from the most recent, without diplicates)
 func (tp *TransactionProcessor) PrintTransactions() error {
 	for _, ptr := range tp.Transactions {
 		t := ptr.Transaction
-		fmt.Printf("%s\n", t.String())
+		fmt.Printf("%s %s\n", t.Hash()[:10], t.String())
 	}
 	return nil
 }
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/k3a/in2tracker/backend/companydata"
+	"github.com/k3a/in2tracker/backend/currency"
+	"github.com/k3a/in2tracker/backend/importers"
+	"github.com/k3a/in2tracker/backend/marketdata"
+	"github.com/k3a/in2tracker/backend/model"
+	"github.com/k3a/in2tracker/backend/store"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs the tests offline, rates are stored by the tests
+func TestMain(m *testing.M) {
+	if err := setupRateProviders(nil, true); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func testTransaction(typ importers.TransactionType, date string, quantity, price float64) *importers.Transaction {
+	t, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		panic(err)
+	}
+
+	netTotal := quantity * price
+	if typ == importers.TTBuy {
+		netTotal = -netTotal
+	}
+
+	return &importers.Transaction{
+		Time:        t,
+		Type:        typ,
+		Item:        "CEZ",
+		Quantity:    quantity,
+		Price:       price,
+		NetTotal:    netTotal,
+		Currency:    currency.CZK,
+		FeeCurrency: currency.CZK,
+	}
+}
+
+func TestProcessTaxYear(t *testing.T) {
+	trs := []*importers.Transaction{
+		testTransaction(importers.TTBuy, "2015-01-10", 10, 100),
+		testTransaction(importers.TTSell, "2018-05-01", 5, 300),
+		testTransaction(importers.TTBuy, "2019-06-01", 10, 200),
+		testTransaction(importers.TTSell, "2020-03-01", 10, 30000),
+		testTransaction(importers.TTSell, "2021-03-01", 5, 50000),
+	}
+
+	proc := NewTransactionProcessor(trs, store.NewTest(), currency.CZK, 2020, &CZTaxRules{})
+	require.Len(t, proc.Transactions, 4)
+
+	res, err := proc.Process()
+	require.Nil(t, err)
+	require.Equal(t, 2020, res.TaxYear)
+	require.Equal(t, "cz", res.TaxRules)
+
+	// the sell of 2018 used 5 items from the first buy,
+	// remaining 5 are older than 3 years, the other 5 are taxable
+	require.InDelta(t, 150000, res.ExemptRevenuesInPrimaryCurrency, 0.001)
+	require.InDelta(t, 500, res.ExemptExpensesInPrimaryCurrency, 0.001)
+	require.InDelta(t, 150000, res.TaxableRevenuesInPrimaryCurrency, 0.001)
+	require.InDelta(t, 1000, res.TaxableExpensesInPrimaryCurrency, 0.001)
+	require.False(t, res.AnnualLimitExemptionApplied)
+}
+
+func TestProcessAnnualLimit(t *testing.T) {
+	trs := []*importers.Transaction{
+		testTransaction(importers.TTBuy, "2019-06-01", 10, 200),
+		testTransaction(importers.TTSell, "2020-03-01", 10, 9000),
+	}
+
+	res, err := NewTransactionProcessor(trs, store.NewTest(), currency.CZK, 2020, &CZTaxRules{}).Process()
+	require.Nil(t, err)
+	require.True(t, res.AnnualLimitExemptionApplied)
+	require.InDelta(t, 90000, res.ExemptRevenuesInPrimaryCurrency, 0.001)
+	require.Zero(t, res.TaxableRevenuesInPrimaryCurrency)
+
+	res, err = NewTransactionProcessor(trs, store.NewTest(), currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+	require.False(t, res.AnnualLimitExemptionApplied)
+	require.InDelta(t, 90000, res.TaxableRevenuesInPrimaryCurrency, 0.001)
+}
+
+func TestCZTaxRulesHoldingPeriod(t *testing.T) {
+	rules := &CZTaxRules{}
+	buy := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.False(t, rules.IsHoldingExempt(buy, buy.AddDate(3, 0, 0)))
+	require.True(t, rules.IsHoldingExempt(buy, buy.AddDate(3, 0, 1)))
+	require.False(t, rules.IsHoldingExempt(buy, buy.AddDate(1, 0, 0)))
+
+	// calendar days matter, not the time of day or the time zone
+	prague, err := time.LoadLocation("Europe/Prague")
+	require.Nil(t, err)
+	buy = time.Date(2017, 3, 1, 9, 0, 0, 0, prague)
+	require.False(t, rules.IsHoldingExempt(buy, time.Date(2020, 3, 1, 23, 59, 0, 0, prague)))
+	require.True(t, rules.IsHoldingExempt(buy, time.Date(2020, 3, 2, 0, 1, 0, 0, prague)))
+	// 2 Mar 00:30 in Prague is still 1 Mar in UTC
+	require.True(t, rules.IsHoldingExempt(buy, time.Date(2020, 3, 1, 23, 30, 0, 0, time.UTC)))
+	require.False(t, rules.IsHoldingExempt(time.Date(2017, 3, 1, 16, 0, 0, 0, time.UTC),
+		time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC)))
+
+	// the anniversary of 29 Feb is the last day of February
+	buy = time.Date(2016, 2, 29, 10, 0, 0, 0, prague)
+	require.False(t, rules.IsHoldingExempt(buy, time.Date(2019, 2, 28, 15, 0, 0, 0, prague)))
+	require.True(t, rules.IsHoldingExempt(buy, time.Date(2019, 3, 1, 9, 0, 0, 0, prague)))
+}
+
+func TestProcessSplits(t *testing.T) {
+	split := testTransaction(importers.TTSplitMultiplier, "2020-08-31", 4, 0)
+	split.NetTotal = 0
+
+	trs := []*importers.Transaction{
+		testTransaction(importers.TTBuy, "2019-06-01", 10, 400),
+		split,
+		testTransaction(importers.TTBuy, "2020-09-10", 10, 90),
+		testTransaction(importers.TTSell, "2020-10-01", 45, 120),
+	}
+
+	res, err := NewTransactionProcessor(trs, store.NewTest(), currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+	require.Len(t, res.Sells, 1)
+
+	// 40 pre-split items for the original cost, 5 bought after the split
+	sell := res.Sells[0]
+	require.Zero(t, sell.MissingQuantity)
+	require.Len(t, sell.Lots, 2)
+	require.InDelta(t, 40, sell.Lots[0].Quantity, 0.001)
+	require.InDelta(t, 100, sell.Lots[0].BuyPrice, 0.001)
+	require.InDelta(t, 4000, sell.Lots[0].Cost, 0.001)
+	require.InDelta(t, 5, sell.Lots[1].Quantity, 0.001)
+	require.InDelta(t, 4450, sell.Cost, 0.001)
+}
+
+func TestProcessReverseSplitCashInLieu(t *testing.T) {
+	split := testTransaction(importers.TTSplitMultiplier, "2020-08-31", 0.1, 0)
+	split.NetTotal = 0
+
+	trs := []*importers.Transaction{
+		testTransaction(importers.TTBuy, "2019-06-01", 25, 10),
+		split,
+		testTransaction(importers.TTCashInLieu, "2020-09-02", 0.5, 120),
+		testTransaction(importers.TTSell, "2020-10-01", 2, 150),
+	}
+
+	res, err := NewTransactionProcessor(trs, store.NewTest(), currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+	require.Len(t, res.Sells, 2)
+
+	// 25 items became 2.5, the half is paid in cash
+	cash := res.Sells[0]
+	require.Zero(t, cash.MissingQuantity)
+	require.InDelta(t, 0.5, cash.Lots[0].Quantity, 0.001)
+	require.InDelta(t, 100, cash.Lots[0].BuyPrice, 0.001)
+	require.InDelta(t, 10, cash.GainLoss, 0.001)
+
+	sell := res.Sells[1]
+	require.Zero(t, sell.MissingQuantity)
+	require.InDelta(t, 200, sell.Cost, 0.001)
+}
+
+func TestProcessUniformRates(t *testing.T) {
+	buy := testTransaction(importers.TTBuy, "2019-06-01", 10, 20)
+	sell := testTransaction(importers.TTSell, "2020-03-01", 10, 30)
+	for _, tr := range []*importers.Transaction{buy, sell} {
+		tr.Currency = currency.USD
+		tr.FeeCurrency = currency.USD
+	}
+
+	uniform := currency.NewUniformRates(nil)
+	uniform.Set(&currency.UniformRate{Year: 2020, From: currency.USD, To: currency.CZK, Rate: 23})
+
+	proc := NewTransactionProcessor([]*importers.Transaction{buy, sell}, store.NewTest(),
+		currency.CZK, 2020, &NoTaxRules{})
+	proc.Converter = uniform
+	proc.RateMode = "uniform"
+
+	res, err := proc.Process()
+	require.Nil(t, err)
+	require.Equal(t, "uniform", res.RateMode)
+	require.InDelta(t, 300*23, res.TaxableRevenuesInPrimaryCurrency, 0.001)
+	require.InDelta(t, 200*23, res.TaxableExpensesInPrimaryCurrency, 0.001)
+}
+
+func TestSetupRateProviders(t *testing.T) {
+	orig := currency.Providers
+	defer func() { currency.Providers = orig }()
+
+	currency.Providers = []currency.Provider{currency.NewCZCNB()}
+	require.Nil(t, setupRateProviders([]string{"../currency/provider.file_test_denni_kurz.txt"}, false))
+	require.Len(t, currency.Providers, 2)
+	require.Equal(t, "file", currency.Providers[0].Name())
+
+	require.Nil(t, setupRateProviders([]string{"../currency/provider.file_test_denni_kurz.txt"}, true))
+	require.Len(t, currency.Providers, 1)
+
+	require.NotNil(t, setupRateProviders([]string{"missing.csv"}, true))
+}
+
+func TestProcessOffline(t *testing.T) {
+	div := testTransaction(importers.TTDividend, "2020-05-01", 0, 0)
+	div.NetTotal = 100
+
+	proc := NewTransactionProcessor([]*importers.Transaction{div}, store.NewTest(), currency.CZK, 2020, &NoTaxRules{})
+	proc.Offline = true
+	_, err := proc.Process()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "offline")
+}
+
+// testCompanyProvider returns fixed company data
+type testCompanyProvider struct {
+	name string
+	data *companydata.MergedData
+}
+
+func (p *testCompanyProvider) Name() string { return p.name }
+
+func (p *testCompanyProvider) GetCompanyData(mkt *marketdata.Market, ticker string) (companydata.CompanyData, error) {
+	return p.data, nil
+}
+
+func TestProcessDividendCountrySource(t *testing.T) {
+	orig := companydata.Providers
+	defer func() { companydata.Providers = orig }()
+
+	companydata.Providers = []companydata.Provider{
+		&testCompanyProvider{"names", &companydata.MergedData{LongName: "CEZ a.s."}},
+		&testCompanyProvider{"countries", &companydata.MergedData{Address: model.Address{Country: "Czech Republic"}}},
+	}
+
+	div := testTransaction(importers.TTDividend, "2020-05-01", 0, 0)
+	div.NetTotal = 100
+
+	s := store.NewTest()
+	res, err := NewTransactionProcessor([]*importers.Transaction{div}, s, currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+
+	item := res.GetItem("CEZ")
+	require.NotNil(t, item)
+	require.Equal(t, "CEZ a.s.", item.Item.Name)
+	require.Equal(t, "Czech Republic", item.Country.Name)
+	require.Equal(t, "countries", item.CountrySource)
+	require.InDelta(t, 100, res.Countries["Czech Republic"].TotalDividendIncomeInPrimaryCurrency, 0.001)
+
+	// the item stored with the country has the source too
+	res, err = NewTransactionProcessor([]*importers.Transaction{div}, s, currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+	require.Equal(t, "countries", res.GetItem("CEZ").CountrySource)
+
+	// country not known by any provider
+	companydata.Providers = companydata.Providers[:1]
+	_, err = NewTransactionProcessor([]*importers.Transaction{div}, store.NewTest(), currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.NotNil(t, err)
+}
+
+func TestProcessDividendISINOnly(t *testing.T) {
+	// degiro exports just the ISIN, which can't be looked up by company data providers
+	div := testTransaction(importers.TTDividend, "2020-05-01", 0, 0)
+	div.Item = "US0378331005"
+	div.ISIN = "US0378331005"
+	div.NetTotal = 100
+
+	res, err := NewTransactionProcessor([]*importers.Transaction{div}, store.NewTest(), currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+	require.Equal(t, unknownCountry.Name, res.GetItem("US0378331005").Country.Name)
+	require.InDelta(t, 100, res.Countries[unknownCountry.Name].TotalDividendIncomeInPrimaryCurrency, 0.001)
+}
+
+func TestProcessOfflineStoredProfile(t *testing.T) {
+	s := store.NewTest()
+	require.Nil(t, s.StoreCompanyProfile(&model.CompanyProfile{
+		Code:    "CEZ",
+		Name:    "CEZ a.s.",
+		Sector:  "Utilities",
+		Country: "Czech Republic",
+		Sources: map[string]string{"Country": "Yahoo"},
+		Fetched: time.Now().AddDate(-1, 0, 0),
+	}))
+
+	div := testTransaction(importers.TTDividend, "2020-05-01", 0, 0)
+	div.NetTotal = 100
+
+	proc := NewTransactionProcessor([]*importers.Transaction{div}, s, currency.CZK, 2020, &NoTaxRules{})
+	proc.Offline = true
+	res, err := proc.Process()
+	require.Nil(t, err)
+
+	item := res.GetItem("CEZ")
+	require.NotNil(t, item)
+	require.Equal(t, "CEZ a.s.", item.Item.Name)
+	require.Equal(t, "Czech Republic", item.Country.Name)
+	require.Equal(t, "Yahoo", item.CountrySource)
+}
+
+func TestProcessStaleProfileOfStoredItem(t *testing.T) {
+	orig := companydata.Providers
+	defer func() { companydata.Providers = orig }()
+	companydata.Providers = []companydata.Provider{
+		&testCompanyProvider{"countries", &companydata.MergedData{LongName: "CEZ a.s.",
+			Address: model.Address{Country: "Czech Republic"}}},
+	}
+
+	s := store.NewTest()
+	germany, err := s.GetOrCreateCountry("Germany")
+	require.Nil(t, err)
+	require.Nil(t, s.CreateItem(&model.Item{Code: "CEZ", Name: "CEZ", CountryID: germany.ID}))
+	require.Nil(t, s.StoreCompanyProfile(&model.CompanyProfile{
+		Code:    "CEZ",
+		Name:    "CEZ",
+		Country: "Germany",
+		Sources: map[string]string{"Country": "old"},
+		Fetched: time.Now().AddDate(-1, 0, 0),
+	}))
+
+	div := testTransaction(importers.TTDividend, "2020-05-01", 0, 0)
+	div.NetTotal = 100
+
+	// offline, the stored profile is used regardless of its age
+	proc := NewTransactionProcessor([]*importers.Transaction{div}, s, currency.CZK, 2020, &NoTaxRules{})
+	proc.Offline = true
+	res, err := proc.Process()
+	require.Nil(t, err)
+	require.Equal(t, "Germany", res.GetItem("CEZ").Country.Name)
+	require.Equal(t, "old", res.GetItem("CEZ").CountrySource)
+
+	// the stale profile of the stored item is refreshed and the item updated
+	res, err = NewTransactionProcessor([]*importers.Transaction{div}, s, currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+	item := res.GetItem("CEZ")
+	require.Equal(t, "Czech Republic", item.Country.Name)
+	require.Equal(t, "countries", item.CountrySource)
+
+	stored, err := s.GetItemByCode("CEZ")
+	require.Nil(t, err)
+	require.Equal(t, "CEZ a.s.", stored.Name)
+	require.Equal(t, item.Country.ID, stored.CountryID)
+
+	// the stored item country is used without the profile
+	s = store.NewTest()
+	germany, err = s.GetOrCreateCountry("Germany")
+	require.Nil(t, err)
+	require.Nil(t, s.CreateItem(&model.Item{Code: "CEZ", Name: "CEZ", CountryID: germany.ID}))
+	proc = NewTransactionProcessor([]*importers.Transaction{div}, s, currency.CZK, 2020, &NoTaxRules{})
+	proc.Offline = true
+	res, err = proc.Process()
+	require.Nil(t, err)
+	require.Equal(t, "Germany", res.GetItem("CEZ").Country.Name)
+	require.Equal(t, itemCountrySource, res.GetItem("CEZ").CountrySource)
+}
+
+func TestResolveItems(t *testing.T) {
+	s := store.NewTest()
+	portfolio, err := s.GetOrCreatePortfolio(0, "test")
+	require.Nil(t, err)
+
+	// degiro exports just the ISIN, fio just the ticker, ibkr both
+	degiroBuy := testTransaction(importers.TTBuy, "2019-01-10", 10, 100)
+	degiroBuy.Item = "US0378331005"
+	degiroBuy.ISIN = "US0378331005"
+	fioBuy := testTransaction(importers.TTBuy, "2019-02-10", 5, 100)
+	fioBuy.Item = "AAPL"
+	ibkrBuy := testTransaction(importers.TTBuy, "2019-03-10", 1, 100)
+	ibkrBuy.Item = "AAPL"
+	ibkrBuy.ISIN = "US0378331005"
+	cez := testTransaction(importers.TTBuy, "2019-03-10", 1, 100)
+
+	trs, err := storeTransactions(s, portfolio.ID, [][]*importers.Transaction{{degiroBuy, fioBuy, ibkrBuy, cez}})
+	require.Nil(t, err)
+	require.Nil(t, resolveItems(s, trs))
+
+	require.Len(t, trs, 4)
+	for _, tr := range trs[:3] {
+		require.Equal(t, "AAPL", tr.Item)
+		require.Equal(t, "US0378331005", tr.ISIN)
+	}
+	require.Equal(t, "CEZ", trs[3].Item)
+	require.Equal(t, "", trs[3].ISIN)
+}
+
+func TestLinkItemISINs(t *testing.T) {
+	s := store.NewTest()
+	portfolio, err := s.GetOrCreatePortfolio(0, "test")
+	require.Nil(t, err)
+
+	// no transaction has both the ticker and the ISIN
+	degiroBuy := testTransaction(importers.TTBuy, "2019-01-10", 10, 100)
+	degiroBuy.Item = "US0378331005"
+	degiroBuy.ISIN = "US0378331005"
+	fioBuy := testTransaction(importers.TTBuy, "2019-02-10", 5, 100)
+	fioBuy.Item = "AAPL"
+
+	trs, err := storeTransactions(s, portfolio.ID, [][]*importers.Transaction{{degiroBuy, fioBuy}})
+	require.Nil(t, err)
+	require.Nil(t, linkItemISINs(s, []string{"AAPL=US0378331005"}))
+	require.Nil(t, resolveItems(s, trs))
+
+	for _, tr := range trs {
+		require.Equal(t, "AAPL", tr.Item)
+		require.Equal(t, "US0378331005", tr.ISIN)
+	}
+
+	require.NotNil(t, linkItemISINs(s, []string{"AAPL"}))
+}
+
+func TestStoreOverlappingStatements(t *testing.T) {
+	s := store.NewTest()
+	portfolio, err := s.GetOrCreatePortfolio(0, "test")
+	require.Nil(t, err)
+
+	// two identical fills, the second export overlaps the first one by one fill
+	fill := func() *importers.Transaction { return testTransaction(importers.TTBuy, "2019-01-10", 10, 100) }
+	sell := testTransaction(importers.TTSell, "2020-03-01", 20, 150)
+
+	trs, err := storeTransactions(s, portfolio.ID, [][]*importers.Transaction{
+		{fill(), fill()},
+		{fill(), sell},
+	})
+	require.Nil(t, err)
+	require.Len(t, trs, 3)
+
+	// identical stored fills are both processed
+	res, err := NewTransactionProcessor(trs, s, currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+	require.Len(t, res.Sells, 1)
+	require.Zero(t, res.Sells[0].MissingQuantity)
+	require.InDelta(t, 2000, res.Sells[0].Cost, 0.001)
+}
+
+func TestProcessCurrencyConversion(t *testing.T) {
+	// IBKR sells EUR for USD, Degiro buys USD by autoFX
+	cashTrade := testTransaction(importers.TTSell, "2020-03-01", 1000, 1.1)
+	cashTrade.Item = "EUR"
+	cashTrade.Currency = currency.USD
+	autoFX := testTransaction(importers.TTBuy, "2020-03-02", 1100, 0.9)
+	autoFX.Item = "USD"
+	autoFX.Currency = currency.EUR
+
+	res, err := NewTransactionProcessor([]*importers.Transaction{cashTrade, autoFX}, store.NewTest(),
+		currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+	require.Empty(t, res.Sells)
+	require.Zero(t, res.TaxableRevenuesInPrimaryCurrency)
+}
+
+func TestProcessInterest(t *testing.T) {
+	interest := testTransaction(importers.TTInterest, "2020-05-01", 0, 0)
+	interest.Item = ""
+	interest.NetTotal = 50
+
+	res, err := NewTransactionProcessor([]*importers.Transaction{interest}, store.NewTest(),
+		currency.CZK, 2020, &NoTaxRules{}).Process()
+	require.Nil(t, err)
+	require.Len(t, res.Cash, 1)
+	require.Equal(t, 50.0, res.Cash[0].RevenuesInPrimaryCurrency)
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"sort"
+	"time"
+
 	"github.com/k3a/in2tracker/backend/currency"
 	"github.com/k3a/in2tracker/backend/model"
 )
@@ -10,6 +13,9 @@ import (
 type ProcessItem struct {
 	Item    *model.Item
 	Country *model.Country
+	// CountrySource is the company data provider which supplied the country
+	// (empty if the country has been stored before)
+	CountrySource string
 
 	// item currency
 	Currency currency.Currency
@@ -28,6 +34,79 @@ type ProcessCountry struct {
 	TotalDividendTaxPaidInPrimaryCurrency float64
 }
 
+// ProcessLot holds a part of a sell matched with a single buy
+type ProcessLot struct {
+	BuyTime  time.Time
+	Quantity float64
+	// price per item of the buy
+	BuyPrice float64
+	// cost of the items incl. proportional buy fee (in sell currency)
+	Cost float64
+	// proportional part of the sell revenue
+	RevenueInPrimaryCurrency float64
+	// cost of the lot incl. proportional part of the sell fee
+	ExpensesInPrimaryCurrency float64
+	// true if exempt from tax thanks to the holding period
+	HoldingExempt bool
+}
+
+// ProcessSell holds processed result of a single sell transaction
+type ProcessSell struct {
+	Item     string
+	Time     time.Time
+	Quantity float64
+	NetTotal float64
+	Currency currency.Currency
+	// cost of the sold items incl. buy fees (in sell currency)
+	Cost float64
+	// net gain or loss (in sell currency)
+	GainLoss float64
+	// revenue excl. fees
+	RevenueInPrimaryCurrency float64
+	// cost of the sold items incl. all fees
+	ExpensesInPrimaryCurrency float64
+	// buy lots used by the sell
+	Lots []*ProcessLot
+	// quantity for which no buy has been found
+	MissingQuantity float64
+}
+
+// ProcessDividend holds a single dividend payment (positive) or tax withheld (negative)
+type ProcessDividend struct {
+	Item                      string
+	Country                   string
+	Time                      time.Time
+	NetTotal                  float64
+	Currency                  currency.Currency
+	NetTotalInPrimaryCurrency float64
+}
+
+// ProcessCash holds a single capital return, merger cash, interest or fee
+type ProcessCash struct {
+	Item                      string
+	Type                      string
+	Time                      time.Time
+	Reference                 string
+	Revenues                  float64
+	Expenses                  float64
+	Currency                  currency.Currency
+	RevenuesInPrimaryCurrency float64
+	ExpensesInPrimaryCurrency float64
+}
+
+// ProcessRate holds a currency conversion rate used during processing
+type ProcessRate struct {
+	// day of the rate (YYYY-MM-DD)
+	Date string
+	From currency.Currency
+	To   currency.Currency
+	// multiplier converting From amount to To amount
+	Rate float64
+	// day the rate has been published for (YYYY-MM-DD, differs from Date
+	// for weekends and holidays, empty if unknown)
+	RateDate string
+}
+
 // ProcessResult holds the complete result of process operation
 type ProcessResult struct {
 	// primary currency used during processing (must be set in the constructor only)
@@ -40,15 +119,94 @@ type ProcessResult struct {
 	TotalRevenuesInPrimaryCurrency float64
 	// total expenses from stock/item purchases and sells (costs + fees)
 	TotalExpensesInPrimaryCurrency float64
+
+	// tax year the result has been computed for
+	TaxYear int
+	// name of the tax rules applied
+	TaxRules string
+	// name of the lot matching (cost-basis) method
+	LotMatcher string
+	// currency rates used for conversion to primary currency (daily or uniform)
+	RateMode string
+	// sells of the tax year
+	Sells []*ProcessSell
+	// dividends and withheld taxes of the tax year
+	Dividends []*ProcessDividend
+	// other cash transactions of the tax year
+	Cash []*ProcessCash
+	// currency rates used (sorted by date)
+	Rates []*ProcessRate
+	// sell revenues and related expenses exempt from tax
+	ExemptRevenuesInPrimaryCurrency float64
+	ExemptExpensesInPrimaryCurrency float64
+	// sell revenues and related expenses subject to tax
+	TaxableRevenuesInPrimaryCurrency float64
+	TaxableExpensesInPrimaryCurrency float64
+	// true if all the sells are exempt because their revenues didn't exceed the annual limit
+	AnnualLimitExemptionApplied bool
+
+	// keys of the rates already added
+	rateKeys map[string]bool
 }
 
 func NewProcessResult(primaryCurrency currency.Currency) *ProcessResult {
 	return &ProcessResult{
-		primaryCurrency,
-		make(map[string]*ProcessCountry),
-		make(map[currency.Currency]float64),
-		0,
-		0,
+		PrimaryCurrency:         primaryCurrency,
+		Countries:               make(map[string]*ProcessCountry),
+		TotalGainLossByCurrency: make(map[currency.Currency]float64),
+		rateKeys:                make(map[string]bool),
+	}
+}
+
+// addRate records the currency rate used
+func (pr *ProcessResult) addRate(from, to currency.Currency, at time.Time, rate float64, rateDate time.Time) {
+	date := at.Format("2006-01-02")
+	key := date + string(from) + string(to)
+	if pr.rateKeys[key] {
+		return
+	}
+	pr.rateKeys[key] = true
+
+	pr.Rates = append(pr.Rates, &ProcessRate{date, from, to, rate, ""})
+	if !rateDate.IsZero() {
+		pr.Rates[len(pr.Rates)-1].RateDate = rateDate.Format("2006-01-02")
+	}
+}
+
+// sortRates sorts the rates by date
+func (pr *ProcessResult) sortRates() {
+	sort.SliceStable(pr.Rates, func(i, j int) bool {
+		return pr.Rates[i].Date < pr.Rates[j].Date
+	})
+}
+
+// CountryNames returns names of the countries sorted alphabetically
+func (pr *ProcessResult) CountryNames() []string {
+	var names []string
+	for name := range pr.Countries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TotalDividendIncomeInPrimaryCurrency returns dividend income from all the countries
+func (pr *ProcessResult) TotalDividendIncomeInPrimaryCurrency() float64 {
+	total := 0.0
+	for _, pc := range pr.Countries {
+		total += pc.TotalDividendIncomeInPrimaryCurrency
+	}
+	return total
+}
+
+// addSellLot adds revenues and expenses of a sold lot to exempt or taxable totals
+func (pr *ProcessResult) addSellLot(exempt bool, revenuesInPrimary, expensesInPrimary float64) {
+	if exempt {
+		pr.ExemptRevenuesInPrimaryCurrency += revenuesInPrimary
+		pr.ExemptExpensesInPrimaryCurrency += expensesInPrimary
+	} else {
+		pr.TaxableRevenuesInPrimaryCurrency += revenuesInPrimary
+		pr.TaxableExpensesInPrimaryCurrency += expensesInPrimary
 	}
 }
 
@@ -73,6 +231,7 @@ func (pr *ProcessResult) AddItem(item *model.Item, country *model.Country) *Proc
 	pritem := &ProcessItem{
 		item,
 		country,
+		"",
 		currency.Invalid,
 		0,
 		0,
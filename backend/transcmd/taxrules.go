@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// TaxRules decides which capital gains are exempt from the income tax
+// in the taxpayer's jurisdiction
+type TaxRules interface {
+	// Name returns short identifier of the rules
+	Name() string
+	// IsHoldingExempt returns true if gain from selling items bought at buyTime
+	// and sold at sellTime is exempt thanks to the holding period
+	IsHoldingExempt(buyTime, sellTime time.Time) bool
+	// AnnualExemptionLimit returns the limit (in primary currency) of yearly revenues
+	// from non-exempt sells under which all the sells are exempt, or zero if there is none
+	AnnualExemptionLimit() float64
+}
+
+// NoTaxRules treats all the gains as taxable
+type NoTaxRules struct{}
+
+// Name returns short identifier of the rules
+func (r *NoTaxRules) Name() string {
+	return "none"
+}
+
+// IsHoldingExempt returns false as there is no holding exemption
+func (r *NoTaxRules) IsHoldingExempt(buyTime, sellTime time.Time) bool {
+	return false
+}
+
+// AnnualExemptionLimit returns zero as there is no limit
+func (r *NoTaxRules) AnnualExemptionLimit() float64 {
+	return 0
+}
+
+// CZTaxRules implements Czech personal income tax rules for securities (§4 ZDP):
+// sells of items held for more than 3 years are exempt (time test) and all sells are exempt
+// if the yearly revenues from the remaining sells don't exceed 100 000 CZK.
+type CZTaxRules struct{}
+
+// Name returns short identifier of the rules
+func (r *CZTaxRules) Name() string {
+	return "cz"
+}
+
+// czLocation is the time zone of Czech calendar days
+var czLocation = func() *time.Location {
+	loc, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}()
+
+// czDate returns the Czech calendar date of the time (as midnight UTC)
+func czDate(t time.Time) time.Time {
+	y, m, d := t.In(czLocation).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// IsHoldingExempt returns true if the items were held for more than 3 years.
+// The period is counted in calendar days: it ends on the day of the buy 3 years later
+// (or on the last day of the month if there is no such day, e.g. for 29 Feb)
+// and only sells on the following days are exempt.
+func (r *CZTaxRules) IsHoldingExempt(buyTime, sellTime time.Time) bool {
+	buy := czDate(buyTime)
+	end := time.Date(buy.Year()+3, buy.Month(), buy.Day(), 0, 0, 0, 0, time.UTC)
+	if end.Month() != buy.Month() {
+		// last day of the month
+		end = time.Date(buy.Year()+3, buy.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+	}
+	return czDate(sellTime).After(end)
+}
+
+// AnnualExemptionLimit returns the 100 000 CZK limit
+func (r *CZTaxRules) AnnualExemptionLimit() float64 {
+	return 100000
+}
+
+// TaxRulesFromName returns tax rules by name or nil if unknown
+func TaxRulesFromName(name string) TaxRules {
+	switch strings.ToLower(name) {
+	case "cz":
+		return &CZTaxRules{}
+	case "none":
+		return &NoTaxRules{}
+	}
+	return nil
+}
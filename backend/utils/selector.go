@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Default ProviderSelector timeouts and limits
+const (
+	DefaultSelectionTTL = 24 * time.Hour
+	DefaultRetryAfter   = 10 * time.Minute
+	DefaultMaxFailures  = 3
+	DefaultMaxKeys      = 4096
+)
+
+// ProviderHealth describes the health of a provider for a key (e.g. a currency pair)
+type ProviderHealth struct {
+	// Failures is the number of consecutive failures
+	Failures    int
+	LastError   error
+	LastFailure time.Time
+	LastSuccess time.Time
+	// RetryAt is the time the failing provider is probed again
+	// (zero until the provider fails MaxFailures times in a row)
+	RetryAt time.Time
+}
+
+// Healthy returns true if the provider has not failed since the last success
+func (h ProviderHealth) Healthy() bool {
+	return h.Failures == 0
+}
+
+type selectorKey struct {
+	selected   interface{}
+	selectedAt time.Time
+	usedAt     time.Time
+	health     map[interface{}]*ProviderHealth
+}
+
+// ProviderSelector remembers the provider working for a key (e.g. a currency pair or
+// a market item) for TTL and skips providers failing repeatedly for the key until
+// RetryAfter elapses. Providers are identified by any comparable value.
+// At most MaxKeys keys are tracked, the least recently used ones are forgotten.
+// It is safe for concurrent use.
+type ProviderSelector struct {
+	// TTL is how long the working provider is preferred for the key
+	TTL time.Duration
+	// RetryAfter is how long a failing provider is skipped for the key before re-probing
+	RetryAfter time.Duration
+	// MaxFailures is the number of consecutive failures after which the provider is skipped
+	MaxFailures int
+	// MaxKeys is the maximal number of keys tracked
+	MaxKeys int
+	// Now returns the current time (replaceable in tests)
+	Now func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*selectorKey
+}
+
+// NewProviderSelector creates a new selector with default timeouts
+func NewProviderSelector() *ProviderSelector {
+	return &ProviderSelector{
+		TTL:         DefaultSelectionTTL,
+		RetryAfter:  DefaultRetryAfter,
+		MaxFailures: DefaultMaxFailures,
+		MaxKeys:     DefaultMaxKeys,
+		Now:         time.Now,
+		keys:        make(map[string]*selectorKey),
+	}
+}
+
+// key returns the state of the key, creating it if needed and forgetting
+// the least recently used key over MaxKeys (must be called locked)
+func (s *ProviderSelector) key(key string, now time.Time) *selectorKey {
+	k, has := s.keys[key]
+	if !has {
+		if s.MaxKeys > 0 && len(s.keys) >= s.MaxKeys {
+			s.forgetOldest()
+		}
+		k = &selectorKey{health: make(map[interface{}]*ProviderHealth)}
+		s.keys[key] = k
+	}
+	k.usedAt = now
+	return k
+}
+
+// forgetOldest removes the least recently used key (must be called locked)
+func (s *ProviderSelector) forgetOldest() {
+	var oldest string
+	var oldestAt time.Time
+	for key, k := range s.keys {
+		if len(oldest) == 0 || k.usedAt.Before(oldestAt) {
+			oldest, oldestAt = key, k.usedAt
+		}
+	}
+	delete(s.keys, oldest)
+}
+
+// skipped returns true if the provider health means it is skipped at the time
+func skipped(h *ProviderHealth, now time.Time) bool {
+	return !h.RetryAt.IsZero() && now.Before(h.RetryAt)
+}
+
+// Order returns the indexes of providers to try for the key: the selected provider first
+// (if not expired), then the others in their order. Providers failing repeatedly
+// for the key are left out until their RetryAt.
+func (s *ProviderSelector) Order(key string, providers []interface{}) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	k := s.key(key, now)
+
+	if k.selected != nil && now.Sub(k.selectedAt) > s.TTL {
+		k.selected = nil
+	}
+
+	var order []int
+	for i, p := range providers {
+		if h, has := k.health[p]; has && skipped(h, now) {
+			continue
+		}
+		if p == k.selected {
+			order = append([]int{i}, order...)
+		} else {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// Succeeded records the provider worked for the key and selects it
+func (s *ProviderSelector) Succeeded(key string, provider interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	k := s.key(key, now)
+	if k.selected != provider {
+		k.selected = provider
+		k.selectedAt = now
+	}
+
+	h := s.health(k, provider)
+	h.Failures = 0
+	h.LastSuccess = now
+	h.RetryAt = time.Time{}
+}
+
+// Failed records the provider failure for the key. After MaxFailures consecutive
+// failures, the provider is skipped until RetryAfter elapses.
+func (s *ProviderSelector) Failed(key string, provider interface{}, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	k := s.key(key, now)
+	if k.selected == provider {
+		k.selected = nil
+	}
+
+	h := s.health(k, provider)
+	h.Failures++
+	h.LastError = err
+	h.LastFailure = now
+	if h.Failures >= s.MaxFailures {
+		h.RetryAt = now.Add(s.RetryAfter)
+	}
+}
+
+// LastError returns the last error of the providers skipped for the key (nil if none)
+func (s *ProviderSelector) LastError(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, has := s.keys[key]
+	if !has {
+		return nil
+	}
+
+	now := s.Now()
+	var last *ProviderHealth
+	for _, h := range k.health {
+		if skipped(h, now) && (last == nil || h.LastFailure.After(last.LastFailure)) {
+			last = h
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	return last.LastError
+}
+
+func (s *ProviderSelector) health(k *selectorKey, provider interface{}) *ProviderHealth {
+	h, has := k.health[provider]
+	if !has {
+		h = &ProviderHealth{}
+		k.health[provider] = h
+	}
+	return h
+}
+
+// Health returns the health of the provider for the key
+func (s *ProviderSelector) Health(key string, provider interface{}) ProviderHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if k, has := s.keys[key]; has {
+		if h, has := k.health[provider]; has {
+			return *h
+		}
+	}
+	return ProviderHealth{}
+}
+
+// Selected returns the provider currently selected for the key or nil
+func (s *ProviderSelector) Selected(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if k, has := s.keys[key]; has && k.selected != nil && s.Now().Sub(k.selectedAt) <= s.TTL {
+		return k.selected
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderSelector(t *testing.T) {
+	now := time.Date(2020, 3, 5, 12, 0, 0, 0, time.UTC)
+	s := NewProviderSelector()
+	s.Now = func() time.Time { return now }
+
+	providers := []interface{}{"a", "b", "c"}
+	require.Equal(t, []int{0, 1, 2}, s.Order("k", providers))
+
+	// the working provider goes first
+	s.Succeeded("k", "c")
+	require.Equal(t, []int{2, 0, 1}, s.Order("k", providers))
+	require.Equal(t, "c", s.Selected("k"))
+	require.Nil(t, s.Selected("other"))
+
+	// a single failure is tolerated
+	s.Failed("k", "a", errors.New("down"))
+	require.Equal(t, []int{2, 0, 1}, s.Order("k", providers))
+	h := s.Health("k", "a")
+	require.False(t, h.Healthy())
+	require.Equal(t, 1, h.Failures)
+	require.True(t, h.RetryAt.IsZero())
+	require.Nil(t, s.LastError("k"))
+
+	// the repeatedly failing provider is skipped
+	for i := 1; i < DefaultMaxFailures; i++ {
+		s.Failed("k", "a", errors.New("still down"))
+	}
+	require.Equal(t, []int{2, 1}, s.Order("k", providers))
+	h = s.Health("k", "a")
+	require.Equal(t, DefaultMaxFailures, h.Failures)
+	require.Equal(t, now.Add(DefaultRetryAfter), h.RetryAt)
+	require.True(t, s.Health("k", "b").Healthy())
+	require.EqualError(t, s.LastError("k"), "still down")
+
+	// and re-probed after RetryAfter
+	now = now.Add(DefaultRetryAfter)
+	require.Equal(t, []int{2, 0, 1}, s.Order("k", providers))
+	s.Succeeded("k", "a")
+	require.True(t, s.Health("k", "a").Healthy())
+	require.Equal(t, []int{0, 1, 2}, s.Order("k", providers))
+
+	// the selection expires after TTL
+	now = now.Add(DefaultSelectionTTL + time.Second)
+	require.Nil(t, s.Selected("k"))
+	for i := 0; i < DefaultMaxFailures; i++ {
+		s.Failed("k", "b", errors.New("down"))
+	}
+	require.Equal(t, []int{0, 2}, s.Order("k", providers))
+}
+
+func TestProviderSelectorMaxKeys(t *testing.T) {
+	now := time.Date(2020, 3, 5, 12, 0, 0, 0, time.UTC)
+	s := NewProviderSelector()
+	s.Now = func() time.Time { return now }
+	s.MaxKeys = 2
+
+	s.Succeeded("a", "p")
+	now = now.Add(time.Second)
+	s.Succeeded("b", "p")
+	now = now.Add(time.Second)
+	s.Order("a", []interface{}{"p"})
+	now = now.Add(time.Second)
+
+	// the least recently used key is forgotten
+	s.Succeeded("c", "p")
+	require.Len(t, s.keys, 2)
+	require.Equal(t, "p", s.Selected("a"))
+	require.Nil(t, s.Selected("b"))
+	require.Equal(t, "p", s.Selected("c"))
+}
+
+func TestProviderSelectorConcurrent(t *testing.T) {
+	s := NewProviderSelector()
+	providers := []interface{}{"a", "b"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("k%d", j%4)
+				for _, idx := range s.Order(key, providers) {
+					if (i+j)%3 == 0 {
+						s.Failed(key, providers[idx], errors.New("down"))
+					} else {
+						s.Succeeded(key, providers[idx])
+						break
+					}
+				}
+				s.Health(key, "a")
+				s.Selected(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+}